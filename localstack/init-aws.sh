@@ -15,4 +15,15 @@ echo "✅ SQS test queue created."
 
 echo "🚀 Creating SQS queue: test-queue-dlq..."
 awslocal sqs create-queue --queue-name test-queue-dlq
-echo "✅ SQS test queue dlq created."
\ No newline at end of file
+echo "✅ SQS test queue dlq created."
+echo "🚀 Creating SQS FIFO queue: events.fifo..."
+awslocal sqs create-queue --queue-name events.fifo --attributes FifoQueue=true
+echo "✅ SQS FIFO queue created."
+
+echo "🚀 Creating SQS FIFO queue: events-dlq.fifo..."
+awslocal sqs create-queue --queue-name events-dlq.fifo --attributes FifoQueue=true
+echo "✅ SQS FIFO dead letter queue created."
+
+echo "🚀 Creating S3 bucket: events-archive..."
+awslocal s3 mb s3://events-archive
+echo "✅ S3 archive bucket created."
@@ -0,0 +1,8 @@
+-- The login roles the processor connects as, granted the tables through
+-- event_processor once the migrations have run. processor is subject to row
+-- level security, unlike the user superuser. processor_admin bypasses it, for
+-- the jobs handling every client's events, and is never used for the ones
+-- scoped to a client
+CREATE ROLE event_processor NOLOGIN NOBYPASSRLS;
+CREATE ROLE processor LOGIN PASSWORD 'password' NOBYPASSRLS IN ROLE event_processor;
+CREATE ROLE processor_admin LOGIN PASSWORD 'password' BYPASSRLS IN ROLE event_processor;
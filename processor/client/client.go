@@ -0,0 +1,322 @@
+// Package client publishes events to the queue consumed by the processor. It
+// validates events the way the processor does, so invalid events fail when
+// they are published rather than in the DLQ.
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+var (
+	ErrFailedToGetQueueURL = errors.New("failed to get queue URL")
+	ErrInvalidEvent        = errors.New("event is invalid")
+	ErrFailedToPublish     = errors.New("failed to publish event")
+	ErrNotConfirmed        = errors.New("event was not confirmed")
+)
+
+const (
+	maxBatchEntries = 10
+	// maxMessageBytes is the SQS limit on a message, and on the messages of
+	// a batch together.
+	maxMessageBytes = 256 * 1024
+)
+
+// SQS is the part of the SQS client used to publish.
+type SQS interface {
+	GetQueueUrl(ctx context.Context, params *sqs.GetQueueUrlInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueUrlOutput, error)
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
+
+type Client struct {
+	sqs            SQS
+	queueURL       string
+	fifo           bool
+	idempotencyKey func(models.Event) string
+	confirmer      Confirmer
+	timeout        time.Duration
+}
+
+type Option func(*Client)
+
+// WithIdempotencyKey derives the idempotency key of each event, e.g. from an
+// ID in its payload, so publishing it again is skipped by the processor.
+// Every publish gets a random key by default, which only guards against
+// duplicate deliveries.
+func WithIdempotencyKey(key func(models.Event) string) Option {
+	return func(c *Client) {
+		c.idempotencyKey = key
+	}
+}
+
+// WithConfirmation makes publishing wait, up to timeout, for the processor
+// to save the events.
+func WithConfirmation(confirmer Confirmer, timeout time.Duration) Option {
+	return func(c *Client) {
+		c.confirmer = confirmer
+		c.timeout = timeout
+	}
+}
+
+// Receipt identifies a published event.
+type Receipt struct {
+	MessageID      string
+	ClientID       string
+	IdempotencyKey string
+	// Err is set by PublishBatch for the events that failed.
+	Err error
+}
+
+func New(ctx context.Context, sqsClient SQS, queueName string, opts ...Option) (*Client, error) {
+	queueURL, err := sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(queueName)})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToGetQueueURL, err)
+	}
+
+	c := &Client{
+		sqs:      sqsClient,
+		queueURL: aws.ToString(queueURL.QueueUrl),
+		fifo:     strings.HasSuffix(queueName, ".fifo"),
+		idempotencyKey: func(models.Event) string {
+			return rand.Text()
+		},
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// Publish sends an event, stamping it with the current time when it has no
+// timestamp. The trace in ctx, see ContextWithTraceparent, is propagated to
+// the processor.
+func (c *Client) Publish(ctx context.Context, event models.Event) (Receipt, error) {
+	msg, err := c.message(ctx, event)
+	if err != nil {
+		return Receipt{}, err
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(c.queueURL),
+		MessageBody:       msg.body,
+		MessageAttributes: msg.attributes,
+	}
+
+	if c.fifo {
+		input.MessageGroupId = msg.groupID
+		input.MessageDeduplicationId = msg.deduplicationID
+	}
+
+	out, err := c.sqs.SendMessage(ctx, input)
+	if err != nil {
+		return Receipt{}, fmt.Errorf("%w: %w", ErrFailedToPublish, err)
+	}
+
+	receipt := Receipt{MessageID: aws.ToString(out.MessageId), ClientID: event.ClientID, IdempotencyKey: msg.key}
+
+	if c.confirmer != nil {
+		if err := c.confirm(ctx, []*Receipt{&receipt}); err != nil {
+			return receipt, err
+		}
+
+		if receipt.Err != nil {
+			return receipt, receipt.Err
+		}
+	}
+
+	return receipt, nil
+}
+
+// PublishBatch sends events in as few SendMessageBatch calls as the SQS
+// limits allow. It returns a receipt for every event, in order, and an error
+// when any of them failed.
+func (c *Client) PublishBatch(ctx context.Context, events []models.Event) ([]Receipt, error) {
+	receipts := make([]Receipt, len(events))
+	messages := make([]*message, len(events))
+
+	for i, event := range events {
+		receipts[i].ClientID = event.ClientID
+
+		msg, err := c.message(ctx, event)
+		if err != nil {
+			receipts[i].Err = err
+
+			continue
+		}
+
+		receipts[i].IdempotencyKey = msg.key
+		messages[i] = msg
+	}
+
+	var sent []*Receipt
+
+	for _, batch := range c.batches(messages) {
+		entries := make([]types.SendMessageBatchRequestEntry, 0, len(batch))
+
+		for _, i := range batch {
+			entry := types.SendMessageBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(i)),
+				MessageBody:       messages[i].body,
+				MessageAttributes: messages[i].attributes,
+			}
+
+			if c.fifo {
+				entry.MessageGroupId = messages[i].groupID
+				entry.MessageDeduplicationId = messages[i].deduplicationID
+			}
+
+			entries = append(entries, entry)
+		}
+
+		out, err := c.sqs.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(c.queueURL),
+			Entries:  entries,
+		})
+		if err != nil {
+			for _, i := range batch {
+				receipts[i].Err = fmt.Errorf("%w: %w", ErrFailedToPublish, err)
+			}
+
+			continue
+		}
+
+		for _, entry := range out.Successful {
+			i, _ := strconv.Atoi(aws.ToString(entry.Id))
+			receipts[i].MessageID = aws.ToString(entry.MessageId)
+			sent = append(sent, &receipts[i])
+		}
+
+		for _, entry := range out.Failed {
+			i, _ := strconv.Atoi(aws.ToString(entry.Id))
+			receipts[i].Err = fmt.Errorf("%w: %s: %s", ErrFailedToPublish, aws.ToString(entry.Code), aws.ToString(entry.Message))
+		}
+	}
+
+	if c.confirmer != nil && len(sent) > 0 {
+		if err := c.confirm(ctx, sent); err != nil {
+			return receipts, err
+		}
+	}
+
+	var errs []error
+
+	for _, receipt := range receipts {
+		if receipt.Err != nil {
+			errs = append(errs, receipt.Err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return receipts, fmt.Errorf("%d of %d events failed: %w", len(errs), len(events), errors.Join(errs...))
+	}
+
+	return receipts, nil
+}
+
+// message is a validated event ready to be sent.
+type message struct {
+	key             string
+	body            *string
+	attributes      map[string]types.MessageAttributeValue
+	groupID         *string
+	deduplicationID *string
+	size            int
+}
+
+func (c *Client) message(ctx context.Context, event models.Event) (*message, error) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now().UTC()
+	}
+
+	if problems := event.Problems(); len(problems) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidEvent, strings.Join(problems, ", "))
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+	}
+
+	key := c.idempotencyKey(event)
+	traceparent := TraceparentFromContext(ctx)
+
+	msg := &message{
+		key:  key,
+		body: aws.String(string(body)),
+		attributes: map[string]types.MessageAttributeValue{
+			models.IdempotencyKeyAttribute: {DataType: aws.String("String"), StringValue: aws.String(key)},
+			models.TraceparentAttribute:    {DataType: aws.String("String"), StringValue: aws.String(traceparent)},
+		},
+		// SQS counts attribute names, types and values towards the size
+		size: len(body) + len(key) + len(traceparent) + 2*len("String") +
+			len(models.IdempotencyKeyAttribute) + len(models.TraceparentAttribute),
+	}
+
+	if msg.size > maxMessageBytes {
+		return nil, fmt.Errorf("%w: message is larger than %d bytes", ErrInvalidEvent, maxMessageBytes)
+	}
+
+	// FIFO queues keep the order of each client's events and deduplicate by
+	// key within their five minute window
+	if c.fifo {
+		msg.groupID = aws.String(event.ClientID)
+		msg.deduplicationID = aws.String(deduplicationID(key))
+	}
+
+	return msg, nil
+}
+
+// batches groups the indexes of the valid messages into batches within the
+// SQS entry and size limits.
+func (c *Client) batches(messages []*message) [][]int {
+	var (
+		batches [][]int
+		batch   []int
+		size    int
+	)
+
+	for i, msg := range messages {
+		if msg == nil {
+			continue
+		}
+
+		if len(batch) == maxBatchEntries || size+msg.size > maxMessageBytes {
+			batches = append(batches, batch)
+			batch, size = nil, 0
+		}
+
+		batch = append(batch, i)
+		size += msg.size
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches
+}
+
+var invalidDeduplicationChars = regexp.MustCompile("[^a-zA-Z0-9!\"#$%&'()*+,\\-./:;<=>?@\\[\\\\\\]^_`{|}~]")
+
+// deduplicationID makes key a valid FIFO deduplication ID, at most 128
+// alphanumeric or punctuation characters.
+func deduplicationID(key string) string {
+	id := invalidDeduplicationChars.ReplaceAllString(key, "_")
+
+	return id[:min(len(id), 128)]
+}
@@ -0,0 +1,274 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/client"
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/EWK20/event-processor/processor/internal/sqsfake"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingSQS counts the SendMessageBatch calls made to the fake.
+type countingSQS struct {
+	*sqs.Client
+	batches atomic.Int32
+}
+
+func (c *countingSQS) SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	c.batches.Add(1)
+
+	return c.Client.SendMessageBatch(ctx, params, optFns...)
+}
+
+func setup(t *testing.T, queue string) (*sqsfake.Server, *countingSQS) {
+	t.Helper()
+
+	var attributes map[string]string
+	if strings.HasSuffix(queue, ".fifo") {
+		attributes = map[string]string{"FifoQueue": "true"}
+	}
+
+	fake := sqsfake.New()
+	require.NoError(t, fake.CreateQueue(queue, attributes))
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	sqsClient, err := config.AWS{
+		AWSRegion:          sqsfake.Region,
+		AWSAccessKeyID:     "test",
+		AWSSecretAccessKey: "test",
+		SQSEndpoint:        server.URL,
+	}.SQSClient(t.Context())
+	require.NoError(t, err)
+
+	return fake, &countingSQS{Client: sqsClient}
+}
+
+func event(transactionID string) models.Event {
+	return models.Event{
+		EventType: "transaction_approved",
+		ClientID:  "client_123",
+		Payload:   map[string]any{"transaction_id": transactionID, "amount": "10.00"},
+	}
+}
+
+func TestPublish(t *testing.T) {
+	type Test struct {
+		queue string
+		event models.Event
+		err   error
+	}
+
+	testCases := map[string]Test{
+		"Valid Event": {
+			queue: "events",
+			event: event("txn_1"),
+		},
+		"Valid Event On FIFO Queue": {
+			queue: "events.fifo",
+			event: event("txn_1"),
+		},
+		"Missing Client ID": {
+			queue: "events",
+			event: models.Event{EventType: "transaction_approved", Payload: map[string]any{}},
+			err:   client.ErrInvalidEvent,
+		},
+	}
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	for scenario, test := range testCases {
+		t.Run(scenario, func(t *testing.T) {
+			fake, sqsClient := setup(t, test.queue)
+
+			c, err := client.New(t.Context(), sqsClient, test.queue)
+			require.NoError(t, err)
+
+			receipt, err := c.Publish(client.ContextWithTraceparent(t.Context(), traceparent), test.event)
+
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+				assert.Empty(t, fake.Messages(test.queue))
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			messages := fake.Messages(test.queue)
+			require.Len(t, messages, 1)
+			assert.Equal(t, receipt.MessageID, messages[0].ID)
+			assert.Equal(t, receipt.IdempotencyKey, messages[0].Attributes[models.IdempotencyKeyAttribute].StringValue)
+			assert.Equal(t, traceparent, messages[0].Attributes[models.TraceparentAttribute].StringValue)
+
+			// The processor decodes the same event, stamped with a timestamp
+			var published models.Event
+			require.NoError(t, json.Unmarshal([]byte(messages[0].Body), &published))
+			assert.Equal(t, test.event.ClientID, published.ClientID)
+			assert.WithinDuration(t, time.Now(), published.Timestamp, time.Minute)
+			assert.Empty(t, published.Problems())
+		})
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	fake, sqsClient := setup(t, "events.fifo")
+
+	c, err := client.New(t.Context(), sqsClient, "events.fifo", client.WithIdempotencyKey(func(event models.Event) string {
+		return event.Payload.(map[string]any)["transaction_id"].(string)
+	}))
+	require.NoError(t, err)
+
+	first, err := c.Publish(t.Context(), event("txn_1"))
+	require.NoError(t, err)
+
+	// Publishing the same transaction again is deduplicated by the queue
+	second, err := c.Publish(t.Context(), event("txn_1"))
+	require.NoError(t, err)
+
+	assert.Equal(t, "txn_1", first.IdempotencyKey)
+	assert.Equal(t, first.MessageID, second.MessageID)
+	assert.Len(t, fake.Messages("events.fifo"), 1)
+}
+
+func TestPublishBatch(t *testing.T) {
+	fake, sqsClient := setup(t, "events")
+
+	c, err := client.New(t.Context(), sqsClient, "events")
+	require.NoError(t, err)
+
+	events := make([]models.Event, 0, 25)
+	for i := range 25 {
+		events = append(events, event("txn_"+strconv.Itoa(i)))
+	}
+
+	events[7].ClientID = ""
+
+	receipts, err := c.PublishBatch(t.Context(), events)
+	require.ErrorIs(t, err, client.ErrInvalidEvent)
+	require.Len(t, receipts, 25)
+
+	for i, receipt := range receipts {
+		if i == 7 {
+			assert.ErrorIs(t, receipt.Err, client.ErrInvalidEvent)
+			assert.Empty(t, receipt.MessageID)
+
+			continue
+		}
+
+		assert.NoError(t, receipt.Err)
+		assert.NotEmpty(t, receipt.MessageID)
+	}
+
+	assert.Len(t, fake.Messages("events"), 24)
+	assert.Equal(t, int32(3), sqsClient.batches.Load())
+}
+
+// fakeConfirmer confirms the messages in saved, keyed by message ID, when
+// they are looked up for the client that saved them.
+type fakeConfirmer struct {
+	mu    sync.Mutex
+	saved map[string]string
+}
+
+func (f *fakeConfirmer) save(messageID, clientID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.saved[messageID] = clientID
+}
+
+func (f *fakeConfirmer) Confirmed(_ context.Context, clientID string, messageIDs []string) (map[string]bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	confirmed := make(map[string]bool)
+
+	for _, id := range messageIDs {
+		if f.saved[id] == clientID {
+			confirmed[id] = true
+		}
+	}
+
+	return confirmed, nil
+}
+
+func TestConfirmation(t *testing.T) {
+	type Test struct {
+		// savedBy is the client the event is saved for, none when it isn't.
+		savedBy string
+		err     error
+	}
+
+	testCases := map[string]Test{
+		"Saved": {
+			savedBy: "client_123",
+		},
+		"Never Saved": {
+			err: client.ErrNotConfirmed,
+		},
+		"Only Found For Another Client": {
+			savedBy: "client_456",
+			err:     client.ErrNotConfirmed,
+		},
+	}
+
+	for scenario, test := range testCases {
+		t.Run(scenario, func(t *testing.T) {
+			fake, sqsClient := setup(t, "events")
+			confirmer := &fakeConfirmer{saved: make(map[string]string)}
+
+			c, err := client.New(t.Context(), sqsClient, "events", client.WithConfirmation(confirmer, 500*time.Millisecond))
+			require.NoError(t, err)
+
+			// Stands in for the processor saving the event
+			if test.savedBy != "" {
+				go func() {
+					for {
+						if messages := fake.Messages("events"); len(messages) > 0 {
+							confirmer.save(messages[0].ID, test.savedBy)
+
+							return
+						}
+
+						time.Sleep(10 * time.Millisecond)
+					}
+				}()
+			}
+
+			_, err = c.Publish(t.Context(), event("txn_1"))
+
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTraceparent(t *testing.T) {
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	assert.Equal(t, traceparent, client.TraceparentFromContext(client.ContextWithTraceparent(t.Context(), traceparent)))
+
+	// Without a valid traceparent a new trace is started
+	started := client.TraceparentFromContext(client.ContextWithTraceparent(t.Context(), "not-a-traceparent"))
+	assert.Regexp(t, `^00-[0-9a-f]{32}-[0-9a-f]{16}-01$`, started)
+	assert.NotEqual(t, started, client.TraceparentFromContext(t.Context()))
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const confirmInterval = 100 * time.Millisecond
+
+// Confirmer reports which of a client's published messages the processor has
+// saved.
+type Confirmer interface {
+	Confirmed(ctx context.Context, clientID string, messageIDs []string) (map[string]bool, error)
+}
+
+// DBConfirmer confirms events by finding them in the processor's events
+// table, which needs its message_metadata enrichment stage to record message
+// IDs. Events sent to the DLQ are never confirmed.
+type DBConfirmer struct {
+	db *sql.DB
+}
+
+func NewDBConfirmer(db *sql.DB) *DBConfirmer {
+	return &DBConfirmer{db: db}
+}
+
+// Confirmed reads in a transaction scoped to the client with app.tenant_id,
+// so row level security only lets it find the client's own events.
+func (c *DBConfirmer) Confirmed(ctx context.Context, clientID string, messageIDs []string) (map[string]bool, error) {
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('app.tenant_id', $1, true)`, clientID); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT message_id FROM events WHERE message_id = ANY($1)`, pq.Array(messageIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	confirmed := make(map[string]bool, len(messageIDs))
+
+	for rows.Next() {
+		var messageID string
+		if err := rows.Scan(&messageID); err != nil {
+			return nil, err
+		}
+
+		confirmed[messageID] = true
+	}
+
+	return confirmed, rows.Err()
+}
+
+// confirm waits for the processor to save the published events, setting the
+// error of those it hasn't saved within the timeout.
+func (c *Client) confirm(ctx context.Context, receipts []*Receipt) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	pending := make(map[string]*Receipt, len(receipts))
+	for _, receipt := range receipts {
+		pending[receipt.MessageID] = receipt
+	}
+
+	ticker := time.NewTicker(confirmInterval)
+	defer ticker.Stop()
+
+	for len(pending) > 0 {
+		ids := make(map[string][]string)
+		for id, receipt := range pending {
+			ids[receipt.ClientID] = append(ids[receipt.ClientID], id)
+		}
+
+		for clientID, clientIDs := range ids {
+			confirmed, err := c.confirmer.Confirmed(ctx, clientID, clientIDs)
+			if err != nil && ctx.Err() == nil {
+				return fmt.Errorf("%w: %w", ErrNotConfirmed, err)
+			}
+
+			for id, ok := range confirmed {
+				if ok {
+					delete(pending, id)
+				}
+			}
+		}
+
+		if len(pending) == 0 {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			for _, receipt := range pending {
+				receipt.Err = fmt.Errorf("%w: %w", ErrNotConfirmed, ctx.Err())
+			}
+
+			return nil
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+)
+
+type traceparentKey struct{}
+
+var traceparentPattern = regexp.MustCompile(`^[0-9a-f]{2}-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+// ContextWithTraceparent attaches a W3C traceparent to ctx, which is sent
+// with the events published with it. Invalid traceparents are ignored.
+func ContextWithTraceparent(ctx context.Context, traceparent string) context.Context {
+	if !traceparentPattern.MatchString(traceparent) {
+		return ctx
+	}
+
+	return context.WithValue(ctx, traceparentKey{}, traceparent)
+}
+
+// TraceparentFromContext returns the traceparent attached to ctx, or starts
+// a new trace when there is none.
+func TraceparentFromContext(ctx context.Context) string {
+	if traceparent, ok := ctx.Value(traceparentKey{}).(string); ok {
+		return traceparent
+	}
+
+	var ids [24]byte
+	_, _ = rand.Read(ids[:])
+
+	return "00-" + hex.EncodeToString(ids[:16]) + "-" + hex.EncodeToString(ids[16:]) + "-01"
+}
@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/EWK20/event-processor/processor/internal/archive"
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func createArchiveCMD() *cobra.Command {
+	archiveCMD := &cobra.Command{
+		Use:   "archive",
+		Short: "Archive stored events to a directory or S3 bucket, optionally deleting them",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(cmd.Flags())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to get config")
+			}
+
+			filter, err := filterFromFlags(cmd)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid filter")
+			}
+
+			if filter.To.IsZero() {
+				log.Fatal().Msg("--to is required, events before it are archived")
+			}
+
+			destination, _ := cmd.Flags().GetString("destination")
+			remove, _ := cmd.Flags().GetBool("delete")
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			storage, err := archive.NewStorage(ctx, destination, cfg.AWS)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid destination")
+			}
+
+			db, err := openDatabase(cfg, tenantFromFlags(cmd))
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to connect to database")
+			}
+			defer db.Close()
+
+			manifest, err := archive.New(db, storage, archive.WithDelete(remove)).Archive(ctx, filter)
+			if err != nil {
+				log.Fatal().Err(err).Msg("archive failed")
+			}
+
+			log.Info().Int64("archived", manifest.Events).Int("files", len(manifest.Files)).Bool("deleted", remove).Msg("archive finished")
+		},
+	}
+
+	bindFilterFlags(archiveCMD)
+
+	archiveCMD.Flags().String("destination", "", "directory, file:// or s3://bucket/prefix URL to write the archive to")
+	archiveCMD.Flags().Bool("delete", false, "delete archived events once every file has been verified")
+	_ = archiveCMD.MarkFlagRequired("destination")
+
+	return archiveCMD
+}
+
+func createRestoreCMD() *cobra.Command {
+	restoreCMD := &cobra.Command{
+		Use:   "restore",
+		Short: "Load archived events back into the events table",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(cmd.Flags())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to get config")
+			}
+
+			filter, err := filterFromFlags(cmd)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid filter")
+			}
+
+			source, _ := cmd.Flags().GetString("source")
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			storage, err := archive.NewStorage(ctx, source, cfg.AWS)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid source")
+			}
+
+			db, err := openDatabase(cfg, tenantFromFlags(cmd))
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to connect to database")
+			}
+			defer db.Close()
+
+			result, err := archive.NewRestorer(db, storage).Restore(ctx, filter)
+			if err != nil {
+				log.Fatal().Err(err).Int64("restored", result.Restored).Msg("restore failed")
+			}
+
+			log.Info().
+				Int("files", result.Files).
+				Int64("events", result.Events).
+				Int64("restored", result.Restored).
+				Int64("skipped", result.Skipped).
+				Msg("restore finished")
+		},
+	}
+
+	bindFilterFlags(restoreCMD)
+
+	restoreCMD.Flags().String("source", "", "directory, file:// or s3://bucket/prefix URL of the archive")
+	_ = restoreCMD.MarkFlagRequired("source")
+
+	return restoreCMD
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func createConfigCMD() *cobra.Command {
+	configCMD := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the processor configuration",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.HelpFunc()(cmd, args)
+
+			return ErrNonFuncCMD
+		},
+	}
+
+	configCMD.AddCommand(&cobra.Command{
+		Use:   "print",
+		Short: "Print the resolved configuration with secrets masked",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(cmd.Flags())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to get config")
+			}
+
+			out, err := yaml.Marshal(cfg.Masked())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to encode config")
+			}
+
+			fmt.Fprint(cmd.OutOrStdout(), string(out))
+		},
+	})
+
+	return configCMD
+}
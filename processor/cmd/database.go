@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/EWK20/event-processor/processor/internal/db"
+	"github.com/EWK20/event-processor/processor/internal/encrypt"
+)
+
+// openDatabase connects to the database, encrypting and decrypting payload
+// fields when a keyfile is configured.
+func openDatabase(cfg *config.Config, opts ...db.Option) (*db.Database, error) {
+	if cfg.Encryption.Keyfile != "" {
+		keys, err := encrypt.NewKeyfile(cfg.Encryption.Keyfile)
+		if err != nil {
+			return nil, err
+		}
+
+		opts = append(opts, db.WithEncryption(encrypt.New(keys, cfg.Encryption.Fields)))
+	}
+
+	return db.New(cfg.DB, opts...)
+}
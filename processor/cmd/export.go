@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/EWK20/event-processor/processor/internal/export"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func createExportCMD() *cobra.Command {
+	exportCMD := &cobra.Command{
+		Use:   "export",
+		Short: "Export stored events to NDJSON, CSV or Parquet files",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(cmd.Flags())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to get config")
+			}
+
+			filter, err := filterFromFlags(cmd)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid filter")
+			}
+
+			format, _ := cmd.Flags().GetString("format")
+			output, _ := cmd.Flags().GetString("output")
+			compression, _ := cmd.Flags().GetString("compression")
+			columns, _ := cmd.Flags().GetStringSlice("columns")
+			maxFileSize, _ := cmd.Flags().GetInt64("max-file-size")
+
+			db, err := openDatabase(cfg, tenantFromFlags(cmd))
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to connect to database")
+			}
+			defer db.Close()
+
+			exporter, err := export.New(db, format,
+				export.WithFilter(filter),
+				export.WithColumns(columns),
+				export.WithCompression(compression),
+				export.WithMaxFileSize(maxFileSize),
+			)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid export")
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			result, err := exporter.Run(ctx, output)
+			if err != nil {
+				log.Fatal().Err(err).Int64("exported", result.Events).Strs("files", result.Files).Msg("export failed")
+			}
+
+			log.Info().Int64("exported", result.Events).Strs("files", result.Files).Msg("export finished")
+		},
+	}
+
+	bindFilterFlags(exportCMD)
+
+	exportCMD.Flags().String("format", export.FormatNDJSON, "file format, one of "+strings.Join(export.Formats, ", "))
+	exportCMD.Flags().String("output", "events", "output file path without extension, rotated files are numbered")
+	exportCMD.Flags().String("compression", export.CompressionNone, "compression, one of "+strings.Join(export.Compressions, ", "))
+	exportCMD.Flags().StringSlice("columns", export.DefaultColumns, "CSV columns, payload.<path> and metadata.<path> flatten nested fields")
+	exportCMD.Flags().Int64("max-file-size", 0, "start a new file once the current one reaches this many bytes, 0 writes a single file")
+
+	return exportCMD
+}
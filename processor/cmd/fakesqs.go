@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/sqsfake"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func createFakeSQSCMD() *cobra.Command {
+	fakeSQSCMD := &cobra.Command{
+		Use:   "fake-sqs",
+		Short: "Serve an in memory SQS, to run the producer and processor without LocalStack",
+		Run: func(cmd *cobra.Command, args []string) {
+			addr, _ := cmd.Flags().GetString("addr")
+			queues, _ := cmd.Flags().GetStringSlice("queues")
+
+			fake := sqsfake.New()
+
+			for _, name := range queues {
+				var attributes map[string]string
+				if strings.HasSuffix(name, ".fifo") {
+					attributes = map[string]string{"FifoQueue": "true"}
+				}
+
+				if err := fake.CreateQueue(name, attributes); err != nil {
+					log.Fatal().Err(err).Str("queue", name).Msg("failed to create queue")
+				}
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			server := &http.Server{Addr: addr, Handler: fake, ReadHeaderTimeout: 5 * time.Second}
+
+			go func() {
+				<-ctx.Done()
+
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+
+				_ = server.Shutdown(shutdownCtx)
+			}()
+
+			log.Info().Str("addr", addr).Strs("queues", queues).Msg("serving fake SQS")
+
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatal().Err(err).Msg("fake SQS failed")
+			}
+		},
+	}
+
+	fakeSQSCMD.Flags().String("addr", ":4566", "address to listen on")
+	fakeSQSCMD.Flags().StringSlice("queues", []string{"events", "events-dlq", "events.fifo", "events-dlq.fifo"}, "queues to create, names ending in .fifo are FIFO queues")
+
+	return fakeSQSCMD
+}
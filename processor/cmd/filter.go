@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/db"
+	"github.com/spf13/cobra"
+)
+
+// bindFilterFlags registers the flags selecting stored events. Either
+// --client-id or --all-clients is required, so a command can't select every
+// client's events by leaving the client out.
+func bindFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().String("client-id", "", "only select events of this client")
+	cmd.Flags().Bool("all-clients", false, "select the events of every client")
+	cmd.Flags().String("event-type", "", "only select events of this type")
+	cmd.Flags().String("from", "", "only select events at or after this RFC 3339 timestamp")
+	cmd.Flags().String("to", "", "only select events before this RFC 3339 timestamp")
+
+	cmd.MarkFlagsOneRequired("client-id", "all-clients")
+	cmd.MarkFlagsMutuallyExclusive("client-id", "all-clients")
+}
+
+func filterFromFlags(cmd *cobra.Command) (db.Filter, error) {
+	filter := db.Filter{
+		ClientID:  stringFlag(cmd, "client-id"),
+		EventType: stringFlag(cmd, "event-type"),
+	}
+
+	for name, ptr := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := stringFlag(cmd, name)
+		if value == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, fmt.Errorf("--%s: %w", name, err)
+		}
+
+		*ptr = t
+	}
+
+	return filter, nil
+}
+
+// tenantFromFlags scopes the database sessions to the client selected with
+// --client-id, so row level security hides the events of other clients
+// whatever the query, or to every client with --all-clients.
+func tenantFromFlags(cmd *cobra.Command) db.Option {
+	if allClients, _ := cmd.Flags().GetBool("all-clients"); allClients {
+		return db.WithAllTenants()
+	}
+
+	return db.WithTenant(stringFlag(cmd, "client-id"))
+}
+
+func stringFlag(cmd *cobra.Command, name string) string {
+	value, _ := cmd.Flags().GetString(name)
+
+	return value
+}
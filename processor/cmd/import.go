@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/EWK20/event-processor/processor/internal/db"
+	"github.com/EWK20/event-processor/processor/internal/importer"
+	"github.com/EWK20/event-processor/processor/internal/schema"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const importProgressInterval = 5 * time.Second
+
+func createImportCMD() *cobra.Command {
+	importCMD := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Bulk import events from an NDJSON or CSV file",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			path := args[0]
+
+			cfg, err := config.Load(cmd.Flags())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to get config")
+			}
+
+			format, _ := cmd.Flags().GetString("format")
+			batchSize, _ := cmd.Flags().GetInt("batch-size")
+			rejects, _ := cmd.Flags().GetString("rejects")
+			checkpoint, _ := cmd.Flags().GetString("checkpoint")
+
+			if !cmd.Flags().Changed("rejects") {
+				rejects = path + ".rejects.ndjson"
+			}
+
+			if !cmd.Flags().Changed("checkpoint") {
+				checkpoint = path + ".checkpoint.json"
+			}
+
+			db, err := openDatabase(cfg, db.WithAllTenants())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to connect to database")
+			}
+			defer db.Close()
+
+			redactor, err := loadRedactor(cfg)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to load redaction rules")
+			}
+
+			var lastReport time.Time
+
+			opts := []importer.Option{
+				importer.WithFormat(format),
+				importer.WithBatchSize(batchSize),
+				importer.WithRejects(rejects),
+				importer.WithCheckpoint(checkpoint),
+				importer.WithEventTypes(cfg.Processor.EventTypes...),
+				importer.WithProgress(func(p importer.Progress) {
+					if time.Since(lastReport) < importProgressInterval {
+						return
+					}
+
+					lastReport = time.Now()
+
+					withProgress(log.Info(), p).Msg("importing")
+				}),
+			}
+
+			if redactor != nil {
+				opts = append(opts, importer.WithRedaction(redactor))
+			}
+
+			importer := importer.New(db, schema.Default(), opts...)
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			progress, err := importer.Run(ctx, path)
+			if err != nil {
+				withProgress(log.Fatal(), progress).Err(err).Str("checkpoint", checkpoint).Msg("import stopped, run it again to resume")
+			}
+
+			withProgress(log.Info(), progress).Str("rejects", rejects).Msg("import finished")
+		},
+	}
+
+	importCMD.Flags().String("format", "", "file format, ndjson or csv, inferred from the file extension by default")
+	importCMD.Flags().Int("batch-size", 1000, "records read between each COPY and checkpoint")
+	importCMD.Flags().String("rejects", "", "file rejected records are written to with the reason, <file>.rejects.ndjson by default")
+	importCMD.Flags().String("checkpoint", "", "file recording progress, <file>.checkpoint.json by default, empty disables resuming")
+
+	return importCMD
+}
+
+func withProgress(event *zerolog.Event, p importer.Progress) *zerolog.Event {
+	var percent float64
+	if p.Size > 0 {
+		percent = float64(p.Offset) / float64(p.Size) * 100
+	}
+
+	return event.
+		Int64("records", p.Records).
+		Int64("imported", p.Imported).
+		Int64("rejected", p.Rejected).
+		Str("progress", strconv.FormatFloat(percent, 'f', 1, 64)+"%")
+}
@@ -12,7 +12,7 @@ func createMigrateCMD() *cobra.Command {
 		Use:   "migrate",
 		Short: "Run database migrations",
 		Run: func(cmd *cobra.Command, args []string) {
-			cfg, err := config.New()
+			cfg, err := config.Load(cmd.Flags())
 			if err != nil {
 				log.Fatal().Err(err).Msg("failed to get config")
 			}
@@ -21,6 +21,7 @@ func createMigrateCMD() *cobra.Command {
 			if err != nil {
 				log.Fatal().Err(err).Msg("failed to connect to database")
 			}
+			defer db.Close()
 
 			if err := db.RunMigrations(); err != nil {
 				log.Fatal().Err(err).Msg("failed to run database migrations")
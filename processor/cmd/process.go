@@ -2,10 +2,20 @@ package cmd
 
 import (
 	"context"
+	"expvar"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/EWK20/event-processor/processor/internal/config"
-	"github.com/EWK20/event-processor/processor/internal/db"
+	"github.com/EWK20/event-processor/processor/internal/enrich"
+	"github.com/EWK20/event-processor/processor/internal/metrics"
 	"github.com/EWK20/event-processor/processor/internal/processor"
+	"github.com/EWK20/event-processor/processor/internal/redact"
+	"github.com/EWK20/event-processor/processor/internal/rules"
+	"github.com/EWK20/event-processor/processor/internal/schema"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -15,22 +25,90 @@ func createProcessCMD() *cobra.Command {
 		Use:   "process",
 		Short: "Process events",
 		Run: func(cmd *cobra.Command, args []string) {
-			cfg, err := config.New()
+			cfg, err := config.Load(cmd.Flags(), config.WithSQS())
 			if err != nil {
 				log.Fatal().Err(err).Msg("failed to get config")
 			}
 
-			db, err := db.New(cfg.DB)
+			db, err := openDatabase(cfg)
 			if err != nil {
 				log.Fatal().Err(err).Msg("failed to connect to database")
 			}
+			defer db.Close()
 
-			processor, err := processor.New(cfg.AWS, db)
+			rules, err := rules.New(cfg.Rules)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to load rules")
+			}
+
+			enrichment, err := enrich.New(cfg.Enrichment.Stages, db)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to build enrichment pipeline")
+			}
+
+			redactor, err := loadRedactor(cfg)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to load redaction rules")
+			}
+
+			metrics := metrics.New()
+			metrics.Publish("processor")
+
+			if cfg.Processor.MetricsAddr != "" {
+				go serveMetrics(cfg.Processor.MetricsAddr)
+			}
+
+			processor, err := processor.New(cfg.AWS, db,
+				processor.WithConcurrency(cfg.Processor.Concurrency),
+				processor.WithVisibility(cfg.Processor.VisibilityTimeout, cfg.Processor.HeartbeatInterval),
+				processor.WithEnrichment(enrichment),
+				processor.WithRules(rules),
+				processor.WithRedaction(redactor),
+				processor.WithMetrics(metrics),
+				processor.WithMiddleware(
+					processor.Tracing(),
+					processor.Logging(),
+					processor.Metrics(metrics),
+					processor.Decode(),
+					processor.Timeout(cfg.Processor.HandlerTimeout),
+					processor.Upcast(schema.Default()),
+					processor.Validate(),
+					processor.KnownEventTypes(cfg.Processor.EventTypes...),
+					processor.Dedup(cfg.Processor.DedupWindow),
+				),
+			)
 			if err != nil {
 				log.Fatal().Err(err).Msg("failed to instantiate events processor")
 			}
 
-			processor.Run(context.Background())
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			processor.Run(ctx)
 		},
 	}
 }
+
+// loadRedactor returns nil when no redaction rules are configured.
+func loadRedactor(cfg *config.Config) (*redact.Redactor, error) {
+	if len(cfg.Redaction.Rules) == 0 {
+		return nil, nil
+	}
+
+	return redact.New(cfg.Redaction)
+}
+
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	if err := server.ListenAndServe(); err != nil {
+		log.Error().Err(err).Msg("metrics server stopped")
+	}
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/EWK20/event-processor/processor/internal/replay"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func createReplayCMD() *cobra.Command {
+	replayCMD := &cobra.Command{
+		Use:   "replay",
+		Short: "Republish stored events to a queue",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(cmd.Flags(), config.WithSQS())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to get config")
+			}
+
+			filter, err := filterFromFlags(cmd)
+			if err != nil {
+				log.Fatal().Err(err).Msg("invalid filter")
+			}
+
+			queue, _ := cmd.Flags().GetString("queue")
+			rate, _ := cmd.Flags().GetFloat64("rate")
+			batchSize, _ := cmd.Flags().GetInt("batch-size")
+			checkpoint, _ := cmd.Flags().GetString("checkpoint")
+			dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+			db, err := openDatabase(cfg, tenantFromFlags(cmd))
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to connect to database")
+			}
+			defer db.Close()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			sqsClient, err := cfg.AWS.SQSClient(ctx)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to create SQS client")
+			}
+
+			queueURL, err := sqsClient.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{
+				QueueName: &queue,
+			})
+			if err != nil {
+				log.Fatal().Err(err).Str("queue", queue).Msg("failed to get queue URL")
+			}
+
+			replayer := replay.New(db, sqsClient, *queueURL.QueueUrl,
+				replay.WithFilter(filter),
+				replay.WithRate(rate),
+				replay.WithBatchSize(batchSize),
+				replay.WithCheckpoint(checkpoint),
+				replay.WithDryRun(dryRun),
+			)
+
+			result, err := replayer.Run(ctx)
+			if err != nil {
+				log.Fatal().Err(err).Int64("replayed", result.Events).Int64("last_id", result.LastID).Msg("replay stopped")
+			}
+
+			if dryRun {
+				log.Info().Int64("events", result.Events).Str("queue", queue).Msg("dry run, events that would be replayed")
+
+				return
+			}
+
+			log.Info().Int64("replayed", result.Events).Int64("last_id", result.LastID).Str("queue", queue).Msg("replay finished")
+		},
+	}
+
+	bindFilterFlags(replayCMD)
+
+	replayCMD.Flags().String("queue", "", "name of the SQS queue to replay events to")
+	replayCMD.Flags().Float64("rate", 0, "maximum events replayed per second, 0 is unlimited")
+	replayCMD.Flags().Int("batch-size", replay.MaxBatchSize, "events sent per SendMessageBatch call, at most 10")
+	replayCMD.Flags().String("checkpoint", "", "file recording progress, an interrupted replay resumes from it")
+	replayCMD.Flags().Bool("dry-run", false, "only count the events that would be replayed")
+
+	_ = replayCMD.MarkFlagRequired("queue")
+
+	return replayCMD
+}
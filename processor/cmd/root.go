@@ -3,6 +3,7 @@ package cmd
 import (
 	"errors"
 
+	"github.com/EWK20/event-processor/processor/internal/config"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 )
@@ -16,6 +17,14 @@ func Execute() {
 
 	rootCMD.AddCommand(createMigrateCMD())
 	rootCMD.AddCommand(createProcessCMD())
+	rootCMD.AddCommand(createConfigCMD())
+	rootCMD.AddCommand(createReplayCMD())
+	rootCMD.AddCommand(createExportCMD())
+	rootCMD.AddCommand(createImportCMD())
+	rootCMD.AddCommand(createArchiveCMD())
+	rootCMD.AddCommand(createRestoreCMD())
+	rootCMD.AddCommand(createFakeSQSCMD())
+	rootCMD.AddCommand(createRotateKeysCMD())
 
 	if err := rootCMD.Execute(); err != nil {
 		log.Fatal().Err(err).Msg("failed to execute root command")
@@ -23,7 +32,7 @@ func Execute() {
 }
 
 func createRootCMD() *cobra.Command {
-	return &cobra.Command{
+	rootCMD := &cobra.Command{
 		Use: "processor",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cmd.HelpFunc()(cmd, args)
@@ -31,4 +40,8 @@ func createRootCMD() *cobra.Command {
 			return ErrNonFuncCMD
 		},
 	}
+
+	config.BindFlags(rootCMD.PersistentFlags())
+
+	return rootCMD
 }
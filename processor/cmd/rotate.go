@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/EWK20/event-processor/processor/internal/db"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func createRotateKeysCMD() *cobra.Command {
+	rotateKeysCMD := &cobra.Command{
+		Use:   "rotate-keys",
+		Short: "Re-encrypt encrypted payload fields and vault values with the current key",
+		Long:  "Re-encrypt, in batches, the events and PII vault values whose data key isn't encrypted with the keyfile's current key, and encrypt the configured fields of events saved before they were encrypted. An interrupted rotation continues where it stopped when run again.",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(cmd.Flags())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to get config")
+			}
+
+			if cfg.Encryption.Keyfile == "" {
+				log.Fatal().Msg("encryption.keyfile is required to rotate keys")
+			}
+
+			batchSize, _ := cmd.Flags().GetInt("batch-size")
+
+			db, err := openDatabase(cfg, db.WithAllTenants())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to connect to database")
+			}
+			defer db.Close()
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			var afterID, rotated int64
+
+			for {
+				batch, lastID, err := db.RotateBatch(ctx, afterID, batchSize)
+				if err != nil {
+					log.Fatal().Err(err).Int64("rotated", rotated).Int64("last_id", afterID).Msg("rotation stopped")
+				}
+
+				if lastID == afterID {
+					break
+				}
+
+				rotated += batch
+				afterID = lastID
+
+				log.Info().Int64("rotated", rotated).Int64("last_id", afterID).Msg("rotated batch")
+			}
+
+			var (
+				afterToken   string
+				vaultRotated int64
+			)
+
+			for {
+				batch, lastToken, err := db.RotateVaultBatch(ctx, afterToken, batchSize)
+				if err != nil {
+					log.Fatal().Err(err).Int64("vault_rotated", vaultRotated).Str("last_token", afterToken).Msg("vault rotation stopped")
+				}
+
+				if lastToken == afterToken {
+					break
+				}
+
+				vaultRotated += batch
+				afterToken = lastToken
+
+				log.Info().Int64("vault_rotated", vaultRotated).Str("last_token", afterToken).Msg("rotated vault batch")
+			}
+
+			log.Info().Int64("rotated", rotated).Int64("vault_rotated", vaultRotated).Msg("rotation finished")
+		},
+	}
+
+	rotateKeysCMD.Flags().Int("batch-size", 500, "events or vault values re-encrypted per transaction")
+
+	return rotateKeysCMD
+}
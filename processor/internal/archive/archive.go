@@ -0,0 +1,323 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/db"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrArchiveExists     = errors.New("archive already exists")
+	ErrFailedToArchive   = errors.New("failed to archive events")
+	ErrFailedToRestore   = errors.New("failed to restore events")
+	ErrChecksumMismatch  = errors.New("archive file checksum mismatch")
+	ErrFailedToReadFile  = errors.New("failed to read archive file")
+	ErrIncompleteArchive = errors.New("archive has no manifest")
+)
+
+const (
+	// ManifestKey is written last, an archive without one is incomplete.
+	ManifestKey = "manifest.json"
+
+	defaultBatchSize = 1000
+	day              = 24 * time.Hour
+)
+
+type Source interface {
+	EventPartitions(ctx context.Context, filter db.Filter) ([]db.Partition, error)
+	Events(ctx context.Context, filter db.Filter, afterID int64, limit int) ([]models.Event, error)
+	DeleteEvents(ctx context.Context, filter db.Filter, maxID int64) (int64, error)
+}
+
+type Target interface {
+	RestoreBatch(ctx context.Context, events []models.Event) (int64, error)
+}
+
+// Manifest describes an archive and every file in it.
+type Manifest struct {
+	CreatedAt time.Time `json:"created_at"`
+	ClientID  string    `json:"client_id,omitempty"`
+	EventType string    `json:"event_type,omitempty"`
+	From      time.Time `json:"from,omitzero"`
+	To        time.Time `json:"to,omitzero"`
+	Events    int64     `json:"events"`
+	Files     []File    `json:"files"`
+}
+
+// File holds the events of a client on a UTC day as gzipped NDJSON.
+type File struct {
+	Key      string `json:"key"`
+	Date     string `json:"date"`
+	ClientID string `json:"client_id"`
+	Events   int64  `json:"events"`
+	Size     int64  `json:"size"`
+	SHA256   string `json:"sha256"`
+	FirstID  int64  `json:"first_id"`
+	LastID   int64  `json:"last_id"`
+}
+
+// Archiver writes events to date and client partitioned files.
+type Archiver struct {
+	source    Source
+	storage   Storage
+	delete    bool
+	batchSize int
+}
+
+func New(source Source, storage Storage, opts ...Option) *Archiver {
+	archiver := &Archiver{
+		source:    source,
+		storage:   storage,
+		batchSize: defaultBatchSize,
+	}
+
+	for _, opt := range opts {
+		opt(archiver)
+	}
+
+	return archiver
+}
+
+// Archive writes the events matching filter, then the manifest. When
+// deleting, the archived events are only deleted once every file has been
+// read back and its checksum verified.
+func (a *Archiver) Archive(ctx context.Context, filter db.Filter) (Manifest, error) {
+	manifest := Manifest{
+		CreatedAt: time.Now().UTC(),
+		ClientID:  filter.ClientID,
+		EventType: filter.EventType,
+		From:      filter.From.UTC(),
+		To:        filter.To.UTC(),
+	}
+
+	exists, err := a.storage.Exists(ctx, ManifestKey)
+	if err != nil {
+		return manifest, fmt.Errorf("%w: %w", ErrFailedToArchive, err)
+	}
+
+	if exists {
+		return manifest, ErrArchiveExists
+	}
+
+	partitions, err := a.source.EventPartitions(ctx, filter)
+	if err != nil {
+		return manifest, fmt.Errorf("%w: %w", ErrFailedToArchive, err)
+	}
+
+	for _, partition := range partitions {
+		file, err := a.archivePartition(ctx, partitionFilter(filter, partition.Date, partition.ClientID), partition)
+		if err != nil {
+			return manifest, fmt.Errorf("%w: %w", ErrFailedToArchive, err)
+		}
+
+		if file.Events == 0 {
+			continue
+		}
+
+		manifest.Files = append(manifest.Files, file)
+		manifest.Events += file.Events
+
+		log.Debug().Str("key", file.Key).Int64("events", file.Events).Msg("archived partition")
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return manifest, fmt.Errorf("%w: %w", ErrFailedToArchive, err)
+	}
+
+	if err := a.storage.Put(ctx, ManifestKey, bytes.NewReader(data)); err != nil {
+		return manifest, fmt.Errorf("%w: %w", ErrFailedToArchive, err)
+	}
+
+	if a.delete {
+		if err := a.deleteArchived(ctx, filter, manifest); err != nil {
+			return manifest, err
+		}
+	}
+
+	return manifest, nil
+}
+
+func (a *Archiver) archivePartition(ctx context.Context, filter db.Filter, partition db.Partition) (File, error) {
+	file := File{
+		Key:      fmt.Sprintf("date=%s/client_id=%s/events.ndjson.gz", partition.Date.Format(time.DateOnly), url.PathEscape(partition.ClientID)),
+		Date:     partition.Date.Format(time.DateOnly),
+		ClientID: partition.ClientID,
+	}
+
+	// Staged in a temporary file so it can be checksummed before upload
+	tmp, err := os.CreateTemp("", "archive-*.ndjson.gz")
+	if err != nil {
+		return file, err
+	}
+	defer cleanup(tmp)
+
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(tmp, hash)}
+	compressor := gzip.NewWriter(counter)
+	encoder := json.NewEncoder(compressor)
+
+	var afterID int64
+
+	for {
+		events, err := a.source.Events(ctx, filter, afterID, a.batchSize)
+		if err != nil {
+			return file, err
+		}
+
+		if len(events) == 0 {
+			break
+		}
+
+		for _, event := range events {
+			if err := encoder.Encode(event); err != nil {
+				return file, err
+			}
+		}
+
+		if file.FirstID == 0 {
+			file.FirstID = events[0].ID
+		}
+
+		afterID = events[len(events)-1].ID
+		file.LastID = afterID
+		file.Events += int64(len(events))
+	}
+
+	if file.Events == 0 {
+		return file, nil
+	}
+
+	if err := compressor.Close(); err != nil {
+		return file, err
+	}
+
+	file.Size = counter.n
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return file, err
+	}
+
+	if err := a.storage.Put(ctx, file.Key, tmp); err != nil {
+		return file, fmt.Errorf("%s: %w", file.Key, err)
+	}
+
+	return file, nil
+}
+
+func (a *Archiver) deleteArchived(ctx context.Context, filter db.Filter, manifest Manifest) error {
+	for _, file := range manifest.Files {
+		tmp, err := fetch(ctx, a.storage, file)
+		if err != nil {
+			return fmt.Errorf("%w: not deleting archived events: %w", ErrFailedToArchive, err)
+		}
+
+		cleanup(tmp)
+	}
+
+	for _, file := range manifest.Files {
+		date, err := time.Parse(time.DateOnly, file.Date)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrFailedToArchive, file.Key, err)
+		}
+
+		deleted, err := a.source.DeleteEvents(ctx, partitionFilter(filter, date, file.ClientID), file.LastID)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrFailedToArchive, file.Key, err)
+		}
+
+		if deleted != file.Events {
+			log.Warn().Str("key", file.Key).Int64("archived", file.Events).Int64("deleted", deleted).Msg("deleted a different number of events than archived")
+		}
+	}
+
+	return nil
+}
+
+// partitionFilter narrows filter to the events of a client on a day.
+func partitionFilter(filter db.Filter, date time.Time, clientID string) db.Filter {
+	partition := db.Filter{
+		ClientID:  clientID,
+		EventType: filter.EventType,
+		From:      date,
+		To:        date.Add(day),
+	}
+
+	if filter.From.After(partition.From) {
+		partition.From = filter.From
+	}
+
+	if !filter.To.IsZero() && filter.To.Before(partition.To) {
+		partition.To = filter.To
+	}
+
+	return partition
+}
+
+// fetch downloads an archive file to a temporary file, checking it against
+// its checksum. The caller closes and removes the file.
+func fetch(ctx context.Context, storage Storage, file File) (*os.File, error) {
+	body, err := storage.Get(ctx, file.Key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrFailedToReadFile, file.Key, err)
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp("", "archive-*.ndjson.gz")
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), body); err != nil {
+		cleanup(tmp)
+
+		return nil, fmt.Errorf("%w: %s: %w", ErrFailedToReadFile, file.Key, err)
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != file.SHA256 {
+		cleanup(tmp)
+
+		return nil, fmt.Errorf("%w: %s: expected %s, got %s", ErrChecksumMismatch, file.Key, file.SHA256, sum)
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		cleanup(tmp)
+
+		return nil, err
+	}
+
+	return tmp, nil
+}
+
+func cleanup(f *os.File) {
+	f.Close()
+	os.Remove(f.Name())
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
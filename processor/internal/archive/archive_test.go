@@ -0,0 +1,345 @@
+package archive_test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/archive"
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/EWK20/event-processor/processor/internal/db"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDB keeps events in memory, applying filters as the database does.
+type fakeDB struct {
+	events []models.Event
+}
+
+func matches(event models.Event, filter db.Filter) bool {
+	switch {
+	case filter.ClientID != "" && event.ClientID != filter.ClientID:
+		return false
+	case filter.EventType != "" && event.EventType != filter.EventType:
+		return false
+	case !filter.From.IsZero() && event.Timestamp.Before(filter.From):
+		return false
+	case !filter.To.IsZero() && !event.Timestamp.Before(filter.To):
+		return false
+	}
+
+	return true
+}
+
+func (d *fakeDB) EventPartitions(_ context.Context, filter db.Filter) ([]db.Partition, error) {
+	var partitions []db.Partition
+
+	for _, event := range d.events {
+		partition := db.Partition{Date: event.Timestamp.Truncate(24 * time.Hour), ClientID: event.ClientID}
+
+		if matches(event, filter) && !slices.Contains(partitions, partition) {
+			partitions = append(partitions, partition)
+		}
+	}
+
+	return partitions, nil
+}
+
+func (d *fakeDB) Events(_ context.Context, filter db.Filter, afterID int64, limit int) ([]models.Event, error) {
+	var events []models.Event
+
+	for _, event := range d.events {
+		if event.ID > afterID && matches(event, filter) && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func (d *fakeDB) DeleteEvents(_ context.Context, filter db.Filter, maxID int64) (int64, error) {
+	var (
+		kept    []models.Event
+		deleted int64
+	)
+
+	for _, event := range d.events {
+		if event.ID <= maxID && matches(event, filter) {
+			deleted++
+
+			continue
+		}
+
+		kept = append(kept, event)
+	}
+
+	d.events = kept
+
+	return deleted, nil
+}
+
+func (d *fakeDB) RestoreBatch(_ context.Context, events []models.Event) (int64, error) {
+	var inserted int64
+
+	for _, event := range events {
+		if slices.ContainsFunc(d.events, func(e models.Event) bool { return e.ID == event.ID }) {
+			continue
+		}
+
+		d.events = append(d.events, event)
+		inserted++
+	}
+
+	slices.SortFunc(d.events, func(a, b models.Event) int { return int(a.ID - b.ID) })
+
+	return inserted, nil
+}
+
+func (d *fakeDB) ids() []int64 {
+	var ids []int64
+
+	for _, event := range d.events {
+		ids = append(ids, event.ID)
+	}
+
+	return ids
+}
+
+var day = time.Date(2025, 8, 18, 0, 0, 0, 0, time.UTC)
+
+func newDB() *fakeDB {
+	event := func(id int64, clientID string, timestamp time.Time) models.Event {
+		return models.Event{
+			ID:            id,
+			EventType:     "transaction_approved",
+			ClientID:      clientID,
+			Payload:       map[string]any{"amount": "10.00", "currency": "GBP"},
+			Timestamp:     timestamp,
+			SchemaVersion: 1,
+		}
+	}
+
+	return &fakeDB{events: []models.Event{
+		event(1, "client_123", day.Add(time.Hour)),
+		event(2, "client_456", day.Add(2*time.Hour)),
+		event(3, "client_123", day.Add(3*time.Hour)),
+		event(4, "client/789", day.Add(25*time.Hour)),
+		event(5, "client_123", day.Add(49*time.Hour)),
+	}}
+}
+
+func TestArchive(t *testing.T) {
+	database := newDB()
+	storage := &archive.FileStorage{Root: t.TempDir()}
+
+	manifest, err := archive.New(database, storage, archive.WithDelete(true), archive.WithBatchSize(1)).
+		Archive(t.Context(), db.Filter{To: day.Add(48 * time.Hour)})
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(4), manifest.Events)
+	require.Len(t, manifest.Files, 3)
+	assert.Equal(t, "date=2025-08-18/client_id=client_123/events.ndjson.gz", manifest.Files[0].Key)
+	assert.Equal(t, int64(2), manifest.Files[0].Events)
+	assert.Equal(t, int64(1), manifest.Files[0].FirstID)
+	assert.Equal(t, int64(3), manifest.Files[0].LastID)
+	assert.Equal(t, "date=2025-08-19/client_id=client%2F789/events.ndjson.gz", manifest.Files[2].Key)
+
+	// Archived events are deleted, later ones kept
+	assert.Equal(t, []int64{5}, database.ids())
+
+	saved, err := archive.ReadManifest(t.Context(), storage)
+	require.NoError(t, err)
+	assert.Equal(t, manifest.Files, saved.Files)
+
+	var ids []int64
+
+	for _, event := range readFile(t, filepath.Join(storage.Root, manifest.Files[0].Key)) {
+		ids = append(ids, event.ID)
+	}
+
+	assert.Equal(t, []int64{1, 3}, ids)
+
+	info, err := os.Stat(filepath.Join(storage.Root, manifest.Files[0].Key))
+	require.NoError(t, err)
+	assert.Equal(t, manifest.Files[0].Size, info.Size())
+
+	// An archive is never overwritten
+	_, err = archive.New(database, storage).Archive(t.Context(), db.Filter{})
+	require.ErrorIs(t, err, archive.ErrArchiveExists)
+}
+
+func TestRestore(t *testing.T) {
+	database := newDB()
+	storage := &archive.FileStorage{Root: t.TempDir()}
+
+	_, err := archive.New(database, storage, archive.WithDelete(true)).Archive(t.Context(), db.Filter{})
+	require.NoError(t, err)
+	require.Empty(t, database.ids())
+
+	restorer := archive.NewRestorer(database, storage)
+
+	result, err := restorer.Restore(t.Context(), db.Filter{ClientID: "client_123", To: day.Add(24 * time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, archive.RestoreResult{Files: 1, Events: 2, Restored: 2}, result)
+	assert.Equal(t, []int64{1, 3}, database.ids())
+
+	// Restoring again skips events already in the table
+	result, err = restorer.Restore(t.Context(), db.Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, archive.RestoreResult{Files: 4, Events: 5, Restored: 3, Skipped: 2}, result)
+	assert.Equal(t, newDB().events, database.events)
+}
+
+// corruptStorage flips a byte of every archive file it returns.
+type corruptStorage struct {
+	*archive.FileStorage
+}
+
+func (s corruptStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	body, err := s.FileStorage.Get(ctx, key)
+	if err != nil || key == archive.ManifestKey {
+		return body, err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	data[len(data)/2] ^= 0xff
+
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	database := newDB()
+	storage := corruptStorage{&archive.FileStorage{Root: t.TempDir()}}
+
+	_, err := archive.New(database, storage, archive.WithDelete(true)).Archive(t.Context(), db.Filter{})
+	require.ErrorIs(t, err, archive.ErrChecksumMismatch)
+
+	// Nothing is deleted unless every file is verified
+	assert.Len(t, database.events, 5)
+
+	database.events = nil
+
+	_, err = archive.NewRestorer(database, storage).Restore(t.Context(), db.Filter{})
+	require.ErrorIs(t, err, archive.ErrChecksumMismatch)
+	assert.Empty(t, database.events)
+}
+
+func TestRestoreIncompleteArchive(t *testing.T) {
+	_, err := archive.NewRestorer(&fakeDB{}, &archive.FileStorage{Root: t.TempDir()}).Restore(t.Context(), db.Filter{})
+	require.ErrorIs(t, err, archive.ErrIncompleteArchive)
+}
+
+type fakeS3 struct {
+	objects map[string][]byte
+}
+
+func (s *fakeS3) PutObject(_ context.Context, input *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	s.objects[aws.ToString(input.Bucket)+"/"+aws.ToString(input.Key)] = data
+
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (s *fakeS3) GetObject(_ context.Context, input *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	data, ok := s.objects[aws.ToString(input.Bucket)+"/"+aws.ToString(input.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (s *fakeS3) HeadObject(_ context.Context, input *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if _, ok := s.objects[aws.ToString(input.Bucket)+"/"+aws.ToString(input.Key)]; !ok {
+		return nil, &types.NotFound{}
+	}
+
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func TestS3Storage(t *testing.T) {
+	client := &fakeS3{objects: make(map[string][]byte)}
+	storage := &archive.S3Storage{Client: client, Bucket: "events-archive", Prefix: "2025/08"}
+	database := newDB()
+
+	manifest, err := archive.New(database, storage).Archive(t.Context(), db.Filter{})
+	require.NoError(t, err)
+
+	assert.Contains(t, client.objects, "events-archive/2025/08/manifest.json")
+	assert.Contains(t, client.objects, "events-archive/2025/08/"+manifest.Files[0].Key)
+
+	database.events = nil
+
+	result, err := archive.NewRestorer(database, storage).Restore(t.Context(), db.Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), result.Restored)
+
+	_, err = archive.NewRestorer(database, &archive.S3Storage{Client: client, Bucket: "other"}).Restore(t.Context(), db.Filter{})
+	require.ErrorIs(t, err, archive.ErrIncompleteArchive)
+}
+
+func TestNewStorage(t *testing.T) {
+	storage, err := archive.NewStorage(t.Context(), "/var/archive/events", config.AWS{})
+	require.NoError(t, err)
+	assert.Equal(t, &archive.FileStorage{Root: "/var/archive/events"}, storage)
+
+	storage, err = archive.NewStorage(t.Context(), "file:///var/archive/events", config.AWS{})
+	require.NoError(t, err)
+	assert.Equal(t, &archive.FileStorage{Root: "/var/archive/events"}, storage)
+
+	storage, err = archive.NewStorage(t.Context(), "s3://events-archive/2025/08/", config.AWS{AWSRegion: "eu-west-2", S3Endpoint: "http://localhost:4566"})
+	require.NoError(t, err)
+	require.IsType(t, &archive.S3Storage{}, storage)
+	assert.Equal(t, "events-archive", storage.(*archive.S3Storage).Bucket)
+	assert.Equal(t, "2025/08", storage.(*archive.S3Storage).Prefix)
+
+	_, err = archive.NewStorage(t.Context(), "ftp://archive/events", config.AWS{})
+	require.ErrorIs(t, err, archive.ErrUnsupportedStorage)
+}
+
+func readFile(t *testing.T, name string) []models.Event {
+	t.Helper()
+
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	r, err := gzip.NewReader(f)
+	require.NoError(t, err)
+
+	var events []models.Event
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var event models.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+
+		events = append(events, event)
+	}
+
+	require.NoError(t, scanner.Err())
+
+	return events
+}
@@ -0,0 +1,18 @@
+package archive
+
+type Option func(*Archiver)
+
+// WithDelete deletes the archived events once the archive is written and
+// verified.
+func WithDelete(enabled bool) Option {
+	return func(a *Archiver) {
+		a.delete = enabled
+	}
+}
+
+// WithBatchSize sets how many events are read from the database at a time.
+func WithBatchSize(size int) Option {
+	return func(a *Archiver) {
+		a.batchSize = max(size, 1)
+	}
+}
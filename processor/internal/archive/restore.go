@@ -0,0 +1,189 @@
+package archive
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/db"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/rs/zerolog/log"
+)
+
+// RestoreResult counts the restored events, events already in the table are
+// skipped so an archive can be restored more than once.
+type RestoreResult struct {
+	Files    int
+	Events   int64
+	Restored int64
+	Skipped  int64
+}
+
+// Restorer loads archived events back into the events table.
+type Restorer struct {
+	target    Target
+	storage   Storage
+	batchSize int
+}
+
+func NewRestorer(target Target, storage Storage) *Restorer {
+	return &Restorer{
+		target:    target,
+		storage:   storage,
+		batchSize: defaultBatchSize,
+	}
+}
+
+// Restore restores the archived events matching filter with their original
+// IDs. Every file is checked against the manifest checksum before any of its
+// events are restored.
+func (r *Restorer) Restore(ctx context.Context, filter db.Filter) (RestoreResult, error) {
+	var result RestoreResult
+
+	manifest, err := ReadManifest(ctx, r.storage)
+	if err != nil {
+		return result, err
+	}
+
+	for _, file := range manifest.Files {
+		if !fileMatches(file, filter) {
+			continue
+		}
+
+		events, restored, err := r.restoreFile(ctx, file, filter)
+		if err != nil {
+			return result, fmt.Errorf("%w: %w", ErrFailedToRestore, err)
+		}
+
+		result.Files++
+		result.Events += events
+		result.Restored += restored
+		result.Skipped += events - restored
+
+		log.Debug().Str("key", file.Key).Int64("restored", restored).Msg("restored archive file")
+	}
+
+	return result, nil
+}
+
+// ReadManifest reads the manifest of the archive in storage.
+func ReadManifest(ctx context.Context, storage Storage) (Manifest, error) {
+	var manifest Manifest
+
+	body, err := storage.Get(ctx, ManifestKey)
+	if errors.Is(err, ErrNotFound) {
+		return manifest, ErrIncompleteArchive
+	}
+
+	if err != nil {
+		return manifest, fmt.Errorf("%w: %w", ErrFailedToReadFile, err)
+	}
+	defer body.Close()
+
+	if err := json.NewDecoder(body).Decode(&manifest); err != nil {
+		return manifest, fmt.Errorf("%w: %s: %w", ErrFailedToReadFile, ManifestKey, err)
+	}
+
+	return manifest, nil
+}
+
+func (r *Restorer) restoreFile(ctx context.Context, file File, filter db.Filter) (int64, int64, error) {
+	// Downloaded first so the checksum is verified before restoring anything
+	tmp, err := fetch(ctx, r.storage, file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cleanup(tmp)
+
+	decompressor, err := gzip.NewReader(tmp)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%w: %s: %w", ErrFailedToReadFile, file.Key, err)
+	}
+
+	var (
+		decoder  = json.NewDecoder(decompressor)
+		batch    []models.Event
+		events   int64
+		restored int64
+	)
+
+	save := func() error {
+		inserted, err := r.target.RestoreBatch(ctx, batch)
+		if err != nil {
+			return err
+		}
+
+		restored += inserted
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for {
+		var event models.Event
+
+		err := decoder.Decode(&event)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return events, restored, fmt.Errorf("%w: %s: %w", ErrFailedToReadFile, file.Key, err)
+		}
+
+		if !eventMatches(event, filter) {
+			continue
+		}
+
+		batch = append(batch, event)
+		events++
+
+		if len(batch) == r.batchSize {
+			if err := save(); err != nil {
+				return events, restored, err
+			}
+		}
+	}
+
+	if err := save(); err != nil {
+		return events, restored, err
+	}
+
+	return events, restored, nil
+}
+
+func fileMatches(file File, filter db.Filter) bool {
+	if filter.ClientID != "" && file.ClientID != filter.ClientID {
+		return false
+	}
+
+	date, err := time.Parse(time.DateOnly, file.Date)
+	if err != nil {
+		return true
+	}
+
+	if !filter.From.IsZero() && !date.Add(day).After(filter.From) {
+		return false
+	}
+
+	return filter.To.IsZero() || date.Before(filter.To)
+}
+
+func eventMatches(event models.Event, filter db.Filter) bool {
+	switch {
+	case filter.ClientID != "" && event.ClientID != filter.ClientID:
+		return false
+	case filter.EventType != "" && event.EventType != filter.EventType:
+		return false
+	case !filter.From.IsZero() && event.Timestamp.Before(filter.From):
+		return false
+	case !filter.To.IsZero() && !event.Timestamp.Before(filter.To):
+		return false
+	}
+
+	return true
+}
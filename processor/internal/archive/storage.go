@@ -0,0 +1,166 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+var (
+	ErrUnsupportedStorage = errors.New("unsupported archive storage")
+	ErrNotFound           = errors.New("archive object not found")
+)
+
+// Storage stores the objects of an archive under keys relative to its root.
+type Storage interface {
+	Put(ctx context.Context, key string, body io.ReadSeeker) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Exists(ctx context.Context, key string) (bool, error)
+}
+
+// NewStorage opens the archive at location, a filesystem path, a file:// URL
+// or an s3://bucket/prefix URL.
+func NewStorage(ctx context.Context, location string, cfg config.AWS) (Storage, error) {
+	u, err := url.Parse(location)
+	if err != nil || u.Scheme == "" {
+		return &FileStorage{Root: location}, nil
+	}
+
+	switch u.Scheme {
+	case "file":
+		return &FileStorage{Root: u.Path}, nil
+	case "s3":
+		client, err := cfg.S3Client(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		return &S3Storage{
+			Client: client,
+			Bucket: u.Host,
+			Prefix: strings.Trim(u.Path, "/"),
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedStorage, location)
+}
+
+// FileStorage keeps archives in a directory.
+type FileStorage struct {
+	Root string
+}
+
+func (s *FileStorage) Put(_ context.Context, key string, body io.ReadSeeker) error {
+	name := filepath.Join(s.Root, filepath.FromSlash(key))
+
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+
+	// Written under a temporary name so a partial object is never visible
+	tmp, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+func (s *FileStorage) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(s.Root, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	return f, err
+}
+
+func (s *FileStorage) Exists(_ context.Context, key string) (bool, error) {
+	_, err := os.Stat(filepath.Join(s.Root, filepath.FromSlash(key)))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+type S3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+// S3Storage keeps archives in an S3 compatible bucket.
+type S3Storage struct {
+	Client S3API
+	Bucket string
+	Prefix string
+}
+
+func (s *S3Storage) key(key string) *string {
+	return aws.String(path.Join(s.Prefix, key))
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, body io.ReadSeeker) error {
+	_, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    s.key(key),
+		Body:   body,
+	})
+
+	return err
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	output, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    s.key(key),
+	})
+
+	var noSuchKey *types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Body, nil
+}
+
+func (s *S3Storage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    s.key(key),
+	})
+
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsConfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// SDKConfig loads the AWS SDK config. Static credentials are only used when
+// set, otherwise the SDK default chain resolves them (env, shared profile,
+// web identity, IAM role).
+func (c AWS) SDKConfig(ctx context.Context) (aws.Config, error) {
+	opts := []func(*awsConfig.LoadOptions) error{
+		awsConfig.WithRegion(c.AWSRegion),
+	}
+
+	if c.AWSAccessKeyID != "" {
+		opts = append(opts, awsConfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(
+				c.AWSAccessKeyID,
+				c.AWSSecretAccessKey,
+				"",
+			),
+		))
+	}
+
+	return awsConfig.LoadDefaultConfig(ctx, opts...)
+}
+
+// SQSClient creates an SQS client, using SQSEndpoint instead of the resolved
+// endpoint when set.
+func (c AWS) SQSClient(ctx context.Context) (*sqs.Client, error) {
+	awsCfg, err := c.SDKConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if c.SQSEndpoint != "" {
+			o.BaseEndpoint = &c.SQSEndpoint
+		}
+	}), nil
+}
+
+// S3Client creates an S3 client. With S3Endpoint set, buckets are addressed
+// by path as S3 compatible stores such as MinIO and LocalStack expect.
+func (c AWS) S3Client(ctx context.Context) (*s3.Client, error) {
+	awsCfg, err := c.SDKConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s3.NewFromConfig(awsCfg, func(o *s3.Options) {
+		if c.S3Endpoint != "" {
+			o.BaseEndpoint = &c.S3Endpoint
+			o.UsePathStyle = true
+		}
+	}), nil
+}
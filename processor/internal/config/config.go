@@ -3,101 +3,239 @@ package config
 import (
 	"errors"
 	"fmt"
-	"os"
+	"slices"
+	"time"
 
 	"github.com/rs/zerolog/log"
+	"github.com/spf13/pflag"
 )
 
 var (
-	ErrMissingCfg = errors.New("required config missing")
+	ErrMissingCfg           = errors.New("required config missing")
+	ErrInvalidCfg           = errors.New("invalid config value")
+	ErrFailedToReadCfg      = errors.New("failed to read config file")
+	ErrUnsupportedCfgFormat = errors.New("unsupported config file format")
 )
 
 type DB struct {
-	User     string
-	Password string
-	Host     string
-	Port     string
-	DBName   string
-	SSLMode  string
+	URL      string `yaml:"url" toml:"url"`
+	User     string `yaml:"user" toml:"user"`
+	Password string `yaml:"password" toml:"password"`
+	Host     string `yaml:"host" toml:"host"`
+	Port     string `yaml:"port" toml:"port"`
+	DBName   string `yaml:"name" toml:"name"`
+	SSLMode  string `yaml:"sslmode" toml:"sslmode"`
+
+	Driver           string        `yaml:"driver" toml:"driver"`
+	MaxOpenConns     int           `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns     int           `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime  time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+	ConnMaxIdleTime  time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time"`
+	StatementTimeout time.Duration `yaml:"statement_timeout" toml:"statement_timeout"`
 }
 
 type AWS struct {
-	SQSQueueName       string
-	SQSDLQName         string
-	SQSEndpoint        string
-	AWSRegion          string
-	AWSAccessKeyID     string
-	AWSSecretAccessKey string
+	SQSQueueName       string `yaml:"sqs_queue_name" toml:"sqs_queue_name"`
+	SQSDLQName         string `yaml:"sqs_dlq_name" toml:"sqs_dlq_name"`
+	SQSEndpoint        string `yaml:"sqs_endpoint" toml:"sqs_endpoint"`
+	S3Endpoint         string `yaml:"s3_endpoint" toml:"s3_endpoint"`
+	AWSRegion          string `yaml:"region" toml:"region"`
+	AWSAccessKeyID     string `yaml:"access_key_id" toml:"access_key_id"`
+	AWSSecretAccessKey string `yaml:"secret_access_key" toml:"secret_access_key"`
 }
 
-type Config struct {
-	DB  DB
-	AWS AWS
+type Processor struct {
+	Concurrency       int           `yaml:"concurrency" toml:"concurrency"`
+	VisibilityTimeout time.Duration `yaml:"visibility_timeout" toml:"visibility_timeout"`
+	HeartbeatInterval time.Duration `yaml:"heartbeat_interval" toml:"heartbeat_interval"`
+	HandlerTimeout    time.Duration `yaml:"handler_timeout" toml:"handler_timeout"`
+	DedupWindow       time.Duration `yaml:"dedup_window" toml:"dedup_window"`
+	MetricsAddr       string        `yaml:"metrics_addr" toml:"metrics_addr"`
+	// EventTypes lists the accepted event types, any type is accepted when
+	// it is empty.
+	EventTypes []string `yaml:"event_types" toml:"event_types"`
 }
 
-func New() (*Config, error) {
-	var cfg Config
-	if err := getDatabaseCfg(&cfg.DB); err != nil {
-		return nil, fmt.Errorf("%w", err)
-	}
-	if err := getAWSCfg(&cfg.AWS); err != nil {
-		return nil, fmt.Errorf("%w", err)
-	}
+type Enrichment struct {
+	Stages []string `yaml:"stages" toml:"stages"`
+}
 
-	return &cfg, nil
+// Encryption encrypts payload fields at rest with the keys in Keyfile. Fields
+// maps event types, or "*" for every type, to the dot separated paths of the
+// fields encrypted.
+type Encryption struct {
+	Keyfile string              `yaml:"keyfile" toml:"keyfile"`
+	Fields  map[string][]string `yaml:"fields" toml:"fields"`
+}
+
+// Redaction masks, hashes or tokenizes payload fields before events are
+// saved. Rules maps event types, or "*" for every type, to the rules applied
+// to their events.
+type Redaction struct {
+	HMACKey string                     `yaml:"hmac_key" toml:"hmac_key"`
+	Rules   map[string][]RedactionRule `yaml:"rules" toml:"rules"`
 }
 
-func getDatabaseCfg(cfg *DB) error {
-	if cfg.User = os.Getenv("DB_USER"); cfg.User == "" {
-		return fmt.Errorf("%w: %s", ErrMissingCfg, "DB_USER")
+// tokenizes reports whether any rule keeps original values in the vault.
+func (r Redaction) tokenizes() bool {
+	for _, rules := range r.Rules {
+		for _, rule := range rules {
+			if rule.Action == "tokenize" {
+				return true
+			}
+		}
 	}
-	if cfg.Password = os.Getenv("DB_PASSWORD"); cfg.Password == "" {
-		return fmt.Errorf("%w: %s", ErrMissingCfg, "DB_PASSWORD")
+
+	return false
+}
+
+// RedactionRule applies Action, one of mask, hash or tokenize, to the dot
+// separated payload path Field. Keep is the number of trailing characters
+// left visible by mask, and Clients limits the rule to these clients.
+type RedactionRule struct {
+	Field   string   `yaml:"field" toml:"field"`
+	Action  string   `yaml:"action" toml:"action"`
+	Keep    int      `yaml:"keep" toml:"keep"`
+	Clients []string `yaml:"clients" toml:"clients"`
+}
+
+// Rule triages events. EventType and ClientID accept glob patterns and every
+// When expression, e.g. `amount > 10000`, must hold for the rule to match.
+type Rule struct {
+	Name      string   `yaml:"name" toml:"name"`
+	EventType string   `yaml:"event_type" toml:"event_type"`
+	ClientID  string   `yaml:"client_id" toml:"client_id"`
+	When      []string `yaml:"when" toml:"when"`
+	Priority  string   `yaml:"priority" toml:"priority"`
+	Category  string   `yaml:"category" toml:"category"`
+	RouteTo   []string `yaml:"route_to" toml:"route_to"`
+	Drop      bool     `yaml:"drop" toml:"drop"`
+}
+
+type Config struct {
+	DB         DB         `yaml:"db" toml:"db"`
+	AWS        AWS        `yaml:"aws" toml:"aws"`
+	Processor  Processor  `yaml:"processor" toml:"processor"`
+	Enrichment Enrichment `yaml:"enrichment" toml:"enrichment"`
+	Encryption Encryption `yaml:"encryption" toml:"encryption"`
+	Redaction  Redaction  `yaml:"redaction" toml:"redaction"`
+	Rules      []Rule     `yaml:"rules" toml:"rules"`
+
+	// sqs is set when the command consumes or sends to SQS.
+	sqs bool
+}
+
+type LoadOption func(*Config)
+
+// WithSQS requires the SQS queues and AWS region, for the commands consuming
+// or sending to SQS.
+func WithSQS() LoadOption {
+	return func(c *Config) {
+		c.sqs = true
 	}
-	if cfg.Host = os.Getenv("DB_HOST"); cfg.Host == "" {
-		return fmt.Errorf("%w: %s", ErrMissingCfg, "DB_HOST")
+}
+
+// New builds the config from environment variables only.
+func New(opts ...LoadOption) (*Config, error) {
+	return Load(nil, opts...)
+}
+
+// Load resolves the config from, in increasing order of precedence, the file
+// passed with --config, environment variables and explicitly set flags.
+// Every problem found is reported in the returned error.
+func Load(flags *pflag.FlagSet, opts ...LoadOption) (*Config, error) {
+	var cfg Config
+
+	for _, opt := range opts {
+		opt(&cfg)
 	}
-	if cfg.Port = os.Getenv("DB_PORT"); cfg.Port == "" {
-		log.Warn().Msg("DB_PORT is not set. Using default")
 
-		cfg.Port = "5432"
+	if path := configPath(flags); path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return nil, err
+		}
 	}
-	if cfg.DBName = os.Getenv("DB_NAME"); cfg.DBName == "" {
-		return fmt.Errorf("%w: %s", ErrMissingCfg, "DB_NAME")
+
+	errs := applyEnv(&cfg)
+	errs = append(errs, applyFlags(flags, &cfg)...)
+
+	applyDefaults(&cfg)
+
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
 	}
-	if cfg.SSLMode = os.Getenv("DB_SSLMODE"); cfg.SSLMode == "" {
-		log.Warn().Msg("DB_SSLMODE is not set. Using default")
 
-		cfg.SSLMode = "disable"
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
 	}
 
-	return nil
+	return &cfg, nil
 }
 
-func getAWSCfg(cfg *AWS) error {
-	if cfg.SQSQueueName = os.Getenv("SQS_QUEUE_NAME"); cfg.SQSQueueName == "" {
-		return fmt.Errorf("%w: %s", ErrMissingCfg, "SQS_QUEUE_NAME")
+func (c *Config) Validate() error {
+	var errs []error
+
+	for _, s := range settings {
+		if s.required != nil && s.required(c) && isZero(s.ptr(c)) {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrMissingCfg, s.name()))
+		}
+
+		if value, ok := s.ptr(c).(*string); ok && len(s.oneOf) > 0 && !slices.Contains(s.oneOf, *value) {
+			errs = append(errs, fmt.Errorf("%w: %s: %q is not one of %v", ErrInvalidCfg, s.name(), *value, s.oneOf))
+		}
 	}
 
-	if cfg.SQSDLQName = os.Getenv("SQS_DLQ_QUEUE_NAME"); cfg.SQSDLQName == "" {
-		return fmt.Errorf("%w: %s", ErrMissingCfg, "SQS_DLQ_QUEUE_NAME")
+	// SQS takes visibility timeouts in whole seconds
+	if c.Processor.VisibilityTimeout < time.Second || c.Processor.VisibilityTimeout%time.Second != 0 {
+		errs = append(errs, fmt.Errorf("%w: processor.visibility_timeout must be a whole number of seconds", ErrInvalidCfg))
 	}
 
-	if cfg.SQSEndpoint = os.Getenv("SQS_ENDPOINT"); cfg.SQSEndpoint == "" {
-		return fmt.Errorf("%w: %s", ErrMissingCfg, "SQS_ENDPOINT")
+	if c.Processor.HeartbeatInterval > 0 && c.Processor.HeartbeatInterval >= c.Processor.VisibilityTimeout {
+		errs = append(errs, fmt.Errorf("%w: processor.heartbeat_interval must be shorter than processor.visibility_timeout", ErrInvalidCfg))
 	}
 
-	if cfg.AWSRegion = os.Getenv("AWS_REGION"); cfg.AWSRegion == "" {
-		return fmt.Errorf("%w: %s", ErrMissingCfg, "AWS_REGION")
+	if len(c.Encryption.Fields) > 0 && c.Encryption.Keyfile == "" {
+		errs = append(errs, fmt.Errorf("%w: encryption.fields need encryption.keyfile", ErrInvalidCfg))
 	}
 
-	if cfg.AWSAccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID"); cfg.AWSAccessKeyID == "" {
-		return fmt.Errorf("%w: %s", ErrMissingCfg, "AWS_ACCESS_KEY_ID")
+	if c.Redaction.tokenizes() && c.Encryption.Keyfile == "" {
+		errs = append(errs, fmt.Errorf("%w: tokenize redaction rules need encryption.keyfile to encrypt the vault", ErrInvalidCfg))
 	}
 
-	if cfg.AWSSecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY"); cfg.AWSSecretAccessKey == "" {
-		return fmt.Errorf("%w: %s", ErrMissingCfg, "AWS_SECRET_ACCESS_KEY")
+	return errors.Join(errs...)
+}
+
+// Masked returns a copy of the config with every secret value hidden so it
+// can be safely printed or logged.
+func (c Config) Masked() Config {
+	for _, s := range settings {
+		if s.secret && !isZero(s.ptr(&c)) {
+			value := maskedValue
+			if s.mask != nil {
+				value = s.mask(*s.ptr(&c).(*string))
+			}
+
+			if err := set(s.ptr(&c), value); err != nil {
+				log.Warn().Err(err).Str("setting", s.key).Msg("failed to mask setting")
+			}
+		}
 	}
 
-	return nil
+	return c
+}
+
+func applyDefaults(cfg *Config) {
+	for _, s := range settings {
+		if s.def == "" || !isZero(s.ptr(cfg)) {
+			continue
+		}
+
+		if s.warnDefault {
+			log.Warn().Msgf("%s is not set. Using default", s.env)
+		}
+
+		if err := set(s.ptr(cfg), s.def); err != nil {
+			log.Warn().Err(err).Str("setting", s.key).Msg("failed to apply default")
+		}
+	}
 }
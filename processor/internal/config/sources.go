@@ -0,0 +1,263 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ConfigFlag  = "config"
+	maskedValue = "******"
+)
+
+type setting struct {
+	key         string
+	env         string
+	flag        string
+	usage       string
+	def         string
+	oneOf       []string
+	required    func(*Config) bool
+	secret      bool
+	warnDefault bool
+	mask        func(string) string
+	ptr         func(*Config) any
+}
+
+func (s setting) name() string {
+	return fmt.Sprintf("%s (%s, --%s)", s.env, s.key, s.flag)
+}
+
+var settings = []setting{
+	{key: "db.url", env: "DATABASE_URL", flag: "database-url", usage: "database connection URL, replaces the individual db settings", secret: true, mask: maskURL, ptr: func(c *Config) any { return &c.DB.URL }},
+	{key: "db.user", env: "DB_USER", flag: "db-user", usage: "database user", required: withoutDatabaseURL, ptr: func(c *Config) any { return &c.DB.User }},
+	{key: "db.password", env: "DB_PASSWORD", flag: "db-password", usage: "database password", required: withoutDatabaseURL, secret: true, ptr: func(c *Config) any { return &c.DB.Password }},
+	{key: "db.host", env: "DB_HOST", flag: "db-host", usage: "database host", required: withoutDatabaseURL, ptr: func(c *Config) any { return &c.DB.Host }},
+	{key: "db.port", env: "DB_PORT", flag: "db-port", usage: "database port", def: "5432", warnDefault: true, ptr: func(c *Config) any { return &c.DB.Port }},
+	{key: "db.name", env: "DB_NAME", flag: "db-name", usage: "database name", required: withoutDatabaseURL, ptr: func(c *Config) any { return &c.DB.DBName }},
+	{key: "db.sslmode", env: "DB_SSLMODE", flag: "db-sslmode", usage: "database SSL mode", def: "disable", warnDefault: true, ptr: func(c *Config) any { return &c.DB.SSLMode }},
+	{key: "db.driver", env: "DB_DRIVER", flag: "db-driver", usage: "database driver, pq (database/sql) or pgx (pgxpool)", def: "pq", oneOf: []string{"pq", "pgx"}, ptr: func(c *Config) any { return &c.DB.Driver }},
+	{key: "db.max_open_conns", env: "DB_MAX_OPEN_CONNS", flag: "db-max-open-conns", usage: "maximum number of open database connections", def: "10", ptr: func(c *Config) any { return &c.DB.MaxOpenConns }},
+	{key: "db.max_idle_conns", env: "DB_MAX_IDLE_CONNS", flag: "db-max-idle-conns", usage: "maximum number of idle database connections, the minimum kept open with pgx", def: "5", ptr: func(c *Config) any { return &c.DB.MaxIdleConns }},
+	{key: "db.conn_max_lifetime", env: "DB_CONN_MAX_LIFETIME", flag: "db-conn-max-lifetime", usage: "maximum time a database connection may be reused", def: "30m", ptr: func(c *Config) any { return &c.DB.ConnMaxLifetime }},
+	{key: "db.conn_max_idle_time", env: "DB_CONN_MAX_IDLE_TIME", flag: "db-conn-max-idle-time", usage: "maximum time a database connection may be idle", def: "5m", ptr: func(c *Config) any { return &c.DB.ConnMaxIdleTime }},
+	{key: "db.statement_timeout", env: "DB_STATEMENT_TIMEOUT", flag: "db-statement-timeout", usage: "timeout applied to every database statement", def: "5s", ptr: func(c *Config) any { return &c.DB.StatementTimeout }},
+	{key: "aws.sqs_queue_name", env: "SQS_QUEUE_NAME", flag: "sqs-queue-name", usage: "SQS queue to consume events from", required: withSQS, ptr: func(c *Config) any { return &c.AWS.SQSQueueName }},
+	{key: "aws.sqs_dlq_name", env: "SQS_DLQ_QUEUE_NAME", flag: "sqs-dlq-name", usage: "SQS dead letter queue for invalid events", required: withSQS, ptr: func(c *Config) any { return &c.AWS.SQSDLQName }},
+	{key: "aws.sqs_endpoint", env: "SQS_ENDPOINT", flag: "sqs-endpoint", usage: "SQS endpoint URL, resolved by the AWS SDK when empty", ptr: func(c *Config) any { return &c.AWS.SQSEndpoint }},
+	{key: "aws.s3_endpoint", env: "S3_ENDPOINT", flag: "s3-endpoint", usage: "S3 compatible endpoint URL for archives, e.g. MinIO, resolved by the AWS SDK when empty", ptr: func(c *Config) any { return &c.AWS.S3Endpoint }},
+	{key: "aws.region", env: "AWS_REGION", flag: "aws-region", usage: "AWS region", required: withSQS, ptr: func(c *Config) any { return &c.AWS.AWSRegion }},
+	{key: "aws.access_key_id", env: "AWS_ACCESS_KEY_ID", flag: "aws-access-key-id", usage: "static AWS access key ID, the default credential chain is used when empty", required: withAWSSecretAccessKey, ptr: func(c *Config) any { return &c.AWS.AWSAccessKeyID }},
+	{key: "aws.secret_access_key", env: "AWS_SECRET_ACCESS_KEY", flag: "aws-secret-access-key", usage: "static AWS secret access key, the default credential chain is used when empty", required: withAWSAccessKeyID, secret: true, ptr: func(c *Config) any { return &c.AWS.AWSSecretAccessKey }},
+	{key: "processor.concurrency", env: "PROCESSOR_CONCURRENCY", flag: "processor-concurrency", usage: "number of messages handled concurrently, messages of the same FIFO group are always handled in order", def: "4", ptr: func(c *Config) any { return &c.Processor.Concurrency }},
+	{key: "processor.visibility_timeout", env: "PROCESSOR_VISIBILITY_TIMEOUT", flag: "processor-visibility-timeout", usage: "visibility timeout of received messages", def: "30s", ptr: func(c *Config) any { return &c.Processor.VisibilityTimeout }},
+	{key: "processor.heartbeat_interval", env: "PROCESSOR_HEARTBEAT_INTERVAL", flag: "processor-heartbeat-interval", usage: "how often the visibility of in-flight messages is extended, 0 disables it", def: "10s", ptr: func(c *Config) any { return &c.Processor.HeartbeatInterval }},
+	{key: "processor.handler_timeout", env: "PROCESSOR_HANDLER_TIMEOUT", flag: "processor-handler-timeout", usage: "maximum time spent handling a single message", def: "1m", ptr: func(c *Config) any { return &c.Processor.HandlerTimeout }},
+	{key: "processor.dedup_window", env: "PROCESSOR_DEDUP_WINDOW", flag: "processor-dedup-window", usage: "how long handled message IDs are remembered to skip redeliveries", def: "5m", ptr: func(c *Config) any { return &c.Processor.DedupWindow }},
+	{key: "processor.metrics_addr", env: "PROCESSOR_METRICS_ADDR", flag: "processor-metrics-addr", usage: "address serving expvar metrics on /debug/vars, disabled when empty", ptr: func(c *Config) any { return &c.Processor.MetricsAddr }},
+	{key: "processor.event_types", env: "PROCESSOR_EVENT_TYPES", flag: "processor-event-types", usage: "comma separated event types accepted, events of other types are sent to the DLQ, any type is accepted when empty", ptr: func(c *Config) any { return &c.Processor.EventTypes }},
+	{key: "enrichment.stages", env: "ENRICHMENT_STAGES", flag: "enrichment-stages", usage: "comma separated, ordered enrichment stages", ptr: func(c *Config) any { return &c.Enrichment.Stages }},
+	{key: "encryption.keyfile", env: "ENCRYPTION_KEYFILE", flag: "encryption-keyfile", usage: "JSON file of the keys encrypting payload fields, needed to read encrypted events", ptr: func(c *Config) any { return &c.Encryption.Keyfile }},
+	{key: "redaction.hmac_key", env: "REDACTION_HMAC_KEY", flag: "redaction-hmac-key", usage: "secret key hashing and tokenizing redacted payload fields", secret: true, ptr: func(c *Config) any { return &c.Redaction.HMACKey }},
+}
+
+func withSQS(c *Config) bool { return c.sqs }
+
+func withoutDatabaseURL(c *Config) bool { return c.DB.URL == "" }
+
+func withAWSAccessKeyID(c *Config) bool { return c.AWS.AWSAccessKeyID != "" }
+
+func withAWSSecretAccessKey(c *Config) bool { return c.AWS.AWSSecretAccessKey != "" }
+
+// BindFlags registers the --config flag and one override flag per setting.
+func BindFlags(flags *pflag.FlagSet) {
+	flags.String(ConfigFlag, "", "path to a YAML or TOML config file")
+
+	var cfg Config
+
+	for _, s := range settings {
+		switch s.ptr(&cfg).(type) {
+		case *int:
+			flags.Int(s.flag, 0, s.usage)
+		case *bool:
+			flags.Bool(s.flag, false, s.usage)
+		case *time.Duration:
+			flags.Duration(s.flag, 0, s.usage)
+		case *[]string:
+			flags.String(s.flag, "", s.usage)
+		default:
+			flags.String(s.flag, "", s.usage)
+		}
+	}
+}
+
+func configPath(flags *pflag.FlagSet) string {
+	if flags == nil || flags.Lookup(ConfigFlag) == nil {
+		return ""
+	}
+
+	return flags.Lookup(ConfigFlag).Value.String()
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToReadCfg, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+
+		if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%w: %s: %w", ErrFailedToReadCfg, path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %w", ErrFailedToReadCfg, path, err)
+		}
+
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("%w: %s: unknown keys %v", ErrFailedToReadCfg, path, undecoded)
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedCfgFormat, path)
+	}
+
+	return nil
+}
+
+func applyEnv(cfg *Config) []error {
+	var errs []error
+
+	for _, s := range settings {
+		value, err := lookupEnv(s.env)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %w", ErrInvalidCfg, s.env, err))
+
+			continue
+		}
+
+		if value == "" {
+			continue
+		}
+
+		if err := set(s.ptr(cfg), value); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %w", ErrInvalidCfg, s.env, err))
+		}
+	}
+
+	return errs
+}
+
+// lookupEnv reads key from the environment, or from the file named by
+// key_FILE so secrets can be mounted instead of passed as plain variables.
+func lookupEnv(key string) (string, error) {
+	value := os.Getenv(key)
+
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return value, nil
+	}
+
+	if value != "" {
+		return "", fmt.Errorf("both %s and %s_FILE are set", key, key)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func applyFlags(flags *pflag.FlagSet, cfg *Config) []error {
+	if flags == nil {
+		return nil
+	}
+
+	var errs []error
+
+	for _, s := range settings {
+		if !flags.Changed(s.flag) {
+			continue
+		}
+
+		if err := set(s.ptr(cfg), flags.Lookup(s.flag).Value.String()); err != nil {
+			errs = append(errs, fmt.Errorf("%w: --%s: %w", ErrInvalidCfg, s.flag, err))
+		}
+	}
+
+	return errs
+}
+
+func set(ptr any, value string) error {
+	switch p := ptr.(type) {
+	case *string:
+		*p = value
+	case *int:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*p = v
+	case *bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*p = v
+	case *time.Duration:
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*p = v
+	case *[]string:
+		var values []string
+
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		*p = values
+	default:
+		return fmt.Errorf("unsupported setting type %T", ptr)
+	}
+
+	return nil
+}
+
+func maskURL(value string) string {
+	u, err := url.Parse(value)
+	if err != nil {
+		return maskedValue
+	}
+
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), maskedValue)
+	}
+
+	return u.String()
+}
+
+func isZero(ptr any) bool {
+	return reflect.ValueOf(ptr).Elem().IsZero()
+}
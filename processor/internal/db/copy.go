@@ -0,0 +1,268 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/encrypt"
+	"github.com/EWK20/event-processor/processor/internal/redact"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/jackc/pgx/v5"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrFailedToCopy = errors.New("failed to copy events")
+)
+
+var eventColumns = []string{
+	"event_type", "client_id", "payload", "timestamp", "priority", "category",
+	"message_id", "received_at", "metadata", "schema_version", "key_id", "data_key",
+}
+
+// SaveBatch bulk inserts events with COPY, through pgxpool when the pgx
+// driver is configured and lib/pq otherwise. Either all events are saved or
+// none are.
+func (db *Database) SaveBatch(ctx context.Context, events []models.Event) (int64, error) {
+	return db.SaveBatchRedacted(ctx, events, redact.Result{})
+}
+
+// SaveBatchRedacted bulk inserts events like SaveBatch, with the vault
+// entries and audit records of their redaction in the same transaction.
+func (db *Database) SaveBatchRedacted(ctx context.Context, events []models.Event, redacted redact.Result) (int64, error) {
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	rows := make([][]any, 0, len(events))
+
+	for _, event := range events {
+		row, err := db.eventRow(ctx, event)
+		if err != nil {
+			return 0, err
+		}
+
+		rows = append(rows, row)
+	}
+
+	vault, err := db.vaultRows(ctx, redacted.Vault)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	// The staged rows get their IDs from the events sequence
+	saved, err := db.copyStaged(ctx, eventColumns, rows, insertStaged, func(ctx context.Context, exec execer) error {
+		return saveRedactions(ctx, exec, vault, redacted.Redactions)
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrFailedToCopy, err)
+	}
+
+	return saved, nil
+}
+
+// RestoreBatch inserts events with their original IDs, skipping those
+// already in the table, and returns how many were inserted.
+func (db *Database) RestoreBatch(ctx context.Context, events []models.Event) (int64, error) {
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	rows := make([][]any, 0, len(events))
+
+	for _, event := range events {
+		row, err := db.eventRow(ctx, event)
+		if err != nil {
+			return 0, err
+		}
+
+		rows = append(rows, append([]any{event.ID}, row...))
+	}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	inserted, err := db.copyStaged(ctx, append([]string{"id"}, eventColumns...), rows, insertStaged+` ON CONFLICT (id) DO NOTHING`, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrFailedToCopy, err)
+	}
+
+	return inserted, nil
+}
+
+// Events are copied into a temporary table first and inserted from it, as
+// COPY can't skip conflicting rows nor write to a table with row level
+// security.
+const (
+	createStagingTable = `CREATE TEMPORARY TABLE staged_events (LIKE events INCLUDING DEFAULTS) ON COMMIT DROP`
+	insertStaged       = `INSERT INTO events SELECT * FROM staged_events`
+)
+
+// copyStaged copies rows into the staging table within a transaction and
+// moves them to events with insert, returning how many were inserted. then,
+// when set, runs more statements in the transaction.
+func (db *Database) copyStaged(ctx context.Context, columns []string, rows [][]any, insert string, then func(ctx context.Context, exec execer) error) (int64, error) {
+	if db.pool != nil {
+		return db.copyStagedPGX(ctx, columns, rows, insert, then)
+	}
+
+	return db.copyStagedPQ(ctx, columns, rows, insert, then)
+}
+
+func (db *Database) copyStagedPGX(ctx context.Context, columns []string, rows [][]any, insert string, then func(ctx context.Context, exec execer) error) (int64, error) {
+	tx, err := db.pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx) // no-op once committed
+
+	if _, err := tx.Exec(ctx, createStagingTable); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"staged_events"}, columns, pgx.CopyFromRows(rows)); err != nil {
+		return 0, err
+	}
+
+	tag, err := tx.Exec(ctx, insert)
+	if err != nil {
+		return 0, err
+	}
+
+	if then != nil {
+		exec := func(ctx context.Context, query string, args ...any) error {
+			_, err := tx.Exec(ctx, query, args...)
+
+			return err
+		}
+
+		if err := then(ctx, exec); err != nil {
+			return 0, err
+		}
+	}
+
+	return tag.RowsAffected(), tx.Commit(ctx)
+}
+
+func (db *Database) copyStagedPQ(ctx context.Context, columns []string, rows [][]any, insert string, then func(ctx context.Context, exec execer) error) (int64, error) {
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // no-op once committed
+
+	if _, err := tx.ExecContext(ctx, createStagingTable); err != nil {
+		return 0, err
+	}
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyIn("staged_events", columns...))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, row := range rows {
+		if _, err := stmt.ExecContext(ctx, row...); err != nil {
+			return 0, err
+		}
+	}
+
+	// An empty exec flushes the buffered rows to the server
+	if _, err := stmt.ExecContext(ctx); err != nil {
+		return 0, err
+	}
+
+	if err := stmt.Close(); err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(ctx, insert)
+	if err != nil {
+		return 0, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if then != nil {
+		if err := then(ctx, sqlExecer(tx)); err != nil {
+			return 0, err
+		}
+	}
+
+	return inserted, tx.Commit()
+}
+
+func (db *Database) eventRow(ctx context.Context, event models.Event) ([]any, error) {
+	var (
+		payload  = event.Payload
+		envelope *encrypt.Envelope
+	)
+
+	if db.encrypter != nil {
+		var err error
+
+		if payload, envelope, err = db.encrypter.Encrypt(ctx, event.EventType, payload); err != nil {
+			return nil, err
+		}
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToMarshalPayload, err)
+	}
+
+	keyID, dataKey := envelopeColumns(envelope)
+
+	var metadataJSON *string
+
+	if len(event.Metadata) > 0 {
+		data, err := json.Marshal(event.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFailedToMarshalPayload, err)
+		}
+
+		metadataJSON = nullString(string(data))
+	}
+
+	var receivedAt *time.Time
+
+	if !event.ReceivedAt.IsZero() {
+		utc := event.ReceivedAt.UTC()
+		receivedAt = &utc
+	}
+
+	// Events saved without going through the upcaster are the initial version
+	schemaVersion := max(event.SchemaVersion, 1)
+
+	return []any{
+		event.EventType, event.ClientID, string(payloadJSON), event.Timestamp.UTC(),
+		nullString(event.Priority), nullString(event.Category),
+		nullString(event.MessageID), receivedAt, metadataJSON, schemaVersion, keyID, dataKey,
+	}, nil
+}
+
+// envelopeColumns are the key_id and data_key of an event. Plain events leave
+// both NULL, a nil []byte would be saved as an empty bytea.
+func envelopeColumns(envelope *encrypt.Envelope) (*string, any) {
+	if envelope == nil {
+		return nil, nil
+	}
+
+	return &envelope.KeyID, envelope.DataKey
+}
+
+func nullString(value string) *string {
+	if value == "" {
+		return nil
+	}
+
+	return &value
+}
@@ -7,12 +7,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-
-	_ "github.com/lib/pq" // Imports postgres driver
+	"net"
+	"net/url"
+	"time"
 
 	"github.com/EWK20/event-processor/processor/internal/config"
-	"github.com/EWK20/event-processor/processor/internal/models"
+	"github.com/EWK20/event-processor/processor/internal/encrypt"
+	"github.com/EWK20/event-processor/processor/internal/redact"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/lib/pq"
 	"github.com/pressly/goose/v3"
+	"github.com/rs/zerolog/log"
 )
 
 var (
@@ -20,27 +27,155 @@ var (
 	ErrFailedToPingDB         = errors.New("failed to ping database")
 	ErrFailedToSave           = errors.New("failed to save data")
 	ErrFailedToMarshalPayload = errors.New("failed to marshal payload data")
+	ErrFailedToQuery          = errors.New("failed to query data")
+	ErrFailedToDelete         = errors.New("failed to delete data")
+)
+
+const (
+	DriverPQ  = "pq"
+	DriverPGX = "pgx"
 )
 
 type Database struct {
 	Conn *sql.DB
+
+	// pool is only set when the pgx driver is used, Conn is then backed by it.
+	pool             *pgxpool.Pool
+	statementTimeout time.Duration
+	encrypter        *encrypt.Encrypter
+	// tenant is the client whose events the sessions can access, set on
+	// every new connection.
+	tenant string
+	// allTenants is set when the sessions access every client's events.
+	allTenants bool
 }
 
-func New(cfg config.DB) (*Database, error) {
-	connStr := "user=" + cfg.User + " password=" + cfg.Password + " host=" + cfg.Host + " port=" + cfg.Port + " dbname=" + cfg.DBName + " sslmode=" + cfg.SSLMode
+type Option func(*Database)
 
-	conn, err := sql.Open("postgres", connStr)
-	if err != nil {
-		return nil, fmt.Errorf("%w, %w", ErrFailedToConnectToDB, err)
+// WithEncryption encrypts payload fields before events are saved, and
+// decrypts them when events are read.
+func WithEncryption(encrypter *encrypt.Encrypter) Option {
+	return func(db *Database) {
+		db.encrypter = encrypter
+	}
+}
+
+func New(cfg config.DB, opts ...Option) (*Database, error) {
+	db := &Database{
+		statementTimeout: cfg.StatementTimeout,
+	}
+
+	for _, opt := range opts {
+		opt(db)
+	}
+
+	switch cfg.Driver {
+	case DriverPGX:
+		poolCfg, err := pgxpool.ParseConfig(DSN(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("%w, %w", ErrFailedToConnectToDB, err)
+		}
+
+		if cfg.MaxOpenConns > 0 {
+			poolCfg.MaxConns = int32(cfg.MaxOpenConns)
+		}
+		// pgxpool has no idle limit, the idle connections are kept open as
+		// its minimum instead
+		if cfg.MaxIdleConns > 0 {
+			poolCfg.MinConns = min(int32(cfg.MaxIdleConns), poolCfg.MaxConns)
+		}
+		if cfg.ConnMaxLifetime > 0 {
+			poolCfg.MaxConnLifetime = cfg.ConnMaxLifetime
+		}
+		if cfg.ConnMaxIdleTime > 0 {
+			poolCfg.MaxConnIdleTime = cfg.ConnMaxIdleTime
+		}
+
+		poolCfg.AfterConnect = db.afterConnect
+
+		db.pool, err = pgxpool.NewWithConfig(context.Background(), poolCfg)
+		if err != nil {
+			return nil, fmt.Errorf("%w, %w", ErrFailedToConnectToDB, err)
+		}
+
+		db.Conn = stdlib.OpenDBFromPool(db.pool)
+	default:
+		connector, err := pq.NewConnector(DSN(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("%w, %w", ErrFailedToConnectToDB, err)
+		}
+
+		conn := sql.OpenDB(tenantConnector{Connector: connector, tenant: db.tenant})
+
+		if cfg.MaxOpenConns > 0 {
+			conn.SetMaxOpenConns(cfg.MaxOpenConns)
+		}
+		if cfg.MaxIdleConns > 0 {
+			conn.SetMaxIdleConns(cfg.MaxIdleConns)
+		}
+		conn.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+		conn.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+		db.Conn = conn
 	}
 
-	if err := conn.Ping(); err != nil {
+	ctx, cancel := db.withTimeout(context.Background())
+	defer cancel()
+
+	if err := db.Conn.PingContext(ctx); err != nil {
+		db.Close()
+
 		return nil, fmt.Errorf("%w, %w", ErrFailedToPingDB, err)
 	}
 
-	return &Database{
-		conn,
-	}, nil
+	if err := db.checkTenant(ctx); err != nil {
+		db.Close()
+
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func (db *Database) Close() {
+	if err := db.Conn.Close(); err != nil {
+		log.Error().Err(err).Msg("failed to close database connection")
+	}
+
+	if db.pool != nil {
+		db.pool.Close()
+	}
+}
+
+// withTimeout bounds a single statement so a hung database can't block the
+// caller forever. The caller's deadline still applies if it is shorter.
+func (db *Database) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.statementTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, db.statementTimeout)
+}
+
+// DSN returns the connection URL for cfg. DATABASE_URL is used as is, the
+// individual settings are escaped so passwords may contain any character.
+func DSN(cfg config.DB) string {
+	if cfg.URL != "" {
+		return cfg.URL
+	}
+
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(cfg.User, cfg.Password),
+		Host:   net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:   "/" + cfg.DBName,
+	}
+
+	if cfg.SSLMode != "" {
+		dsn.RawQuery = url.Values{"sslmode": {cfg.SSLMode}}.Encode()
+	}
+
+	return dsn.String()
 }
 
 //go:embed migrations/*.sql
@@ -58,23 +193,42 @@ func (db *Database) RunMigrations() error {
 	return nil
 }
 
-func (db *Database) Save(ctx context.Context, event models.Event) error {
-	query := `
+const insertEvent = `
 	INSERT INTO events (
-		event_type, client_id, payload, "timestamp"
+		event_type, client_id, payload, "timestamp", priority, category,
+		message_id, received_at, metadata, schema_version, key_id, data_key
 	) VALUES (
-	 	$1, $2, $3, $4
+	 	$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12
 	)`
 
-	payloadJSON, err := json.Marshal(event.Payload)
+// Save inserts the event, scoped to its client when the session has no
+// tenant.
+func (db *Database) Save(ctx context.Context, event models.Event) error {
+	return db.SaveRedacted(ctx, event, redact.Result{})
+}
+
+func (db *Database) GetClient(ctx context.Context, clientID string) (*models.Client, error) {
+	query := `SELECT client_id, name, COALESCE(tier, ''), metadata FROM clients WHERE client_id = $1`
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var (
+		client   models.Client
+		metadata []byte
+	)
+
+	err := db.Conn.QueryRowContext(ctx, query, clientID).Scan(&client.ID, &client.Name, &client.Tier, &metadata)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
 	if err != nil {
-		return fmt.Errorf("%w: %w", ErrFailedToMarshalPayload, err)
+		return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
 	}
 
-	_, err = db.Conn.ExecContext(ctx, query, event.EventType, event.ClientID, string(payloadJSON), event.Timestamp.UTC())
-	if err != nil {
-		return fmt.Errorf("%w: %w", ErrFailedToSave, err)
+	if err := json.Unmarshal(metadata, &client.Metadata); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
 	}
 
-	return nil
+	return &client, nil
 }
@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE events
+    ADD COLUMN priority VARCHAR(50),
+    ADD COLUMN category VARCHAR(50);
+
+CREATE INDEX idx_events_priority ON events (priority);
+CREATE INDEX idx_events_category ON events (category);
+-- +goose StatementEnd
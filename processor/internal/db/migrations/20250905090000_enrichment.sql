@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE clients (
+    client_id VARCHAR(100) PRIMARY KEY NOT NULL CHECK (char_length(client_id) > 0),
+    name VARCHAR(255) NOT NULL,
+    tier VARCHAR(50),
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE events
+    ADD COLUMN message_id VARCHAR(100),
+    ADD COLUMN received_at TIMESTAMPTZ,
+    ADD COLUMN metadata JSONB;
+
+CREATE INDEX idx_events_message_id ON events (message_id);
+-- +goose StatementEnd
@@ -0,0 +1,7 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE events
+    ADD COLUMN schema_version INTEGER NOT NULL DEFAULT 1 CHECK (schema_version > 0);
+
+CREATE INDEX idx_events_event_type_schema_version ON events (event_type, schema_version);
+-- +goose StatementEnd
@@ -0,0 +1,6 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Existing rows are left NULL, only rows saved from now on are stamped
+ALTER TABLE events ADD COLUMN persisted_at TIMESTAMPTZ;
+ALTER TABLE events ALTER COLUMN persisted_at SET DEFAULT now();
+-- +goose StatementEnd
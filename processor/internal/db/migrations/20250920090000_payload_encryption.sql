@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Set on events with encrypted payload fields, data_key is the event's data
+-- key encrypted with the key key_id
+ALTER TABLE events
+    ADD COLUMN key_id TEXT,
+    ADD COLUMN data_key BYTEA;
+
+-- Encrypted fields are longer than their plaintext, the payload limit applies
+-- to the plaintext when events are validated
+ALTER TABLE events ALTER COLUMN payload TYPE TEXT;
+
+CREATE INDEX idx_events_key_id ON events (key_id) WHERE key_id IS NOT NULL;
+-- +goose StatementEnd
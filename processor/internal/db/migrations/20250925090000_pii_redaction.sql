@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Original values of tokenized payload fields. fingerprint is the HMAC of the
+-- value, so a client's value is always replaced with the same token. value is
+-- encrypted with its own data key, data_key, encrypted with the key key_id
+CREATE TABLE pii_vault (
+    token VARCHAR(100) PRIMARY KEY NOT NULL,
+    client_id VARCHAR(100) NOT NULL CHECK (char_length(client_id) > 0),
+    fingerprint VARCHAR(64) NOT NULL,
+    value TEXT NOT NULL,
+    key_id TEXT NOT NULL,
+    data_key BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (client_id, fingerprint)
+);
+
+-- Every payload field masked, hashed or tokenized before an event was saved.
+-- A message's field is audited once per action, however often it is
+-- delivered
+CREATE TABLE pii_audit (
+    id BIGSERIAL PRIMARY KEY NOT NULL,
+    message_id VARCHAR(100),
+    client_id VARCHAR(100) NOT NULL,
+    event_type VARCHAR(100) NOT NULL,
+    field VARCHAR(255) NOT NULL,
+    action VARCHAR(50) NOT NULL,
+    count INTEGER NOT NULL,
+    redacted_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (message_id, field, action)
+);
+
+CREATE INDEX idx_pii_audit_client_id ON pii_audit (client_id, redacted_at);
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Sessions only read and write the events of the client in app.tenant_id,
+-- sessions without a tenant see no events. No setting gives access to every
+-- client, jobs reading or writing every client's events connect as a role
+-- with BYPASSRLS. FORCE applies the policy to the table owner too, superusers
+-- and roles with BYPASSRLS are never subject to it
+ALTER TABLE events ENABLE ROW LEVEL SECURITY;
+ALTER TABLE events FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY events_tenant_isolation ON events
+    USING (client_id = current_setting('app.tenant_id', true))
+    WITH CHECK (client_id = current_setting('app.tenant_id', true));
+-- +goose StatementEnd
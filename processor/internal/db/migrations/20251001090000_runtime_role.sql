@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- event_processor grants the processor's commands access to the tables,
+-- through login roles granted it. It is subject to row level security, and
+-- BYPASSRLS isn't inherited, so only the login roles of jobs handling every
+-- client's events, like import and rotate-keys, are given BYPASSRLS. Creating
+-- it needs CREATEROLE, it can be created beforehand where migrations run
+-- without it
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'event_processor') THEN
+        CREATE ROLE event_processor NOLOGIN NOBYPASSRLS;
+    END IF;
+END $$;
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON events, pii_vault, pii_audit TO event_processor;
+GRANT SELECT ON clients TO event_processor;
+GRANT USAGE, SELECT ON SEQUENCE events_id_seq, pii_audit_id_seq TO event_processor;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The PII vault and audit are isolated by client like events, see
+-- events_tenant_isolation
+ALTER TABLE pii_vault ENABLE ROW LEVEL SECURITY;
+ALTER TABLE pii_vault FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY pii_vault_tenant_isolation ON pii_vault
+    USING (client_id = current_setting('app.tenant_id', true))
+    WITH CHECK (client_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE pii_audit ENABLE ROW LEVEL SECURITY;
+ALTER TABLE pii_audit FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY pii_audit_tenant_isolation ON pii_audit
+    USING (client_id = current_setting('app.tenant_id', true))
+    WITH CHECK (client_id = current_setting('app.tenant_id', true));
+-- +goose StatementEnd
@@ -0,0 +1,209 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/encrypt"
+	"github.com/EWK20/event-processor/processor/models"
+)
+
+// Filter selects stored events, empty fields match every event. From is
+// inclusive and To exclusive.
+type Filter struct {
+	ClientID  string
+	EventType string
+	From      time.Time
+	To        time.Time
+}
+
+func (f Filter) where(args []any) (string, []any) {
+	var conditions []string
+
+	add := func(condition string, value any) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if f.ClientID != "" {
+		add("client_id = $%d", f.ClientID)
+	}
+
+	if f.EventType != "" {
+		add("event_type = $%d", f.EventType)
+	}
+
+	if !f.From.IsZero() {
+		add(`"timestamp" >= $%d`, f.From.UTC())
+	}
+
+	if !f.To.IsZero() {
+		add(`"timestamp" < $%d`, f.To.UTC())
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return " AND " + strings.Join(conditions, " AND "), args
+}
+
+// Events returns up to limit events matching filter with an ID greater than
+// afterID, in ID order, so large selections can be paged through.
+func (db *Database) Events(ctx context.Context, filter Filter, afterID int64, limit int) ([]models.Event, error) {
+	where, args := filter.where([]any{afterID, limit})
+
+	query := `
+	SELECT
+		id, event_type, client_id, payload, "timestamp", COALESCE(priority, ''), COALESCE(category, ''),
+		COALESCE(message_id, ''), received_at, metadata, schema_version, key_id, data_key
+	FROM events
+	WHERE id > $1` + where + `
+	ORDER BY id
+	LIMIT $2`
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+	}
+	defer rows.Close()
+
+	var events []models.Event
+
+	for rows.Next() {
+		var (
+			event      models.Event
+			payload    []byte
+			receivedAt sql.NullTime
+			metadata   []byte
+			keyID      sql.NullString
+			dataKey    []byte
+		)
+
+		err := rows.Scan(
+			&event.ID, &event.EventType, &event.ClientID, &payload, &event.Timestamp, &event.Priority, &event.Category,
+			&event.MessageID, &receivedAt, &metadata, &event.SchemaVersion, &keyID, &dataKey,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+		}
+
+		if err := json.Unmarshal(payload, &event.Payload); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+		}
+
+		if keyID.Valid {
+			if event.Payload, err = db.decrypt(ctx, event.Payload, encrypt.Envelope{KeyID: keyID.String, DataKey: dataKey}); err != nil {
+				return nil, fmt.Errorf("%w: event %d: %w", ErrFailedToQuery, event.ID, err)
+			}
+		}
+
+		if metadata != nil {
+			if err := json.Unmarshal(metadata, &event.Metadata); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+			}
+		}
+
+		event.Timestamp = event.Timestamp.UTC()
+
+		if receivedAt.Valid {
+			event.ReceivedAt = receivedAt.Time.UTC()
+		}
+
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+	}
+
+	return events, nil
+}
+
+// CountEvents returns the number of events matching filter with an ID greater
+// than afterID.
+func (db *Database) CountEvents(ctx context.Context, filter Filter, afterID int64) (int64, error) {
+	where, args := filter.where([]any{afterID})
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	var count int64
+
+	err := db.Conn.QueryRowContext(ctx, `SELECT count(*) FROM events WHERE id > $1`+where, args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+	}
+
+	return count, nil
+}
+
+// Partition is the set of events of a client on a UTC day.
+type Partition struct {
+	Date     time.Time
+	ClientID string
+}
+
+// EventPartitions lists the partitions holding events matching filter, by
+// date then client.
+func (db *Database) EventPartitions(ctx context.Context, filter Filter) ([]Partition, error) {
+	where, args := filter.where(nil)
+
+	query := `
+	SELECT DISTINCT ("timestamp" AT TIME ZONE 'UTC')::date AS day, client_id
+	FROM events
+	WHERE true` + where + `
+	ORDER BY day, client_id`
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := db.Conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+	}
+	defer rows.Close()
+
+	var partitions []Partition
+
+	for rows.Next() {
+		var partition Partition
+
+		if err := rows.Scan(&partition.Date, &partition.ClientID); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+		}
+
+		partition.Date = time.Date(partition.Date.Year(), partition.Date.Month(), partition.Date.Day(), 0, 0, 0, 0, time.UTC)
+
+		partitions = append(partitions, partition)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+	}
+
+	return partitions, nil
+}
+
+// DeleteEvents deletes the events matching filter with an ID up to maxID, so
+// events saved after they were selected are kept.
+func (db *Database) DeleteEvents(ctx context.Context, filter Filter, maxID int64) (int64, error) {
+	where, args := filter.where([]any{maxID})
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	result, err := db.Conn.ExecContext(ctx, `DELETE FROM events WHERE id <= $1`+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrFailedToDelete, err)
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/EWK20/event-processor/processor/internal/redact"
+	"github.com/EWK20/event-processor/processor/models"
+)
+
+// execer runs a statement in the transaction saving events, database/sql and
+// pgx transactions having their own methods.
+type execer func(ctx context.Context, query string, args ...any) error
+
+func sqlExecer(tx *sql.Tx) execer {
+	return func(ctx context.Context, query string, args ...any) error {
+		_, err := tx.ExecContext(ctx, query, args...)
+
+		return err
+	}
+}
+
+// SaveRedacted saves the event with the vault entries and audit records of
+// its redaction, in one transaction scoped to its client when the session has
+// no tenant. Vault entries and audit records already saved, by an earlier
+// delivery of the message, are skipped.
+func (db *Database) SaveRedacted(ctx context.Context, event models.Event, redacted redact.Result) error {
+	row, err := db.eventRow(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	vault, err := db.vaultRows(ctx, redacted.Vault)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	err = db.inTenant(ctx, event.ClientID, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, insertEvent, row...); err != nil {
+			return err
+		}
+
+		return saveRedactions(ctx, sqlExecer(tx), vault, redacted.Redactions)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToSave, err)
+	}
+
+	return nil
+}
+
+// vaultRows encrypts the values of the vault entries, bound to their token.
+// Tokenizing needs encryption, so values are never stored in clear.
+func (db *Database) vaultRows(ctx context.Context, entries []redact.VaultEntry) ([][]any, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	if db.encrypter == nil {
+		return nil, fmt.Errorf("%w: %w: tokenized values are encrypted in the vault", ErrFailedToSave, ErrNotEncrypted)
+	}
+
+	rows := make([][]any, 0, len(entries))
+
+	for _, entry := range entries {
+		value, envelope, err := db.encrypter.EncryptValue(ctx, entry.Value, entry.Token)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFailedToSave, err)
+		}
+
+		rows = append(rows, []any{entry.Token, entry.ClientID, entry.Fingerprint, value, envelope.KeyID, envelope.DataKey})
+	}
+
+	return rows, nil
+}
+
+// saveRedactions inserts the vault rows and audit records with exec. A
+// client's value always has the same token, and a message's field is only
+// audited once per action, so conflicting rows are already saved.
+func saveRedactions(ctx context.Context, exec execer, vault [][]any, redactions []redact.Redaction) error {
+	if len(vault) > 0 {
+		values, args := valuesList(vault)
+
+		query := `INSERT INTO pii_vault (token, client_id, fingerprint, value, key_id, data_key) VALUES ` + values +
+			` ON CONFLICT (client_id, fingerprint) DO NOTHING`
+
+		if err := exec(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+
+	if len(redactions) > 0 {
+		rows := make([][]any, 0, len(redactions))
+
+		for _, r := range redactions {
+			rows = append(rows, []any{nullString(r.MessageID), r.ClientID, r.EventType, r.Field, r.Action, r.Count})
+		}
+
+		values, args := valuesList(rows)
+
+		query := `INSERT INTO pii_audit (message_id, client_id, event_type, field, action, count) VALUES ` + values +
+			` ON CONFLICT (message_id, field, action) DO NOTHING`
+
+		if err := exec(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// valuesList returns the VALUES list of a multi-row insert of rows, and its
+// arguments.
+func valuesList(rows [][]any) (string, []any) {
+	var (
+		values []string
+		args   []any
+	)
+
+	for _, row := range rows {
+		placeholders := make([]string, len(row))
+
+		for i, value := range row {
+			args = append(args, value)
+			placeholders[i] = fmt.Sprintf("$%d", len(args))
+		}
+
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+	}
+
+	return strings.Join(values, ", "), args
+}
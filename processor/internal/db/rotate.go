@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/EWK20/event-processor/processor/internal/encrypt"
+)
+
+var (
+	ErrNotEncrypted   = errors.New("payload encryption isn't configured")
+	ErrFailedToRotate = errors.New("failed to rotate encryption keys")
+)
+
+func (db *Database) decrypt(ctx context.Context, payload any, envelope encrypt.Envelope) (any, error) {
+	if db.encrypter == nil {
+		return nil, fmt.Errorf("%w: the payload is encrypted with key %q", ErrNotEncrypted, envelope.KeyID)
+	}
+
+	return db.encrypter.Decrypt(ctx, payload, envelope)
+}
+
+// RotateBatch re-encrypts up to limit events with an ID greater than afterID
+// whose data key isn't encrypted with the current key, including events of
+// the configured types saved before their fields were encrypted. It returns
+// how many were re-encrypted and the last ID checked, which is afterID once
+// every event is done.
+func (db *Database) RotateBatch(ctx context.Context, afterID int64, limit int) (int64, int64, error) {
+	if db.encrypter == nil {
+		return 0, afterID, ErrNotEncrypted
+	}
+
+	args := []any{afterID, limit, db.encrypter.CurrentKeyID()}
+
+	plain := "false"
+
+	if eventTypes := db.encrypter.EventTypes(); slices.Contains(eventTypes, encrypt.AllEventTypes) {
+		plain = "true"
+	} else if len(eventTypes) > 0 {
+		placeholders := make([]string, 0, len(eventTypes))
+
+		for _, eventType := range eventTypes {
+			args = append(args, eventType)
+			placeholders = append(placeholders, fmt.Sprintf("$%d", len(args)))
+		}
+
+		plain = "event_type IN (" + strings.Join(placeholders, ", ") + ")"
+	}
+
+	query := `
+	SELECT id, event_type, payload, key_id, data_key
+	FROM events
+	WHERE id > $1 AND (key_id <> $3 OR key_id IS NULL AND ` + plain + `)
+	ORDER BY id
+	LIMIT $2
+	FOR UPDATE`
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, afterID, fmt.Errorf("%w: %w", ErrFailedToRotate, err)
+	}
+	defer tx.Rollback() // no-op once committed
+
+	stored, err := storedPayloads(ctx, tx, query, args)
+	if err != nil {
+		return 0, afterID, fmt.Errorf("%w: %w", ErrFailedToRotate, err)
+	}
+
+	var rotated int64
+
+	for _, s := range stored {
+		payload, envelope, err := db.encrypter.Rotate(ctx, s.eventType, s.payload, s.envelope)
+		if err != nil {
+			return 0, afterID, fmt.Errorf("%w: event %d: %w", ErrFailedToRotate, s.id, err)
+		}
+
+		// None of the fields are in the payload
+		if envelope == nil && s.envelope == nil {
+			continue
+		}
+
+		payloadJSON, err := json.Marshal(payload)
+		if err != nil {
+			return 0, afterID, fmt.Errorf("%w: %w", ErrFailedToMarshalPayload, err)
+		}
+
+		keyID, dataKey := envelopeColumns(envelope)
+
+		_, err = tx.ExecContext(ctx, `UPDATE events SET payload = $1, key_id = $2, data_key = $3 WHERE id = $4`,
+			string(payloadJSON), keyID, dataKey, s.id)
+		if err != nil {
+			return 0, afterID, fmt.Errorf("%w: %w", ErrFailedToRotate, err)
+		}
+
+		rotated++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, afterID, fmt.Errorf("%w: %w", ErrFailedToRotate, err)
+	}
+
+	if len(stored) == 0 {
+		return 0, afterID, nil
+	}
+
+	return rotated, stored[len(stored)-1].id, nil
+}
+
+// RotateVaultBatch re-encrypts up to limit vault values with a token after
+// afterToken whose data key isn't encrypted with the current key. It returns
+// how many were re-encrypted and the last token checked, which is afterToken
+// once every value is done.
+func (db *Database) RotateVaultBatch(ctx context.Context, afterToken string, limit int) (int64, string, error) {
+	if db.encrypter == nil {
+		return 0, afterToken, ErrNotEncrypted
+	}
+
+	query := `
+	SELECT token, value, key_id, data_key
+	FROM pii_vault
+	WHERE token > $1 AND key_id <> $3
+	ORDER BY token
+	LIMIT $2
+	FOR UPDATE`
+
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, afterToken, fmt.Errorf("%w: %w", ErrFailedToRotate, err)
+	}
+	defer tx.Rollback() // no-op once committed
+
+	stored, err := storedVaultValues(ctx, tx, query, afterToken, limit, db.encrypter.CurrentKeyID())
+	if err != nil {
+		return 0, afterToken, fmt.Errorf("%w: %w", ErrFailedToRotate, err)
+	}
+
+	for _, s := range stored {
+		original, err := db.encrypter.DecryptValue(ctx, s.value, s.token, s.envelope)
+		if err != nil {
+			return 0, afterToken, fmt.Errorf("%w: vault token %s: %w", ErrFailedToRotate, s.token, err)
+		}
+
+		value, envelope, err := db.encrypter.EncryptValue(ctx, original, s.token)
+		if err != nil {
+			return 0, afterToken, fmt.Errorf("%w: vault token %s: %w", ErrFailedToRotate, s.token, err)
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE pii_vault SET value = $1, key_id = $2, data_key = $3 WHERE token = $4`,
+			value, envelope.KeyID, envelope.DataKey, s.token)
+		if err != nil {
+			return 0, afterToken, fmt.Errorf("%w: %w", ErrFailedToRotate, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, afterToken, fmt.Errorf("%w: %w", ErrFailedToRotate, err)
+	}
+
+	if len(stored) == 0 {
+		return 0, afterToken, nil
+	}
+
+	return int64(len(stored)), stored[len(stored)-1].token, nil
+}
+
+type storedVaultValue struct {
+	token    string
+	value    string
+	envelope encrypt.Envelope
+}
+
+// storedVaultValues reads every row before any is updated, as storedPayloads
+// does.
+func storedVaultValues(ctx context.Context, tx *sql.Tx, query string, args ...any) ([]storedVaultValue, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stored []storedVaultValue
+
+	for rows.Next() {
+		var s storedVaultValue
+
+		if err := rows.Scan(&s.token, &s.value, &s.envelope.KeyID, &s.envelope.DataKey); err != nil {
+			return nil, err
+		}
+
+		stored = append(stored, s)
+	}
+
+	return stored, rows.Err()
+}
+
+type storedPayload struct {
+	id        int64
+	eventType string
+	payload   any
+	envelope  *encrypt.Envelope
+}
+
+// storedPayloads reads every row before any is updated, as the connection
+// can't run statements while rows are being read.
+func storedPayloads(ctx context.Context, tx *sql.Tx, query string, args []any) ([]storedPayload, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stored []storedPayload
+
+	for rows.Next() {
+		var (
+			s       storedPayload
+			payload []byte
+			keyID   sql.NullString
+			dataKey []byte
+		)
+
+		if err := rows.Scan(&s.id, &s.eventType, &payload, &keyID, &dataKey); err != nil {
+			return nil, err
+		}
+
+		if err := json.Unmarshal(payload, &s.payload); err != nil {
+			return nil, err
+		}
+
+		if keyID.Valid {
+			s.envelope = &encrypt.Envelope{KeyID: keyID.String, DataKey: dataKey}
+		}
+
+		stored = append(stored, s)
+	}
+
+	return stored, rows.Err()
+}
@@ -0,0 +1,138 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrFailedToSetTenant = errors.New("failed to set tenant")
+	ErrNoBypassRLS       = errors.New("database role doesn't bypass row level security")
+)
+
+// setTenant sets the app.tenant_id setting the row level security policies on
+// events and the PII tables check, for the rest of the session.
+const setTenant = `SELECT set_config('app.tenant_id', $1, false)`
+
+// setLocalTenant sets app.tenant_id until the end of the transaction.
+const setLocalTenant = `SELECT set_config('app.tenant_id', $1, true)`
+
+// WithTenant scopes every session to the events of clientID, so a query
+// can't read or change the events of other clients whatever its filter.
+// Sessions have no tenant by default, and see no events.
+func WithTenant(clientID string) Option {
+	return func(db *Database) {
+		db.tenant = clientID
+	}
+}
+
+// WithAllTenants gives the sessions access to the events of every client.
+// Row level security has no tenant for every client, so the database role
+// must bypass it, with BYPASSRLS, and New fails when it doesn't.
+func WithAllTenants() Option {
+	return func(db *Database) {
+		db.allTenants = true
+	}
+}
+
+// bypassesRLS reports whether the session's role bypasses row level
+// security, being a superuser or having BYPASSRLS.
+func (db *Database) bypassesRLS(ctx context.Context) (bool, error) {
+	var bypass bool
+
+	err := db.Conn.QueryRowContext(ctx, `SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user`).Scan(&bypass)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+	}
+
+	return bypass, nil
+}
+
+// checkTenant fails when the sessions access every client's events as a role
+// subject to row level security, which would see none of them, and warns
+// when a tenant doesn't isolate the sessions of a role bypassing it.
+func (db *Database) checkTenant(ctx context.Context) error {
+	if !db.allTenants && db.tenant == "" {
+		return nil
+	}
+
+	bypass, err := db.bypassesRLS(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case db.allTenants && !bypass:
+		return fmt.Errorf("%w: connect as a role with BYPASSRLS to access every client's events", ErrNoBypassRLS)
+	case !db.allTenants && bypass:
+		log.Warn().Str("tenant", db.tenant).Msg("the database role bypasses row level security, sessions aren't isolated to the tenant")
+	}
+
+	return nil
+}
+
+// inTenant runs fn in a transaction scoped to clientID, so a session without
+// a tenant, like the queue consumer's, can only write that client's rows.
+// Sessions with a tenant keep it, they can't be scoped to another client.
+func (db *Database) inTenant(ctx context.Context, clientID string, fn func(tx *sql.Tx) error) error {
+	tx, err := db.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op once committed
+
+	if db.tenant == "" {
+		if _, err := tx.ExecContext(ctx, setLocalTenant, clientID); err != nil {
+			return fmt.Errorf("%w: %w", ErrFailedToSetTenant, err)
+		}
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// afterConnect sets the tenant on new pgx connections.
+func (db *Database) afterConnect(ctx context.Context, conn *pgx.Conn) error {
+	if _, err := conn.Exec(ctx, setTenant, db.tenant); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToSetTenant, err)
+	}
+
+	return nil
+}
+
+// tenantConnector sets the tenant on new lib/pq connections.
+type tenantConnector struct {
+	driver.Connector
+	tenant string
+}
+
+func (c tenantConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		conn.Close()
+
+		return nil, fmt.Errorf("%w: the driver can't execute statements", ErrFailedToSetTenant)
+	}
+
+	if _, err := execer.ExecContext(ctx, setTenant, []driver.NamedValue{{Ordinal: 1, Value: c.tenant}}); err != nil {
+		conn.Close()
+
+		return nil, fmt.Errorf("%w: %w", ErrFailedToSetTenant, err)
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,417 @@
+package encrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrUnknownKey      = errors.New("unknown encryption key")
+	ErrFailedToEncrypt = errors.New("failed to encrypt payload")
+	ErrFailedToDecrypt = errors.New("failed to decrypt payload")
+)
+
+const (
+	// AllEventTypes configures fields encrypted in events of every type.
+	AllEventTypes = "*"
+	// prefix marks encrypted field values, which replace the original value
+	// so payloads stay valid JSON.
+	prefix = "enc:v1:"
+	// escapePrefix is added to payload strings starting with markerPrefix,
+	// so a client's value is never taken for an encrypted one.
+	escapePrefix = "enc:esc:"
+	markerPrefix = "enc:"
+	dataKeySize  = 32
+)
+
+// KeyProvider holds the key encryption keys. Every event gets its own data key,
+// which encrypts its fields and is stored encrypted with the current key.
+type KeyProvider interface {
+	// CurrentKeyID is the ID of the key new data keys are encrypted with.
+	CurrentKeyID() string
+	Key(ctx context.Context, id string) ([]byte, error)
+}
+
+// Envelope is stored with an event whose fields are encrypted. DataKey is the
+// event's data key, encrypted with the key KeyID.
+type Envelope struct {
+	KeyID   string
+	DataKey []byte
+}
+
+// Encrypter encrypts payload fields with AES-GCM envelope encryption.
+type Encrypter struct {
+	keys   KeyProvider
+	fields map[string][][]string
+}
+
+// New encrypts the fields of each event type, given as dot separated paths.
+// Paths go through arrays, so "items.card_number" encrypts the card number of
+// every item.
+func New(keys KeyProvider, fields map[string][]string) *Encrypter {
+	e := &Encrypter{
+		keys:   keys,
+		fields: make(map[string][][]string, len(fields)),
+	}
+
+	for eventType, paths := range fields {
+		for _, path := range paths {
+			e.fields[eventType] = append(e.fields[eventType], strings.Split(path, "."))
+		}
+	}
+
+	return e
+}
+
+// EventTypes lists the event types with encrypted fields, AllEventTypes
+// included.
+func (e *Encrypter) EventTypes() []string {
+	eventTypes := make([]string, 0, len(e.fields))
+
+	for eventType := range e.fields {
+		eventTypes = append(eventTypes, eventType)
+	}
+
+	slices.Sort(eventTypes)
+
+	return eventTypes
+}
+
+// CurrentKeyID is the ID of the key new data keys are encrypted with.
+func (e *Encrypter) CurrentKeyID() string {
+	return e.keys.CurrentKeyID()
+}
+
+// Encrypt returns a copy of payload with the fields of eventType encrypted
+// under a new data key, and the envelope to store with it. The envelope is
+// nil, and payload returned as is, when it has none of the fields. Strings
+// looking like encrypted values are escaped, Decrypt restores them.
+func (e *Encrypter) Encrypt(ctx context.Context, eventType string, payload any) (any, *Envelope, error) {
+	paths := append(slices.Clone(e.fields[eventType]), e.fields[AllEventTypes]...)
+
+	if len(paths) == 0 || !hasAny(payload, paths) {
+		return payload, nil, nil
+	}
+
+	fieldCipher, envelope, err := e.newDataKey(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload, _ = walk(payload, nil, escape)
+
+	for _, path := range paths {
+		payload, err = transform(payload, path, nil, func(value any, at []string) (any, error) {
+			plaintext, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+
+			return prefix + base64.StdEncoding.EncodeToString(seal(fieldCipher, plaintext, aad(at))), nil
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %w", ErrFailedToEncrypt, err)
+		}
+	}
+
+	return payload, envelope, nil
+}
+
+// EncryptValue encrypts value under a new data key, bound to binding so it
+// can only be decrypted with the same one, and returns the envelope to store
+// with it.
+func (e *Encrypter) EncryptValue(ctx context.Context, value, binding string) (string, *Envelope, error) {
+	valueCipher, envelope, err := e.newDataKey(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return prefix + base64.StdEncoding.EncodeToString(seal(valueCipher, []byte(value), []byte(binding))), envelope, nil
+}
+
+// DecryptValue decrypts a value encrypted by EncryptValue with the same
+// binding.
+func (e *Encrypter) DecryptValue(ctx context.Context, value, binding string, envelope Envelope) (string, error) {
+	valueCipher, err := e.openDataKey(ctx, envelope)
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, prefix))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrFailedToDecrypt, err)
+	}
+
+	plaintext, err := open(valueCipher, sealed, []byte(binding))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrFailedToDecrypt, err)
+	}
+
+	return string(plaintext), nil
+}
+
+// newDataKey generates a data key, returning its cipher and the envelope
+// holding it encrypted with the current key.
+func (e *Encrypter) newDataKey(ctx context.Context) (cipher.AEAD, *Envelope, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrFailedToEncrypt, err)
+	}
+
+	dataCipher, err := newGCM(dataKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrFailedToEncrypt, err)
+	}
+
+	keyID := e.keys.CurrentKeyID()
+
+	key, err := e.keys.Key(ctx, keyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyCipher, err := newGCM(key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrFailedToEncrypt, err)
+	}
+
+	return dataCipher, &Envelope{KeyID: keyID, DataKey: seal(keyCipher, dataKey, []byte(keyID))}, nil
+}
+
+// openDataKey decrypts the data key held by envelope, returning its cipher.
+func (e *Encrypter) openDataKey(ctx context.Context, envelope Envelope) (cipher.AEAD, error) {
+	key, err := e.keys.Key(ctx, envelope.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	keyCipher, err := newGCM(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToDecrypt, err)
+	}
+
+	dataKey, err := open(keyCipher, envelope.DataKey, []byte(envelope.KeyID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: data key: %w", ErrFailedToDecrypt, err)
+	}
+
+	dataCipher, err := newGCM(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToDecrypt, err)
+	}
+
+	return dataCipher, nil
+}
+
+// Decrypt returns a copy of payload with every encrypted field decrypted and
+// escaped strings restored. Fields are found by their marker rather than the
+// configured paths, so events stay readable when the configuration changes.
+func (e *Encrypter) Decrypt(ctx context.Context, payload any, envelope Envelope) (any, error) {
+	fieldCipher, err := e.openDataKey(ctx, envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err = walk(payload, nil, func(value any, at []string) (any, error) {
+		if !encrypted(value) {
+			return unescape(value, at)
+		}
+
+		sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value.(string), prefix))
+		if err != nil {
+			return nil, err
+		}
+
+		plaintext, err := open(fieldCipher, sealed, aad(at))
+		if err != nil {
+			return nil, err
+		}
+
+		var decrypted any
+		if err := json.Unmarshal(plaintext, &decrypted); err != nil {
+			return nil, err
+		}
+
+		return walk(decrypted, at, unescape)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToDecrypt, err)
+	}
+
+	return payload, nil
+}
+
+// Rotate decrypts payload and encrypts it again under a new data key,
+// encrypted with the current key. A nil envelope is a payload stored before
+// its fields were configured to be encrypted.
+func (e *Encrypter) Rotate(ctx context.Context, eventType string, payload any, envelope *Envelope) (any, *Envelope, error) {
+	if envelope != nil {
+		var err error
+
+		if payload, err = e.Decrypt(ctx, payload, *envelope); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return e.Encrypt(ctx, eventType, payload)
+}
+
+func encrypted(value any) bool {
+	s, ok := value.(string)
+
+	return ok && strings.HasPrefix(s, prefix)
+}
+
+func escape(value any, _ []string) (any, error) {
+	if s, ok := value.(string); ok && strings.HasPrefix(s, markerPrefix) {
+		return escapePrefix + s, nil
+	}
+
+	return value, nil
+}
+
+func unescape(value any, _ []string) (any, error) {
+	if s, ok := value.(string); ok {
+		return strings.TrimPrefix(s, escapePrefix), nil
+	}
+
+	return value, nil
+}
+
+// aad binds an encrypted value to its field, so it can't be moved to another.
+func aad(path []string) []byte {
+	return []byte(strings.Join(path, "."))
+}
+
+func hasAny(payload any, paths [][]string) bool {
+	for _, path := range paths {
+		found := false
+
+		_, _ = transform(payload, path, nil, func(value any, _ []string) (any, error) {
+			found = true
+
+			return value, nil
+		})
+
+		if found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// transform replaces the values at path with fn, copying the maps and arrays
+// on the way to them. Missing fields are skipped.
+func transform(value any, path, at []string, fn func(value any, at []string) (any, error)) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		if len(path) == 0 {
+			return fn(value, at)
+		}
+
+		child, ok := v[path[0]]
+		if !ok {
+			return value, nil
+		}
+
+		replaced, err := transform(child, path[1:], append(slices.Clip(at), path[0]), fn)
+		if err != nil {
+			return nil, err
+		}
+
+		copied := maps.Clone(v)
+		copied[path[0]] = replaced
+
+		return copied, nil
+	case []any:
+		copied := make([]any, len(v))
+
+		for i, item := range v {
+			replaced, err := transform(item, path, at, fn)
+			if err != nil {
+				return nil, err
+			}
+
+			copied[i] = replaced
+		}
+
+		return copied, nil
+	default:
+		if len(path) > 0 {
+			return value, nil
+		}
+
+		return fn(value, at)
+	}
+}
+
+// walk replaces every leaf value with fn, copying the maps and arrays.
+func walk(value any, at []string, fn func(value any, at []string) (any, error)) (any, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+
+		for key, child := range v {
+			replaced, err := walk(child, append(slices.Clip(at), key), fn)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+
+			copied[key] = replaced
+		}
+
+		return copied, nil
+	case []any:
+		copied := make([]any, len(v))
+
+		for i, item := range v {
+			replaced, err := walk(item, at, fn)
+			if err != nil {
+				return nil, err
+			}
+
+			copied[i] = replaced
+		}
+
+		return copied, nil
+	default:
+		return fn(value, at)
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext, prefixed with its random nonce.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) []byte {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	_, _ = rand.Read(nonce)
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData)
+}
+
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
@@ -0,0 +1,290 @@
+package encrypt_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/EWK20/event-processor/processor/internal/encrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeyfile writes a keyfile holding a key derived from each ID, current
+// being the first.
+func writeKeyfile(t *testing.T, ids ...string) string {
+	t.Helper()
+
+	keys := make(map[string]string, len(ids))
+
+	for _, id := range ids {
+		key := sha256.Sum256([]byte(id))
+		keys[id] = base64.StdEncoding.EncodeToString(key[:])
+	}
+
+	data, err := json.Marshal(map[string]any{"current": ids[0], "keys": keys})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+
+	return path
+}
+
+func newEncrypter(t *testing.T, fields map[string][]string, ids ...string) *encrypt.Encrypter {
+	t.Helper()
+
+	keys, err := encrypt.NewKeyfile(writeKeyfile(t, ids...))
+	require.NoError(t, err)
+
+	return encrypt.New(keys, fields)
+}
+
+func payload() map[string]any {
+	return map[string]any{
+		"amount": "10.00",
+		"card":   map[string]any{"number": "4111111111111111", "expiry": "12/29"},
+		"items": []any{
+			map[string]any{"sku": "sku_1", "serial": "abc"},
+			map[string]any{"sku": "sku_2"},
+		},
+		"customer": map[string]any{"email": "jo@example.com", "age": 42.0},
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	type Test struct {
+		eventType string
+		fields    map[string][]string
+		// encrypted is the number of values expected to be encrypted.
+		encrypted int
+		hidden    []string
+	}
+
+	testCases := map[string]Test{
+		"Nested Fields": {
+			eventType: "transaction_approved",
+			fields:    map[string][]string{"transaction_approved": {"card.number", "customer"}},
+			encrypted: 2,
+			hidden:    []string{"4111111111111111", "jo@example.com"},
+		},
+		"Fields In Arrays": {
+			eventType: "transaction_approved",
+			fields:    map[string][]string{"transaction_approved": {"items.serial"}},
+			encrypted: 1,
+			hidden:    []string{"abc"},
+		},
+		"Every Event Type": {
+			eventType: "transaction_refunded",
+			fields:    map[string][]string{encrypt.AllEventTypes: {"customer.email"}, "transaction_approved": {"amount"}},
+			encrypted: 1,
+			hidden:    []string{"jo@example.com"},
+		},
+		"Missing Fields": {
+			eventType: "transaction_approved",
+			fields:    map[string][]string{"transaction_approved": {"card.cvv", "iban"}},
+		},
+		"Other Event Type": {
+			eventType: "transaction_refunded",
+			fields:    map[string][]string{"transaction_approved": {"card.number"}},
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			encrypter := newEncrypter(t, test.fields, "2025-09")
+			original := payload()
+
+			encrypted, envelope, err := encrypter.Encrypt(t.Context(), test.eventType, original)
+			require.NoError(t, err)
+
+			// The payload passed in is left as it was
+			assert.Equal(t, payload(), original)
+
+			if test.encrypted == 0 {
+				assert.Nil(t, envelope)
+				assert.Equal(t, original, encrypted)
+
+				return
+			}
+
+			require.NotNil(t, envelope)
+			assert.Equal(t, "2025-09", envelope.KeyID)
+
+			data, err := json.Marshal(encrypted)
+			require.NoError(t, err)
+			assert.Equal(t, test.encrypted, strings.Count(string(data), `"enc:v1:`))
+
+			for _, plaintext := range test.hidden {
+				assert.NotContains(t, string(data), plaintext)
+			}
+
+			decrypted, err := encrypter.Decrypt(t.Context(), encrypted, *envelope)
+			require.NoError(t, err)
+			assert.Equal(t, original, decrypted)
+		})
+	}
+}
+
+// TestEncryptMarkerValues checks client values that look like encrypted ones
+// are kept as they were sent rather than decrypted.
+func TestEncryptMarkerValues(t *testing.T) {
+	encrypter := newEncrypter(t, map[string][]string{"transaction_approved": {"card"}}, "2025-09")
+
+	original := map[string]any{
+		"note":    "enc:v1:AAAA",
+		"escaped": "enc:esc:enc:v1:AAAA",
+		"card":    map[string]any{"number": "enc:v1:BBBB", "holder": "enc:jo"},
+	}
+
+	encrypted, envelope, err := encrypter.Encrypt(t.Context(), "transaction_approved", original)
+	require.NoError(t, err)
+	require.NotNil(t, envelope)
+
+	data, err := json.Marshal(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(data), `"enc:v1:`))
+
+	decrypted, err := encrypter.Decrypt(t.Context(), encrypted, *envelope)
+	require.NoError(t, err)
+	assert.Equal(t, original, decrypted)
+}
+
+func TestEncryptValue(t *testing.T) {
+	encrypter := newEncrypter(t, nil, "2025-06")
+
+	encrypted, envelope, err := encrypter.EncryptValue(t.Context(), `"jo@example.com"`, "client_123")
+	require.NoError(t, err)
+	require.NotNil(t, envelope)
+	assert.NotContains(t, encrypted, "jo@example.com")
+
+	// Values stay readable once the key isn't current anymore
+	rotated := newEncrypter(t, nil, "2025-09", "2025-06")
+
+	decrypted, err := rotated.DecryptValue(t.Context(), encrypted, "client_123", *envelope)
+	require.NoError(t, err)
+	assert.Equal(t, `"jo@example.com"`, decrypted)
+
+	_, err = rotated.DecryptValue(t.Context(), encrypted, "client_456", *envelope)
+	require.ErrorIs(t, err, encrypt.ErrFailedToDecrypt)
+}
+
+func TestDecryptErrors(t *testing.T) {
+	encrypter := newEncrypter(t, map[string][]string{"transaction_approved": {"card.number", "card.expiry"}}, "2025-09")
+
+	encrypted, envelope, err := encrypter.Encrypt(t.Context(), "transaction_approved", payload())
+	require.NoError(t, err)
+
+	card := encrypted.(map[string]any)["card"].(map[string]any)
+
+	testCases := map[string]struct {
+		payload  any
+		envelope encrypt.Envelope
+		err      error
+	}{
+		"Unknown Key": {
+			payload:  encrypted,
+			envelope: encrypt.Envelope{KeyID: "2024-01", DataKey: envelope.DataKey},
+			err:      encrypt.ErrUnknownKey,
+		},
+		"Tampered Data Key": {
+			payload:  encrypted,
+			envelope: encrypt.Envelope{KeyID: envelope.KeyID, DataKey: append([]byte{1}, envelope.DataKey[1:]...)},
+			err:      encrypt.ErrFailedToDecrypt,
+		},
+		"Value Moved To Another Field": {
+			payload:  map[string]any{"card": map[string]any{"number": card["expiry"], "expiry": card["number"]}},
+			envelope: *envelope,
+			err:      encrypt.ErrFailedToDecrypt,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := encrypter.Decrypt(t.Context(), test.payload, test.envelope)
+			require.ErrorIs(t, err, test.err)
+		})
+	}
+}
+
+func TestRotate(t *testing.T) {
+	fields := map[string][]string{"transaction_approved": {"card.number"}}
+	path := writeKeyfile(t, "2025-06")
+
+	old, err := encrypt.NewKeyfile(path)
+	require.NoError(t, err)
+
+	encrypted, envelope, err := encrypt.New(old, fields).Encrypt(t.Context(), "transaction_approved", payload())
+	require.NoError(t, err)
+
+	// The new keyfile keeps the old key, to decrypt events not rotated yet
+	rotator := newEncrypter(t, fields, "2025-09", "2025-06")
+
+	rotated, rotatedEnvelope, err := rotator.Rotate(t.Context(), "transaction_approved", encrypted, envelope)
+	require.NoError(t, err)
+	assert.Equal(t, "2025-09", rotatedEnvelope.KeyID)
+	assert.NotEqual(t, encrypted, rotated)
+
+	decrypted, err := rotator.Decrypt(t.Context(), rotated, *rotatedEnvelope)
+	require.NoError(t, err)
+	assert.Equal(t, payload(), decrypted)
+
+	// Payloads saved before encryption are encrypted
+	rotated, rotatedEnvelope, err = rotator.Rotate(t.Context(), "transaction_approved", payload(), nil)
+	require.NoError(t, err)
+	require.NotNil(t, rotatedEnvelope)
+	assert.NotEqual(t, payload(), rotated)
+}
+
+func TestKeyfile(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString(make([]byte, 32))
+
+	testCases := map[string]struct {
+		content string
+		err     error
+	}{
+		"Valid": {
+			content: `{"current": "k1", "keys": {"k1": "` + key + `"}}`,
+		},
+		"Short Key": {
+			content: `{"current": "k1", "keys": {"k1": "` + base64.StdEncoding.EncodeToString(make([]byte, 16)) + `"}}`,
+			err:     encrypt.ErrFailedToLoadKeys,
+		},
+		"Not Base64": {
+			content: `{"current": "k1", "keys": {"k1": "not a key"}}`,
+			err:     encrypt.ErrFailedToLoadKeys,
+		},
+		"Unknown Current Key": {
+			content: `{"current": "k2", "keys": {"k1": "` + key + `"}}`,
+			err:     encrypt.ErrFailedToLoadKeys,
+		},
+		"Invalid JSON": {
+			content: `current: k1`,
+			err:     encrypt.ErrFailedToLoadKeys,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys.json")
+			require.NoError(t, os.WriteFile(path, []byte(test.content), 0o600))
+
+			keys, err := encrypt.NewKeyfile(path)
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, "k1", keys.CurrentKeyID())
+
+			_, err = keys.Key(t.Context(), "k2")
+			require.ErrorIs(t, err, encrypt.ErrUnknownKey)
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package encrypt
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+var (
+	ErrFailedToLoadKeys = errors.New("failed to load encryption keys")
+)
+
+// Keyfile provides keys from a local JSON file, e.g.
+//
+//	{"current": "2025-09", "keys": {"2025-09": "<base64>", "2025-06": "<base64>"}}
+//
+// Every key is 32 random bytes, base64 encoded. Keys still used by stored
+// events must be kept until they are rotated.
+type Keyfile struct {
+	current string
+	keys    map[string][]byte
+}
+
+func NewKeyfile(path string) (*Keyfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToLoadKeys, err)
+	}
+
+	var file struct {
+		Current string            `json:"current"`
+		Keys    map[string]string `json:"keys"`
+	}
+
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrFailedToLoadKeys, path, err)
+	}
+
+	keyfile := &Keyfile{
+		current: file.Current,
+		keys:    make(map[string][]byte, len(file.Keys)),
+	}
+
+	for id, encoded := range file.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != dataKeySize {
+			return nil, fmt.Errorf("%w: %s: key %q must be %d base64 encoded bytes", ErrFailedToLoadKeys, path, id, dataKeySize)
+		}
+
+		keyfile.keys[id] = key
+	}
+
+	if _, ok := keyfile.keys[keyfile.current]; !ok {
+		return nil, fmt.Errorf("%w: %s: current key %q isn't one of the keys", ErrFailedToLoadKeys, path, keyfile.current)
+	}
+
+	return keyfile, nil
+}
+
+func (k *Keyfile) CurrentKeyID() string {
+	return k.current
+}
+
+func (k *Keyfile) Key(_ context.Context, id string) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,97 @@
+package enrich
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/models"
+)
+
+var (
+	// ErrPermanent marks failures that retrying can't fix, the event is sent
+	// to the DLQ instead of being left on the queue.
+	ErrPermanent    = errors.New("permanent enrichment failure")
+	ErrUnknownStage = errors.New("unknown enrichment stage")
+)
+
+// Message describes the queue message an event was received in.
+type Message struct {
+	ID         string
+	ReceivedAt time.Time
+}
+
+// Stage enriches an event in place.
+type Stage interface {
+	Name() string
+	Enrich(ctx context.Context, event *models.Event, msg Message) error
+}
+
+type stageFunc struct {
+	name string
+	fn   func(ctx context.Context, event *models.Event, msg Message) error
+}
+
+// StageFunc adapts a function into a named Stage.
+func StageFunc(name string, fn func(ctx context.Context, event *models.Event, msg Message) error) Stage {
+	return stageFunc{name, fn}
+}
+
+func (s stageFunc) Name() string {
+	return s.name
+}
+
+func (s stageFunc) Enrich(ctx context.Context, event *models.Event, msg Message) error {
+	return s.fn(ctx, event, msg)
+}
+
+// Pipeline runs its stages in order, stopping at the first failure.
+type Pipeline []Stage
+
+func (p Pipeline) Enrich(ctx context.Context, event *models.Event, msg Message) error {
+	for _, stage := range p {
+		if err := stage.Enrich(ctx, event, msg); err != nil {
+			return fmt.Errorf("%s: %w", stage.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// New builds a pipeline from stage names in the order given.
+func New(names []string, clients ClientStore) (Pipeline, error) {
+	var (
+		pipeline Pipeline
+		errs     []error
+	)
+
+	for _, name := range names {
+		switch name {
+		case MessageMetadataStage:
+			pipeline = append(pipeline, MessageMetadata())
+		case NormalizeAmountStage:
+			pipeline = append(pipeline, NormalizeAmount())
+		case ClientMetadataStage:
+			pipeline = append(pipeline, ClientMetadata(clients))
+		case DerivedFieldsStage:
+			pipeline = append(pipeline, DerivedFields())
+		default:
+			errs = append(errs, fmt.Errorf("%w: %s", ErrUnknownStage, name))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return pipeline, nil
+}
+
+func setMetadata(event *models.Event, key string, value any) {
+	if event.Metadata == nil {
+		event.Metadata = make(map[string]any)
+	}
+
+	event.Metadata[key] = value
+}
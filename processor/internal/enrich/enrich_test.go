@@ -0,0 +1,208 @@
+package enrich_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/enrich"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type FakeClients map[string]models.Client
+
+func (c FakeClients) GetClient(_ context.Context, clientID string) (*models.Client, error) {
+	client, ok := c[clientID]
+	if !ok {
+		return nil, nil
+	}
+
+	return &client, nil
+}
+
+func TestPipeline(t *testing.T) {
+	type Test struct {
+		stages []string
+		input  models.Event
+		output models.Event
+		err    error
+	}
+
+	timestamp := time.Date(2025, 8, 18, 7, 48, 48, 0, time.UTC)
+	receivedAt := time.Date(2025, 8, 18, 7, 48, 50, 0, time.UTC)
+
+	clients := FakeClients{
+		"client_123": {ID: "client_123", Name: "Acme", Tier: "gold"},
+	}
+
+	testCases := map[string]Test{
+		"Message Metadata": {
+			stages: []string{enrich.MessageMetadataStage},
+			input: models.Event{
+				EventType: "transaction_approved",
+				ClientID:  "client_123",
+				Timestamp: timestamp,
+			},
+			output: models.Event{
+				EventType:  "transaction_approved",
+				ClientID:   "client_123",
+				Timestamp:  timestamp,
+				MessageID:  "msg-1",
+				ReceivedAt: receivedAt,
+			},
+		},
+		"Normalize Amount": {
+			stages: []string{enrich.NormalizeAmountStage},
+			input: models.Event{
+				Payload: map[string]any{"amount": " 176.1", "currency": "gbp "},
+			},
+			output: models.Event{
+				Payload: map[string]any{"amount": "176.10", "currency": "GBP"},
+			},
+		},
+		"Normalize Zero Decimal Currency": {
+			stages: []string{enrich.NormalizeAmountStage},
+			input: models.Event{
+				Payload: map[string]any{"amount": float64(1500), "currency": "jpy"},
+			},
+			output: models.Event{
+				Payload: map[string]any{"amount": "1500", "currency": "JPY"},
+			},
+		},
+		"Normalize Rounds Decimal Amounts": {
+			stages: []string{enrich.NormalizeAmountStage, enrich.DerivedFieldsStage},
+			input: models.Event{
+				Payload:   map[string]any{"amount": float64(1.005), "currency": "GBP"},
+				Timestamp: timestamp,
+			},
+			output: models.Event{
+				Payload:   map[string]any{"amount": "1.01", "currency": "GBP"},
+				Timestamp: timestamp,
+				Metadata: map[string]any{
+					"event_date":   "2025-08-18",
+					"amount_minor": int64(101),
+				},
+			},
+		},
+		"Normalize Three Decimal Currency": {
+			stages: []string{enrich.NormalizeAmountStage},
+			input: models.Event{
+				Payload: map[string]any{"amount": json.Number("-0.0285"), "currency": "kwd"},
+			},
+			output: models.Event{
+				Payload: map[string]any{"amount": "-0.029", "currency": "KWD"},
+			},
+		},
+		"Fraction Amount Is Permanent": {
+			stages: []string{enrich.NormalizeAmountStage},
+			input: models.Event{
+				Payload: map[string]any{"amount": "1/3", "currency": "GBP"},
+			},
+			err: enrich.ErrPermanent,
+		},
+		"Invalid Amount Is Permanent": {
+			stages: []string{enrich.NormalizeAmountStage},
+			input: models.Event{
+				Payload: map[string]any{"amount": "lots", "currency": "GBP"},
+			},
+			err: enrich.ErrPermanent,
+		},
+		"Client Metadata": {
+			stages: []string{enrich.ClientMetadataStage},
+			input: models.Event{
+				ClientID: "client_123",
+			},
+			output: models.Event{
+				ClientID: "client_123",
+				Metadata: map[string]any{
+					"client": models.Client{ID: "client_123", Name: "Acme", Tier: "gold"},
+				},
+			},
+		},
+		"Unknown Client Passes Through": {
+			stages: []string{enrich.ClientMetadataStage},
+			input: models.Event{
+				ClientID: "client_999",
+			},
+			output: models.Event{
+				ClientID: "client_999",
+			},
+		},
+		"Stages Run In Order": {
+			stages: []string{enrich.NormalizeAmountStage, enrich.DerivedFieldsStage},
+			input: models.Event{
+				Payload:   map[string]any{"amount": "12.345", "currency": "gbp"},
+				Timestamp: timestamp,
+			},
+			output: models.Event{
+				Payload:   map[string]any{"amount": "12.35", "currency": "GBP"},
+				Timestamp: timestamp,
+				Metadata: map[string]any{
+					"event_date":   "2025-08-18",
+					"amount_minor": int64(1235),
+				},
+			},
+		},
+	}
+
+	for scenario, test := range testCases {
+		t.Run(scenario, func(t *testing.T) {
+			pipeline, err := enrich.New(test.stages, clients)
+			require.NoError(t, err)
+
+			event := test.input
+
+			err = pipeline.Enrich(t.Context(), &event, enrich.Message{
+				ID:         "msg-1",
+				ReceivedAt: receivedAt,
+			})
+
+			if test.err != nil {
+				require.Error(t, err)
+				require.ErrorIs(t, err, test.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.output, event)
+		})
+	}
+}
+
+func TestPipelineStopsAtFirstFailure(t *testing.T) {
+	failure := errors.New("lookup failed")
+
+	var ran []string
+
+	pipeline := enrich.Pipeline{
+		enrich.StageFunc("first", func(context.Context, *models.Event, enrich.Message) error {
+			ran = append(ran, "first")
+
+			return failure
+		}),
+		enrich.StageFunc("second", func(context.Context, *models.Event, enrich.Message) error {
+			ran = append(ran, "second")
+
+			return nil
+		}),
+	}
+
+	err := pipeline.Enrich(t.Context(), &models.Event{}, enrich.Message{})
+
+	require.ErrorIs(t, err, failure)
+	assert.NotErrorIs(t, err, enrich.ErrPermanent)
+	assert.Contains(t, err.Error(), "first")
+	assert.Equal(t, []string{"first"}, ran)
+}
+
+func TestNewUnknownStage(t *testing.T) {
+	_, err := enrich.New([]string{"message_metadata", "geoip"}, FakeClients{})
+
+	require.ErrorIs(t, err, enrich.ErrUnknownStage)
+	assert.Contains(t, err.Error(), "geoip")
+}
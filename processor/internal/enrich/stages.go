@@ -0,0 +1,180 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	MessageMetadataStage = "message_metadata"
+	NormalizeAmountStage = "normalize_amount"
+	ClientMetadataStage  = "client_metadata"
+	DerivedFieldsStage   = "derived_fields"
+)
+
+// currencyExponents lists the currencies that don't use two minor units.
+var currencyExponents = map[string]int{
+	"BHD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"OMR": 3,
+}
+
+// ClientStore looks up client metadata, returning nil for unknown clients.
+type ClientStore interface {
+	GetClient(ctx context.Context, clientID string) (*models.Client, error)
+}
+
+// MessageMetadata records the SQS message ID and when it was received.
+func MessageMetadata() Stage {
+	return StageFunc(MessageMetadataStage, func(_ context.Context, event *models.Event, msg Message) error {
+		event.MessageID = msg.ID
+		event.ReceivedAt = msg.ReceivedAt.UTC()
+
+		return nil
+	})
+}
+
+// NormalizeAmount upper-cases the payload currency and rewrites the amount as
+// a decimal string with the currency's number of minor units.
+func NormalizeAmount() Stage {
+	return StageFunc(NormalizeAmountStage, func(_ context.Context, event *models.Event, _ Message) error {
+		payload, ok := event.Payload.(map[string]any)
+		if !ok {
+			return nil
+		}
+
+		currency, _ := payload["currency"].(string)
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+
+		if currency != "" {
+			payload["currency"] = currency
+		}
+
+		raw, ok := payload["amount"]
+		if !ok {
+			return nil
+		}
+
+		amount, err := parseAmount(raw)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrPermanent, err)
+		}
+
+		payload["amount"] = amount.FloatString(exponent(currency))
+
+		return nil
+	})
+}
+
+// ClientMetadata attaches the client's name, tier and metadata from the
+// clients table. Events of unknown clients pass through unchanged.
+func ClientMetadata(clients ClientStore) Stage {
+	return StageFunc(ClientMetadataStage, func(ctx context.Context, event *models.Event, _ Message) error {
+		client, err := clients.GetClient(ctx, event.ClientID)
+		if err != nil {
+			return err
+		}
+
+		if client == nil {
+			log.Debug().Str("client_id", event.ClientID).Msg("no metadata for client")
+
+			return nil
+		}
+
+		setMetadata(event, "client", *client)
+
+		return nil
+	})
+}
+
+// DerivedFields computes fields derived from the payload and envelope, such
+// as the amount in minor units and the UTC date of the event.
+func DerivedFields() Stage {
+	return StageFunc(DerivedFieldsStage, func(_ context.Context, event *models.Event, _ Message) error {
+		setMetadata(event, "event_date", event.Timestamp.UTC().Format("2006-01-02"))
+
+		payload, ok := event.Payload.(map[string]any)
+		if !ok {
+			return nil
+		}
+
+		raw, ok := payload["amount"]
+		if !ok {
+			return nil
+		}
+
+		amount, err := parseAmount(raw)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrPermanent, err)
+		}
+
+		currency, _ := payload["currency"].(string)
+
+		minor, err := minorUnits(amount, exponent(currency))
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrPermanent, err)
+		}
+
+		setMetadata(event, "amount_minor", minor)
+
+		return nil
+	})
+}
+
+// parseAmount parses the amount as an exact decimal. JSON numbers are read
+// back from their shortest representation, which is the number as it was
+// sent.
+func parseAmount(raw any) (*big.Rat, error) {
+	var text string
+
+	switch v := raw.(type) {
+	case float64:
+		text = strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		text = v.String()
+	case string:
+		text = strings.TrimSpace(v)
+	default:
+		return nil, fmt.Errorf("invalid amount %v", raw)
+	}
+
+	// Rat also parses fractions, which aren't amounts
+	amount, ok := new(big.Rat).SetString(text)
+	if !ok || strings.Contains(text, "/") {
+		return nil, fmt.Errorf("invalid amount %q", text)
+	}
+
+	return amount, nil
+}
+
+// minorUnits returns the amount in the currency's minor units, rounded half
+// away from zero.
+func minorUnits(amount *big.Rat, exp int) (int64, error) {
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exp)), nil)
+
+	scaled := new(big.Rat).Mul(amount, new(big.Rat).SetInt(scale))
+
+	minor, err := strconv.ParseInt(scaled.FloatString(0), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("amount %s out of range", amount.FloatString(exp))
+	}
+
+	return minor, nil
+}
+
+func exponent(currency string) int {
+	if exp, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return exp
+	}
+
+	return 2
+}
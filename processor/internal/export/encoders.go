@@ -0,0 +1,303 @@
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/parquet-go/parquet-go"
+)
+
+// DefaultColumns are the CSV columns used when none are configured. Columns
+// prefixed with payload. or metadata. flatten a, possibly nested, field of
+// the payload or metadata into its own column.
+var DefaultColumns = []string{
+	"id", "event_type", "client_id", "timestamp", "priority", "category", "schema_version", "payload",
+}
+
+// parquetRowGroupSize bounds the rows a Parquet writer buffers before
+// flushing them to the file.
+const parquetRowGroupSize = 10000
+
+type encoder interface {
+	Write(event models.Event) error
+	Close() error
+}
+
+// bufferingEncoder is an encoder holding rows back from the file, such as the
+// rows of a Parquet row group that isn't written yet.
+type bufferingEncoder interface {
+	encoder
+	// Buffered estimates the bytes the buffered rows take in the file.
+	Buffered() int64
+	// Flush writes the buffered rows to the file.
+	Flush() error
+}
+
+type ndjsonEncoder struct {
+	encoder *json.Encoder
+}
+
+func newNDJSONEncoder(w io.Writer) *ndjsonEncoder {
+	return &ndjsonEncoder{encoder: json.NewEncoder(w)}
+}
+
+func (e *ndjsonEncoder) Write(event models.Event) error {
+	return e.encoder.Encode(event)
+}
+
+func (e *ndjsonEncoder) Close() error {
+	return nil
+}
+
+type csvEncoder struct {
+	writer  *csv.Writer
+	columns []string
+	record  []string
+}
+
+func newCSVEncoder(w io.Writer, columns []string) (*csvEncoder, error) {
+	for _, column := range columns {
+		if _, ok := field(models.Event{}, column); !ok && !isPathColumn(column) {
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+	}
+
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(columns); err != nil {
+		return nil, err
+	}
+
+	return &csvEncoder{
+		writer:  writer,
+		columns: columns,
+		record:  make([]string, len(columns)),
+	}, nil
+}
+
+func (e *csvEncoder) Write(event models.Event) error {
+	for i, column := range e.columns {
+		value, _ := field(event, column)
+
+		text, err := format(value)
+		if err != nil {
+			return fmt.Errorf("column %s: %w", column, err)
+		}
+
+		e.record[i] = text
+	}
+
+	return e.writer.Write(e.record)
+}
+
+func (e *csvEncoder) Close() error {
+	e.writer.Flush()
+
+	return e.writer.Error()
+}
+
+// field returns the value of an event column, ok is false for unknown ones.
+func field(event models.Event, column string) (any, bool) {
+	switch column {
+	case "id":
+		return event.ID, true
+	case "event_type":
+		return event.EventType, true
+	case "client_id":
+		return event.ClientID, true
+	case "payload":
+		return event.Payload, true
+	case "timestamp":
+		return event.Timestamp, true
+	case "priority":
+		return event.Priority, true
+	case "category":
+		return event.Category, true
+	case "schema_version":
+		return event.SchemaVersion, true
+	case "message_id":
+		return event.MessageID, true
+	case "received_at":
+		return event.ReceivedAt, true
+	case "metadata":
+		return event.Metadata, true
+	}
+
+	if path, ok := strings.CutPrefix(column, "payload."); ok {
+		return lookup(event.Payload, path)
+	}
+
+	if path, ok := strings.CutPrefix(column, "metadata."); ok {
+		return lookup(event.Metadata, path)
+	}
+
+	return nil, false
+}
+
+func isPathColumn(column string) bool {
+	return strings.HasPrefix(column, "payload.") || strings.HasPrefix(column, "metadata.")
+}
+
+func lookup(value any, path string) (any, bool) {
+	for _, key := range strings.Split(path, ".") {
+		fields, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+
+		if value, ok = fields[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+// format renders a value as a CSV cell, objects and arrays as JSON.
+func format(value any) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case int:
+		return strconv.Itoa(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		if v.IsZero() {
+			return "", nil
+		}
+
+		return v.UTC().Format(time.RFC3339Nano), nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// parquetRow is the Parquet schema of exported events, the payload and
+// metadata are kept as JSON.
+type parquetRow struct {
+	ID            int64     `parquet:"id"`
+	EventType     string    `parquet:"event_type"`
+	ClientID      string    `parquet:"client_id"`
+	Payload       string    `parquet:"payload,json"`
+	Timestamp     time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	Priority      string    `parquet:"priority,optional"`
+	Category      string    `parquet:"category,optional"`
+	SchemaVersion int32     `parquet:"schema_version"`
+	MessageID     string    `parquet:"message_id,optional"`
+	ReceivedAt    time.Time `parquet:"received_at,optional,timestamp(millisecond)"`
+	Metadata      string    `parquet:"metadata,optional,json"`
+}
+
+type parquetEncoder struct {
+	writer *parquet.GenericWriter[parquetRow]
+	row    []parquetRow
+	// rows and buffered are the count and uncompressed size of the rows of
+	// the current row group, which take less in the file once encoded
+	rows     int
+	buffered int64
+}
+
+func newParquetEncoder(w io.Writer, compression string) *parquetEncoder {
+	opts := []parquet.WriterOption{
+		parquet.MaxRowsPerRowGroup(parquetRowGroupSize),
+		// Write straight through to the export file's buffer, so flushed row
+		// groups count towards its size
+		parquet.WriteBufferSize(-1),
+	}
+
+	switch compression {
+	case CompressionGzip:
+		opts = append(opts, parquet.Compression(&parquet.Gzip))
+	case CompressionZstd:
+		opts = append(opts, parquet.Compression(&parquet.Zstd))
+	}
+
+	return &parquetEncoder{
+		writer: parquet.NewGenericWriter[parquetRow](w, opts...),
+		row:    make([]parquetRow, 1),
+	}
+}
+
+func (e *parquetEncoder) Write(event models.Event) error {
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return err
+	}
+
+	var metadata []byte
+
+	if len(event.Metadata) > 0 {
+		if metadata, err = json.Marshal(event.Metadata); err != nil {
+			return err
+		}
+	}
+
+	e.row[0] = parquetRow{
+		ID:            event.ID,
+		EventType:     event.EventType,
+		ClientID:      event.ClientID,
+		Payload:       string(payload),
+		Timestamp:     event.Timestamp.UTC(),
+		Priority:      event.Priority,
+		Category:      event.Category,
+		SchemaVersion: int32(event.SchemaVersion),
+		MessageID:     event.MessageID,
+		ReceivedAt:    event.ReceivedAt.UTC(),
+		Metadata:      string(metadata),
+	}
+
+	if _, err = e.writer.Write(e.row); err != nil {
+		return err
+	}
+
+	e.rows++
+	e.buffered += rowSize(e.row[0])
+
+	// The writer flushes full row groups itself
+	if e.rows == parquetRowGroupSize {
+		e.rows, e.buffered = 0, 0
+	}
+
+	return nil
+}
+
+func (e *parquetEncoder) Buffered() int64 {
+	return e.buffered
+}
+
+func (e *parquetEncoder) Flush() error {
+	e.rows, e.buffered = 0, 0
+
+	return e.writer.Flush()
+}
+
+func (e *parquetEncoder) Close() error {
+	return e.writer.Close()
+}
+
+// rowSize is the size of row's values before encoding and compression.
+func rowSize(row parquetRow) int64 {
+	// id, schema_version and the two timestamps
+	const fixed = 8 + 4 + 8 + 8
+
+	return int64(fixed + len(row.EventType) + len(row.ClientID) + len(row.Payload) + len(row.Priority) +
+		len(row.Category) + len(row.MessageID) + len(row.Metadata))
+}
@@ -0,0 +1,299 @@
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/EWK20/event-processor/processor/internal/db"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrUnsupportedFormat      = errors.New("unsupported export format")
+	ErrUnsupportedCompression = errors.New("unsupported export compression")
+	ErrFailedToWrite          = errors.New("failed to write export")
+)
+
+const (
+	FormatNDJSON  = "ndjson"
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+
+	defaultBatchSize = 1000
+)
+
+var (
+	Formats      = []string{FormatNDJSON, FormatCSV, FormatParquet}
+	Compressions = []string{CompressionNone, CompressionGzip, CompressionZstd}
+)
+
+type Source interface {
+	Events(ctx context.Context, filter db.Filter, afterID int64, limit int) ([]models.Event, error)
+}
+
+// Result lists the files written and how many events they hold.
+type Result struct {
+	Files  []string
+	Events int64
+}
+
+// Exporter streams stored events to files, one page of events at a time so
+// memory use doesn't grow with the size of the export.
+type Exporter struct {
+	source Source
+	format string
+
+	filter      db.Filter
+	columns     []string
+	compression string
+	maxFileSize int64
+	batchSize   int
+}
+
+func New(source Source, format string, opts ...Option) (*Exporter, error) {
+	exporter := &Exporter{
+		source:      source,
+		format:      format,
+		columns:     DefaultColumns,
+		compression: CompressionNone,
+		batchSize:   defaultBatchSize,
+	}
+
+	for _, opt := range opts {
+		opt(exporter)
+	}
+
+	if !slices.Contains(Formats, exporter.format) {
+		return nil, fmt.Errorf("%w: %q is not one of %v", ErrUnsupportedFormat, exporter.format, Formats)
+	}
+
+	if !slices.Contains(Compressions, exporter.compression) {
+		return nil, fmt.Errorf("%w: %q is not one of %v", ErrUnsupportedCompression, exporter.compression, Compressions)
+	}
+
+	return exporter, nil
+}
+
+// Run exports the selected events to files named after prefix. With a
+// maximum file size, a new numbered file is started once the current one
+// reaches it.
+func (e *Exporter) Run(ctx context.Context, prefix string) (Result, error) {
+	var (
+		result  Result
+		current *file
+		afterID int64
+	)
+
+	for {
+		events, err := e.source.Events(ctx, e.filter, afterID, e.batchSize)
+		if err != nil {
+			return result, errors.Join(err, current.close())
+		}
+
+		if len(events) == 0 {
+			break
+		}
+
+		for _, event := range events {
+			if current == nil {
+				current, err = e.create(e.fileName(prefix, len(result.Files)+1))
+				if err != nil {
+					return result, err
+				}
+
+				result.Files = append(result.Files, current.name)
+			}
+
+			if err := current.encoder.Write(event); err != nil {
+				return result, errors.Join(fmt.Errorf("%w: %s: %w", ErrFailedToWrite, current.name, err), current.close())
+			}
+
+			result.Events++
+
+			full, err := current.full(e.maxFileSize)
+			if err != nil {
+				return result, errors.Join(fmt.Errorf("%w: %s: %w", ErrFailedToWrite, current.name, err), current.close())
+			}
+
+			if full {
+				if err := current.close(); err != nil {
+					return result, err
+				}
+
+				log.Debug().Str("file", current.name).Msg("rotated export file")
+
+				current = nil
+			}
+		}
+
+		afterID = events[len(events)-1].ID
+	}
+
+	// An empty selection still produces a file, so a missing file means a
+	// failed export
+	if len(result.Files) == 0 {
+		current, err := e.create(e.fileName(prefix, 1))
+		if err != nil {
+			return result, err
+		}
+
+		result.Files = append(result.Files, current.name)
+
+		return result, current.close()
+	}
+
+	return result, current.close()
+}
+
+func (e *Exporter) fileName(prefix string, n int) string {
+	name := prefix
+	if e.maxFileSize > 0 {
+		name = fmt.Sprintf("%s-%05d", prefix, n)
+	}
+
+	name += "." + e.format
+
+	// Parquet compresses its pages itself, the file can't be wrapped
+	if e.format == FormatParquet {
+		return name
+	}
+
+	switch e.compression {
+	case CompressionGzip:
+		name += ".gz"
+	case CompressionZstd:
+		name += ".zst"
+	}
+
+	return name
+}
+
+// file is an export file being written, encoder -> compressor -> buffer ->
+// counter -> os.File.
+type file struct {
+	name       string
+	f          *os.File
+	counter    *countingWriter
+	buffer     *bufio.Writer
+	compressor io.WriteCloser
+	encoder    encoder
+}
+
+func (e *Exporter) create(name string) (*file, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToWrite, err)
+	}
+
+	out := &file{
+		name:    name,
+		f:       f,
+		counter: &countingWriter{w: f},
+	}
+	out.buffer = bufio.NewWriter(out.counter)
+
+	var w io.Writer = out.buffer
+
+	if e.format != FormatParquet {
+		switch e.compression {
+		case CompressionGzip:
+			out.compressor = gzip.NewWriter(out.buffer)
+		case CompressionZstd:
+			out.compressor, err = zstd.NewWriter(out.buffer)
+			if err != nil {
+				f.Close()
+
+				return nil, fmt.Errorf("%w: %w", ErrFailedToWrite, err)
+			}
+		}
+
+		if out.compressor != nil {
+			w = out.compressor
+		}
+	}
+
+	switch e.format {
+	case FormatNDJSON:
+		out.encoder = newNDJSONEncoder(w)
+	case FormatCSV:
+		out.encoder, err = newCSVEncoder(w, e.columns)
+	case FormatParquet:
+		out.encoder = newParquetEncoder(w, e.compression)
+	}
+
+	if err != nil {
+		f.Close()
+		os.Remove(name)
+
+		return nil, fmt.Errorf("%w: %s: %w", ErrFailedToWrite, name, err)
+	}
+
+	return out, nil
+}
+
+// size is the number of bytes written to the file so far, compressed data
+// still buffered by the encoder or compressor isn't counted yet.
+func (f *file) size() int64 {
+	return f.counter.n + int64(f.buffer.Buffered())
+}
+
+// full reports whether the file reached maxSize bytes, files without a
+// maximum size are never full. Rows buffered by the encoder are flushed once
+// they could take the file past maxSize, so a Parquet file is rotated near
+// maxSize rather than a whole row group after it.
+func (f *file) full(maxSize int64) (bool, error) {
+	if maxSize <= 0 {
+		return false, nil
+	}
+
+	if encoder, ok := f.encoder.(bufferingEncoder); ok && f.size() < maxSize && f.size()+encoder.Buffered() >= maxSize {
+		if err := encoder.Flush(); err != nil {
+			return false, err
+		}
+	}
+
+	return f.size() >= maxSize, nil
+}
+
+func (f *file) close() error {
+	if f == nil {
+		return nil
+	}
+
+	err := f.encoder.Close()
+
+	if f.compressor != nil {
+		err = errors.Join(err, f.compressor.Close())
+	}
+
+	err = errors.Join(err, f.buffer.Flush(), f.f.Close())
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", ErrFailedToWrite, f.name, err)
+	}
+
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+
+	return n, err
+}
@@ -0,0 +1,278 @@
+package export_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/db"
+	"github.com/EWK20/event-processor/processor/internal/export"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct {
+	events []models.Event
+	// pages counts the calls, so tests can check events are read in pages
+	pages int
+}
+
+func (s *fakeSource) Events(_ context.Context, filter db.Filter, afterID int64, limit int) ([]models.Event, error) {
+	s.pages++
+
+	var events []models.Event
+
+	for _, event := range s.events {
+		if event.ID > afterID && (filter.ClientID == "" || event.ClientID == filter.ClientID) && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func newEvents(n int) []models.Event {
+	clientIDs := []string{"client_123", "client_456"}
+
+	events := make([]models.Event, 0, n)
+
+	for i := range n {
+		events = append(events, models.Event{
+			ID:        int64(i + 1),
+			EventType: "transaction_approved",
+			ClientID:  clientIDs[i%len(clientIDs)],
+			Payload: map[string]any{
+				"transaction_id": "txn_1",
+				"amount":         "10.00",
+				"currency":       "GBP",
+				"card":           map[string]any{"country": "GB"},
+			},
+			Timestamp:     time.Date(2025, 8, 18, 7, 48, 48, 0, time.UTC),
+			SchemaVersion: 1,
+			Metadata:      map[string]any{"event_date": "2025-08-18"},
+		})
+	}
+
+	return events
+}
+
+func TestNDJSON(t *testing.T) {
+	type Test struct {
+		compression string
+		file        string
+	}
+
+	testCases := map[string]Test{
+		"Uncompressed": {compression: export.CompressionNone, file: "events.ndjson"},
+		"Gzip":         {compression: export.CompressionGzip, file: "events.ndjson.gz"},
+		"Zstd":         {compression: export.CompressionZstd, file: "events.ndjson.zst"},
+	}
+
+	for scenario, test := range testCases {
+		t.Run(scenario, func(t *testing.T) {
+			dir := t.TempDir()
+			source := &fakeSource{events: newEvents(5)}
+
+			exporter, err := export.New(source, export.FormatNDJSON,
+				export.WithCompression(test.compression),
+				export.WithFilter(db.Filter{ClientID: "client_123"}),
+				export.WithBatchSize(2),
+			)
+			require.NoError(t, err)
+
+			result, err := exporter.Run(t.Context(), filepath.Join(dir, "events"))
+			require.NoError(t, err)
+			assert.Equal(t, export.Result{Files: []string{filepath.Join(dir, test.file)}, Events: 3}, result)
+
+			// 2 full pages and the empty one ending the export
+			assert.Equal(t, 3, source.pages)
+
+			var ids []int64
+
+			scanner := bufio.NewScanner(open(t, result.Files[0], test.compression))
+			for scanner.Scan() {
+				var event models.Event
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+
+				assert.Equal(t, "client_123", event.ClientID)
+				ids = append(ids, event.ID)
+			}
+
+			require.NoError(t, scanner.Err())
+			assert.Equal(t, []int64{1, 3, 5}, ids)
+		})
+	}
+}
+
+func TestCSV(t *testing.T) {
+	dir := t.TempDir()
+
+	exporter, err := export.New(&fakeSource{events: newEvents(2)}, export.FormatCSV,
+		export.WithColumns([]string{"id", "client_id", "timestamp", "payload.amount", "payload.card.country", "payload.card", "metadata.event_date", "payload.missing"}),
+		export.WithCompression(export.CompressionGzip),
+	)
+	require.NoError(t, err)
+
+	result, err := exporter.Run(t.Context(), filepath.Join(dir, "events"))
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "events.csv.gz")}, result.Files)
+
+	records, err := csv.NewReader(open(t, result.Files[0], export.CompressionGzip)).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"id", "client_id", "timestamp", "payload.amount", "payload.card.country", "payload.card", "metadata.event_date", "payload.missing"},
+		{"1", "client_123", "2025-08-18T07:48:48Z", "10.00", "GB", `{"country":"GB"}`, "2025-08-18", ""},
+		{"2", "client_456", "2025-08-18T07:48:48Z", "10.00", "GB", `{"country":"GB"}`, "2025-08-18", ""},
+	}, records)
+}
+
+func TestParquet(t *testing.T) {
+	dir := t.TempDir()
+
+	exporter, err := export.New(&fakeSource{events: newEvents(3)}, export.FormatParquet, export.WithCompression(export.CompressionZstd))
+	require.NoError(t, err)
+
+	result, err := exporter.Run(t.Context(), filepath.Join(dir, "events"))
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "events.parquet")}, result.Files)
+
+	type row struct {
+		ID        int64     `parquet:"id"`
+		ClientID  string    `parquet:"client_id"`
+		Payload   string    `parquet:"payload"`
+		Timestamp time.Time `parquet:"timestamp,timestamp(millisecond)"`
+		Priority  string    `parquet:"priority,optional"`
+	}
+
+	rows, err := parquet.ReadFile[row](result.Files[0])
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, int64(2), rows[1].ID)
+	assert.Equal(t, "client_456", rows[1].ClientID)
+	assert.JSONEq(t, `{"transaction_id":"txn_1","amount":"10.00","currency":"GBP","card":{"country":"GB"}}`, rows[1].Payload)
+	assert.True(t, time.Date(2025, 8, 18, 7, 48, 48, 0, time.UTC).Equal(rows[1].Timestamp))
+	assert.Empty(t, rows[1].Priority)
+}
+
+func TestRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	exporter, err := export.New(&fakeSource{events: newEvents(10)}, export.FormatNDJSON, export.WithMaxFileSize(500))
+	require.NoError(t, err)
+
+	result, err := exporter.Run(t.Context(), filepath.Join(dir, "events"))
+	require.NoError(t, err)
+	require.Greater(t, len(result.Files), 1)
+	assert.Equal(t, filepath.Join(dir, "events-00001.ndjson"), result.Files[0])
+	assert.Equal(t, int64(10), result.Events)
+
+	lines := 0
+
+	for _, name := range result.Files {
+		info, err := os.Stat(name)
+		require.NoError(t, err)
+
+		// Files are rotated after the event crossing the limit
+		assert.Less(t, info.Size(), int64(1000))
+
+		scanner := bufio.NewScanner(open(t, name, export.CompressionNone))
+		for scanner.Scan() {
+			lines++
+		}
+	}
+
+	assert.Equal(t, 10, lines)
+}
+
+func TestParquetRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	exporter, err := export.New(&fakeSource{events: newEvents(300)}, export.FormatParquet, export.WithMaxFileSize(8000))
+	require.NoError(t, err)
+
+	result, err := exporter.Run(t.Context(), filepath.Join(dir, "events"))
+	require.NoError(t, err)
+	require.Greater(t, len(result.Files), 1)
+
+	rows := 0
+
+	for _, name := range result.Files {
+		info, err := os.Stat(name)
+		require.NoError(t, err)
+
+		// Row groups are flushed as the limit is reached instead of after
+		// thousands of rows, only the footer goes past it
+		assert.Less(t, info.Size(), int64(16000))
+
+		read, err := parquet.ReadFile[struct {
+			ID int64 `parquet:"id"`
+		}](name)
+		require.NoError(t, err)
+
+		rows += len(read)
+	}
+
+	assert.Equal(t, 300, rows)
+}
+
+func TestEmptyExport(t *testing.T) {
+	dir := t.TempDir()
+
+	exporter, err := export.New(&fakeSource{}, export.FormatCSV)
+	require.NoError(t, err)
+
+	result, err := exporter.Run(t.Context(), filepath.Join(dir, "events"))
+	require.NoError(t, err)
+	assert.Equal(t, export.Result{Files: []string{filepath.Join(dir, "events.csv")}}, result)
+
+	records, err := csv.NewReader(open(t, result.Files[0], export.CompressionNone)).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{export.DefaultColumns}, records)
+}
+
+func TestInvalidExport(t *testing.T) {
+	_, err := export.New(&fakeSource{}, "xml")
+	require.ErrorIs(t, err, export.ErrUnsupportedFormat)
+
+	_, err = export.New(&fakeSource{}, export.FormatCSV, export.WithCompression("lz4"))
+	require.ErrorIs(t, err, export.ErrUnsupportedCompression)
+
+	exporter, err := export.New(&fakeSource{events: newEvents(1)}, export.FormatCSV, export.WithColumns([]string{"amount"}))
+	require.NoError(t, err)
+
+	_, err = exporter.Run(t.Context(), filepath.Join(t.TempDir(), "events"))
+	require.ErrorIs(t, err, export.ErrFailedToWrite)
+}
+
+func open(t *testing.T, name, compression string) *bufio.Reader {
+	t.Helper()
+
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+
+	switch compression {
+	case export.CompressionGzip:
+		r, err := gzip.NewReader(f)
+		require.NoError(t, err)
+
+		return bufio.NewReader(r)
+	case export.CompressionZstd:
+		r, err := zstd.NewReader(f)
+		require.NoError(t, err)
+		t.Cleanup(r.Close)
+
+		return bufio.NewReader(r)
+	}
+
+	return bufio.NewReader(f)
+}
@@ -0,0 +1,46 @@
+package export
+
+import "github.com/EWK20/event-processor/processor/internal/db"
+
+type Option func(*Exporter)
+
+// WithFilter selects the events to export, every event is exported otherwise.
+func WithFilter(filter db.Filter) Option {
+	return func(e *Exporter) {
+		e.filter = filter
+	}
+}
+
+// WithColumns sets the CSV columns, see DefaultColumns.
+func WithColumns(columns []string) Option {
+	return func(e *Exporter) {
+		if len(columns) > 0 {
+			e.columns = columns
+		}
+	}
+}
+
+// WithCompression compresses NDJSON and CSV files, or the pages of Parquet
+// files, with gzip or zstd.
+func WithCompression(compression string) Option {
+	return func(e *Exporter) {
+		if compression != "" {
+			e.compression = compression
+		}
+	}
+}
+
+// WithMaxFileSize starts a new file once the current one reaches size bytes,
+// 0 writes a single file.
+func WithMaxFileSize(size int64) Option {
+	return func(e *Exporter) {
+		e.maxFileSize = max(size, 0)
+	}
+}
+
+// WithBatchSize sets how many events are read from the database at a time.
+func WithBatchSize(size int) Option {
+	return func(e *Exporter) {
+		e.batchSize = max(size, 1)
+	}
+}
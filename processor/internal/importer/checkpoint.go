@@ -0,0 +1,87 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog/log"
+)
+
+// checkpoint records the progress of an import after its last saved batch.
+type checkpoint struct {
+	File string `json:"file"`
+	Progress
+}
+
+func (i *Importer) loadCheckpoint(path string) (checkpoint, error) {
+	file, err := filepath.Abs(path)
+	if err != nil {
+		return checkpoint{}, fmt.Errorf("%w: %w", ErrFailedToReadCheckpoint, err)
+	}
+
+	state := checkpoint{File: file}
+
+	if i.checkpoint == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(i.checkpoint)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("%w: %w", ErrFailedToReadCheckpoint, err)
+	}
+
+	var saved checkpoint
+
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return state, fmt.Errorf("%w: %s: %w", ErrFailedToReadCheckpoint, i.checkpoint, err)
+	}
+
+	if saved.File != state.File {
+		return state, fmt.Errorf("%w: %s is for %s", ErrCheckpointMismatch, i.checkpoint, saved.File)
+	}
+
+	log.Info().Str("checkpoint", i.checkpoint).Int64("offset", saved.Offset).Int64("records", saved.Records).Msg("resuming import from checkpoint")
+
+	return saved, nil
+}
+
+// saveCheckpoint replaces the checkpoint file atomically so an interrupted
+// write can't corrupt it.
+func (i *Importer) saveCheckpoint(state checkpoint) error {
+	if i.checkpoint == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToWriteCheckpoint, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(i.checkpoint), filepath.Base(i.checkpoint)+".*")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToWriteCheckpoint, err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("%w: %w", ErrFailedToWriteCheckpoint, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToWriteCheckpoint, err)
+	}
+
+	if err := os.Rename(tmp.Name(), i.checkpoint); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToWriteCheckpoint, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,336 @@
+package importer
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/EWK20/event-processor/processor/internal/redact"
+	"github.com/EWK20/event-processor/processor/internal/schema"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrUnsupportedFormat       = errors.New("unsupported import format")
+	ErrInvalidEvent            = errors.New("event is invalid")
+	ErrFailedToRead            = errors.New("failed to read import file")
+	ErrFailedToWriteRejects    = errors.New("failed to write rejected records")
+	ErrFailedToReadCheckpoint  = errors.New("failed to read checkpoint")
+	ErrFailedToWriteCheckpoint = errors.New("failed to write checkpoint")
+	ErrCheckpointMismatch      = errors.New("checkpoint belongs to a different import")
+)
+
+const (
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+
+	defaultBatchSize = 1000
+)
+
+var Formats = []string{FormatNDJSON, FormatCSV}
+
+type Store interface {
+	// SaveBatchRedacted saves the events with the result of their
+	// redaction, in one transaction.
+	SaveBatchRedacted(ctx context.Context, events []models.Event, redacted redact.Result) (int64, error)
+}
+
+type Redactor interface {
+	Redact(event *models.Event, messageID string) (redact.Result, error)
+}
+
+// Progress describes how far an import got, it is reported after every batch.
+type Progress struct {
+	Offset   int64
+	Size     int64
+	Records  int64
+	Imported int64
+	Rejected int64
+}
+
+// Importer bulk inserts the events of a file, validating them as events
+// received from the queue are.
+type Importer struct {
+	store    Store
+	registry *schema.Registry
+	format   string
+
+	batchSize  int
+	rejects    string
+	checkpoint string
+	progress   func(Progress)
+	redactor   Redactor
+	// eventTypes are the event types accepted, any type is when empty.
+	eventTypes map[string]bool
+}
+
+func New(store Store, registry *schema.Registry, opts ...Option) *Importer {
+	importer := &Importer{
+		store:     store,
+		registry:  registry,
+		batchSize: defaultBatchSize,
+		progress:  func(Progress) {},
+	}
+
+	for _, opt := range opts {
+		opt(importer)
+	}
+
+	return importer
+}
+
+// Run imports the file at path. Records are upcast and validated, valid ones
+// are saved with COPY a batch at a time and rejected ones written to the
+// rejects file with the reason. With a checkpoint, an interrupted import
+// resumes after the last saved batch. The checkpoint is written after its
+// batch is saved, so imports are at-least-once: a batch saved just before an
+// interruption is imported again on resume.
+func (i *Importer) Run(ctx context.Context, path string) (Progress, error) {
+	format, err := i.formatOf(path)
+	if err != nil {
+		return Progress{}, err
+	}
+
+	state, err := i.loadCheckpoint(path)
+	if err != nil {
+		return Progress{}, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return state.Progress, fmt.Errorf("%w: %w", ErrFailedToRead, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return state.Progress, fmt.Errorf("%w: %w", ErrFailedToRead, err)
+	}
+
+	if state.Offset > info.Size() {
+		return state.Progress, fmt.Errorf("%w: %s is smaller than its checkpoint", ErrCheckpointMismatch, path)
+	}
+
+	state.Size = info.Size()
+
+	var records reader
+
+	switch format {
+	case FormatNDJSON:
+		records, err = newNDJSONReader(f, state.Offset)
+	case FormatCSV:
+		records, err = newCSVReader(f, state.Offset)
+	}
+
+	if err != nil {
+		return state.Progress, fmt.Errorf("%w: %s: %w", ErrFailedToRead, path, err)
+	}
+
+	rejects, err := i.openRejects(state.Offset > 0)
+	if err != nil {
+		return state.Progress, err
+	}
+	defer rejects.close()
+
+	var (
+		batch    []models.Event
+		redacted redact.Result
+		pending  int
+	)
+
+	flush := func() error {
+		saved, err := i.store.SaveBatchRedacted(ctx, batch, redacted)
+		if err != nil {
+			return err
+		}
+
+		if err := rejects.flush(); err != nil {
+			return err
+		}
+
+		state.Imported += saved
+		state.Offset = records.offset()
+
+		if err := i.saveCheckpoint(state); err != nil {
+			return err
+		}
+
+		i.progress(state.Progress)
+
+		batch, redacted, pending = batch[:0], redact.Result{}, 0
+
+		return nil
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return state.Progress, err
+		}
+
+		rec, err := records.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return state.Progress, fmt.Errorf("%w: %s: %w", ErrFailedToRead, path, err)
+		}
+
+		state.Records++
+		pending++
+
+		if err := i.prepare(&rec, &redacted); err != nil {
+			state.Rejected++
+
+			if err := rejects.write(state.Records, rec.raw, err); err != nil {
+				return state.Progress, err
+			}
+		} else {
+			batch = append(batch, rec.event)
+		}
+
+		if pending == i.batchSize {
+			if err := flush(); err != nil {
+				return state.Progress, err
+			}
+		}
+	}
+
+	if pending > 0 {
+		if err := flush(); err != nil {
+			return state.Progress, err
+		}
+	}
+
+	return state.Progress, nil
+}
+
+// prepare validates the record and redacts its event, adding the result of
+// the redaction to redacted.
+func (i *Importer) prepare(rec *record, redacted *redact.Result) error {
+	if err := i.validate(rec); err != nil {
+		return err
+	}
+
+	if i.redactor == nil {
+		return nil
+	}
+
+	result, err := i.redactor.Redact(&rec.event, rec.event.MessageID)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+	}
+
+	redacted.Merge(result)
+
+	return nil
+}
+
+// validate applies the envelope and schema rules of the queue path.
+func (i *Importer) validate(rec *record) error {
+	if rec.err != nil {
+		return rec.err
+	}
+
+	if err := i.registry.Upcast(&rec.event); err != nil {
+		return err
+	}
+
+	if problems := rec.event.Problems(); len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidEvent, strings.Join(problems, ", "))
+	}
+
+	if len(i.eventTypes) > 0 && !i.eventTypes[rec.event.EventType] {
+		return fmt.Errorf("%w: unknown event_type %q", ErrInvalidEvent, rec.event.EventType)
+	}
+
+	return nil
+}
+
+func (i *Importer) formatOf(path string) (string, error) {
+	format := i.format
+
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".ndjson", ".jsonl":
+			format = FormatNDJSON
+		case ".csv":
+			format = FormatCSV
+		}
+	}
+
+	if !slices.Contains(Formats, format) {
+		return "", fmt.Errorf("%w: %s: %q is not one of %v", ErrUnsupportedFormat, path, format, Formats)
+	}
+
+	return format, nil
+}
+
+// rejectsFile writes rejected records as NDJSON, buffered until the batch
+// they belong to is saved.
+type rejectsFile struct {
+	f      *os.File
+	buffer *bufio.Writer
+}
+
+type rejected struct {
+	Record int64  `json:"record"`
+	Reason string `json:"reason"`
+	Data   string `json:"data"`
+}
+
+func (i *Importer) openRejects(resume bool) (*rejectsFile, error) {
+	if i.rejects == "" {
+		return &rejectsFile{buffer: bufio.NewWriter(io.Discard)}, nil
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
+	f, err := os.OpenFile(i.rejects, flags, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToWriteRejects, err)
+	}
+
+	return &rejectsFile{f: f, buffer: bufio.NewWriter(f)}, nil
+}
+
+func (r *rejectsFile) write(record int64, data string, reason error) error {
+	line, err := json.Marshal(rejected{Record: record, Reason: reason.Error(), Data: data})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToWriteRejects, err)
+	}
+
+	if _, err := r.buffer.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToWriteRejects, err)
+	}
+
+	return nil
+}
+
+func (r *rejectsFile) flush() error {
+	if err := r.buffer.Flush(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToWriteRejects, err)
+	}
+
+	return nil
+}
+
+func (r *rejectsFile) close() {
+	if r.f == nil {
+		return
+	}
+
+	if err := r.f.Close(); err != nil {
+		log.Warn().Err(err).Str("file", r.f.Name()).Msg("failed to close rejects file")
+	}
+}
@@ -0,0 +1,289 @@
+package importer_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/importer"
+	"github.com/EWK20/event-processor/processor/internal/redact"
+	"github.com/EWK20/event-processor/processor/internal/schema"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errStoreDown = errors.New("store is down")
+
+type fakeStore struct {
+	events   []models.Event
+	redacted redact.Result
+	// failOn fails the nth call to SaveBatchRedacted, counting from 1
+	failOn int
+	calls  int
+}
+
+func (s *fakeStore) SaveBatchRedacted(_ context.Context, events []models.Event, redacted redact.Result) (int64, error) {
+	s.calls++
+
+	if s.calls == s.failOn {
+		return 0, errStoreDown
+	}
+
+	s.events = append(s.events, events...)
+	s.redacted.Merge(redacted)
+
+	return int64(len(events)), nil
+}
+
+func (s *fakeStore) clientIDs() []string {
+	var ids []string
+
+	for _, event := range s.events {
+		ids = append(ids, event.ClientID)
+	}
+
+	return ids
+}
+
+type rejected struct {
+	Record int64  `json:"record"`
+	Reason string `json:"reason"`
+	Data   string `json:"data"`
+}
+
+func readRejects(t *testing.T, path string) []rejected {
+	t.Helper()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var rejects []rejected
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r rejected
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &r))
+
+		rejects = append(rejects, r)
+	}
+
+	require.NoError(t, scanner.Err())
+
+	return rejects
+}
+
+func writeFile(t *testing.T, name string, lines ...string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644))
+
+	return path
+}
+
+func event(clientID string) string {
+	return `{"event_type":"transaction_approved","client_id":"` + clientID + `","payload":{"amount":"10.00","currency":"GBP"},"timestamp":"2025-08-18T07:48:48Z"}`
+}
+
+func TestNDJSON(t *testing.T) {
+	path := writeFile(t, "events.ndjson",
+		event("client_1"),
+		`{"event_type":"transaction_approved",`,
+		"",
+		`{"event_type":"transaction_approved","payload":{"amount":"10.00"},"timestamp":"2025-08-18T07:48:48Z"}`,
+		event("client_2"),
+		`{"event_type":"transaction_approved","client_id":"client_3","payload":{},"timestamp":"2025-08-18T07:48:48Z","schema_version":2}`,
+	)
+	rejects := filepath.Join(t.TempDir(), "rejects.ndjson")
+
+	var reports []importer.Progress
+
+	store := &fakeStore{}
+
+	progress, err := importer.New(store, schema.NewRegistry(),
+		importer.WithBatchSize(2),
+		importer.WithRejects(rejects),
+		importer.WithProgress(func(p importer.Progress) { reports = append(reports, p) }),
+	).Run(t.Context(), path)
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, importer.Progress{Offset: info.Size(), Size: info.Size(), Records: 5, Imported: 2, Rejected: 3}, progress)
+	assert.Len(t, reports, 3)
+	assert.Equal(t, []string{"client_1", "client_2"}, store.clientIDs())
+	assert.Equal(t, time.Date(2025, 8, 18, 7, 48, 48, 0, time.UTC), store.events[0].Timestamp)
+	assert.Equal(t, 1, store.events[0].SchemaVersion)
+
+	got := readRejects(t, rejects)
+	require.Len(t, got, 3)
+	assert.Equal(t, int64(2), got[0].Record)
+	assert.Equal(t, `{"event_type":"transaction_approved",`, got[0].Data)
+	assert.Contains(t, got[0].Reason, "event is invalid")
+	assert.Equal(t, int64(3), got[1].Record)
+	assert.Contains(t, got[1].Reason, "client_id is required")
+	assert.Equal(t, int64(5), got[2].Record)
+	assert.Contains(t, got[2].Reason, "unsupported schema version")
+}
+
+func TestCSV(t *testing.T) {
+	path := writeFile(t, "events.csv",
+		"id,event_type,client_id,timestamp,payload.amount,payload.card.country,metadata.source",
+		"1,transaction_approved,client_1,2025-08-18T07:48:48Z,10.00,GB,legacy",
+		"2,transaction_approved,client_2,yesterday,20.00,GB,legacy",
+		"3,transaction_approved,client_3",
+		`4,transaction_approved,client_4,2025-08-18T07:48:48Z,"1,000.00",,`,
+	)
+	rejects := filepath.Join(t.TempDir(), "rejects.ndjson")
+
+	store := &fakeStore{}
+
+	progress, err := importer.New(store, schema.NewRegistry(), importer.WithRejects(rejects)).Run(t.Context(), path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), progress.Imported)
+	assert.Equal(t, int64(2), progress.Rejected)
+
+	require.Equal(t, []string{"client_1", "client_4"}, store.clientIDs())
+	assert.Equal(t, map[string]any{"amount": "10.00", "card": map[string]any{"country": "GB"}}, store.events[0].Payload)
+	assert.Equal(t, map[string]any{"source": "legacy"}, store.events[0].Metadata)
+	assert.Equal(t, map[string]any{"amount": "1,000.00"}, store.events[1].Payload)
+
+	got := readRejects(t, rejects)
+	require.Len(t, got, 2)
+	assert.Contains(t, got[0].Reason, "timestamp")
+	assert.Equal(t, "2,transaction_approved,client_2,yesterday,20.00,GB,legacy", got[0].Data)
+	assert.Contains(t, got[1].Reason, "wrong number of fields")
+}
+
+func TestResume(t *testing.T) {
+	for _, format := range []string{importer.FormatNDJSON, importer.FormatCSV} {
+		t.Run(format, func(t *testing.T) {
+			record := event
+
+			var lines []string
+
+			if format == importer.FormatCSV {
+				lines = append(lines, "event_type,client_id,timestamp,payload")
+
+				record = func(clientID string) string {
+					return `transaction_approved,` + clientID + `,2025-08-18T07:48:48Z,"{""amount"":""10.00""}"`
+				}
+			}
+
+			// Record 5, in the batch that fails, is missing its client
+			for _, clientID := range []string{"client_1", "client_2", "client_3", "client_4", "", "client_6", "client_7"} {
+				lines = append(lines, record(clientID))
+			}
+
+			path := writeFile(t, "events."+format, lines...)
+			dir := t.TempDir()
+			checkpoint := filepath.Join(dir, "import.json")
+			rejects := filepath.Join(dir, "rejects.ndjson")
+
+			// The second batch, records 4 to 6, fails to save
+			store := &fakeStore{failOn: 2}
+
+			newImporter := func() *importer.Importer {
+				return importer.New(store, schema.NewRegistry(),
+					importer.WithBatchSize(3),
+					importer.WithCheckpoint(checkpoint),
+					importer.WithRejects(rejects),
+				)
+			}
+
+			progress, err := newImporter().Run(t.Context(), path)
+			require.ErrorIs(t, err, errStoreDown)
+			assert.Equal(t, int64(3), progress.Imported)
+
+			progress, err = newImporter().Run(t.Context(), path)
+			require.NoError(t, err)
+			assert.Equal(t, int64(7), progress.Records)
+			assert.Equal(t, int64(6), progress.Imported)
+			assert.Equal(t, int64(1), progress.Rejected)
+
+			assert.Equal(t, []string{"client_1", "client_2", "client_3", "client_4", "client_6", "client_7"}, store.clientIDs())
+
+			got := readRejects(t, rejects)
+			require.Len(t, got, 1)
+			assert.Equal(t, int64(5), got[0].Record)
+
+			// The checkpoint can't resume another file
+			_, err = newImporter().Run(t.Context(), writeFile(t, "other."+format, lines...))
+			require.ErrorIs(t, err, importer.ErrCheckpointMismatch)
+		})
+	}
+}
+
+type fakeRedactor struct{}
+
+func (fakeRedactor) Redact(event *models.Event, messageID string) (redact.Result, error) {
+	if payload, ok := event.Payload.(map[string]any); ok {
+		payload["currency"] = "***"
+	}
+
+	return redact.Result{Redactions: []redact.Redaction{
+		{MessageID: messageID, ClientID: event.ClientID, EventType: event.EventType, Field: "currency", Action: redact.ActionMask, Count: 1},
+	}}, nil
+}
+
+func TestRedaction(t *testing.T) {
+	path := writeFile(t, "events.ndjson", event("client_1"), `{"event_type":"transaction_approved"}`)
+	store := &fakeStore{}
+
+	progress, err := importer.New(store, schema.NewRegistry(), importer.WithRedaction(fakeRedactor{})).Run(t.Context(), path)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), progress.Imported)
+
+	require.Len(t, store.events, 1)
+	assert.Equal(t, map[string]any{"amount": "10.00", "currency": "***"}, store.events[0].Payload)
+
+	// The audit records are saved with their batch, none for rejected records
+	require.Len(t, store.redacted.Redactions, 1)
+	assert.Equal(t, "client_1", store.redacted.Redactions[0].ClientID)
+}
+
+func TestEventTypes(t *testing.T) {
+	path := writeFile(t, "events.ndjson",
+		event("client_1"),
+		`{"event_type":"user_signup","client_id":"client_2","payload":{},"timestamp":"2025-08-18T07:48:48Z"}`,
+	)
+	rejects := filepath.Join(t.TempDir(), "rejects.ndjson")
+	store := &fakeStore{}
+
+	progress, err := importer.New(store, schema.NewRegistry(),
+		importer.WithRejects(rejects),
+		importer.WithEventTypes("transaction_approved"),
+	).Run(t.Context(), path)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(1), progress.Imported)
+	assert.Equal(t, []string{"client_1"}, store.clientIDs())
+
+	got := readRejects(t, rejects)
+	require.Len(t, got, 1)
+	assert.Equal(t, `event is invalid: unknown event_type "user_signup"`, got[0].Reason)
+}
+
+func TestInvalidImport(t *testing.T) {
+	_, err := importer.New(&fakeStore{}, schema.NewRegistry()).Run(t.Context(), writeFile(t, "events.xml", "<events/>"))
+	require.ErrorIs(t, err, importer.ErrUnsupportedFormat)
+
+	_, err = importer.New(&fakeStore{}, schema.NewRegistry()).Run(t.Context(), writeFile(t, "events.csv", "event_type,amount"))
+	require.ErrorIs(t, err, importer.ErrFailedToRead)
+
+	// The format flag overrides the extension
+	store := &fakeStore{}
+
+	_, err = importer.New(store, schema.NewRegistry(), importer.WithFormat(importer.FormatNDJSON)).Run(t.Context(), writeFile(t, "events.txt", event("client_1")))
+	require.NoError(t, err)
+	assert.Len(t, store.events, 1)
+}
@@ -0,0 +1,61 @@
+package importer
+
+type Option func(*Importer)
+
+// WithFormat sets the file format, by default it is inferred from the file
+// extension.
+func WithFormat(format string) Option {
+	return func(i *Importer) {
+		i.format = format
+	}
+}
+
+// WithBatchSize sets how many records are read between saves and checkpoints.
+func WithBatchSize(size int) Option {
+	return func(i *Importer) {
+		i.batchSize = max(size, 1)
+	}
+}
+
+// WithRejects writes rejected records and the reason they were rejected to
+// path as NDJSON.
+func WithRejects(path string) Option {
+	return func(i *Importer) {
+		i.rejects = path
+	}
+}
+
+// WithCheckpoint saves the progress of the import to path, resuming from it
+// when it already exists.
+func WithCheckpoint(path string) Option {
+	return func(i *Importer) {
+		i.checkpoint = path
+	}
+}
+
+// WithProgress calls fn after every saved batch.
+func WithProgress(fn func(Progress)) Option {
+	return func(i *Importer) {
+		i.progress = fn
+	}
+}
+
+// WithRedaction redacts valid records before they are saved, as events
+// received from the queue are.
+func WithRedaction(redactor Redactor) Option {
+	return func(i *Importer) {
+		i.redactor = redactor
+	}
+}
+
+// WithEventTypes rejects the records of other event types, as the processor
+// sends them to the DLQ. Any type is accepted without event types.
+func WithEventTypes(eventTypes ...string) Option {
+	return func(i *Importer) {
+		i.eventTypes = make(map[string]bool, len(eventTypes))
+
+		for _, eventType := range eventTypes {
+			i.eventTypes[eventType] = true
+		}
+	}
+}
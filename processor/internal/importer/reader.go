@@ -0,0 +1,245 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/models"
+)
+
+// record is a decoded record, err is set when it couldn't be decoded.
+type record struct {
+	raw   string
+	event models.Event
+	err   error
+}
+
+type reader interface {
+	// next returns the following record, or io.EOF after the last one.
+	next() (record, error)
+	// offset is the byte offset following the last record returned.
+	offset() int64
+}
+
+type ndjsonReader struct {
+	reader *bufio.Reader
+	off    int64
+}
+
+func newNDJSONReader(f io.ReadSeeker, offset int64) (*ndjsonReader, error) {
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return &ndjsonReader{reader: bufio.NewReaderSize(f, 1<<20), off: offset}, nil
+}
+
+func (r *ndjsonReader) next() (record, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		r.off += int64(len(line))
+
+		if len(line) == 0 && err != nil {
+			return record{}, err
+		}
+
+		if err != nil && !errors.Is(err, io.EOF) {
+			return record{}, err
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		rec := record{raw: string(line)}
+
+		if err := json.Unmarshal(line, &rec.event); err != nil {
+			rec.err = fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+		}
+
+		return rec, nil
+	}
+}
+
+func (r *ndjsonReader) offset() int64 {
+	return r.off
+}
+
+// csvReader maps the columns named in the header to event fields. Columns
+// prefixed with payload. or metadata. set a, possibly nested, field of the
+// payload or metadata, as written by export.
+type csvReader struct {
+	reader  *csv.Reader
+	header  []string
+	base    int64
+	encoded bytes.Buffer
+}
+
+func newCSVReader(f io.ReadSeeker, offset int64) (*csvReader, error) {
+	reader := csv.NewReader(bufio.NewReaderSize(f, 1<<20))
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	for _, column := range header {
+		if !knownColumn(column) {
+			return nil, fmt.Errorf("unknown column %q", column)
+		}
+	}
+
+	r := &csvReader{reader: reader, header: header}
+
+	// Resuming, skip to the first record after the checkpoint
+	if offset > reader.InputOffset() {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+
+		r.reader = csv.NewReader(bufio.NewReaderSize(f, 1<<20))
+		r.base = offset
+	}
+
+	r.reader.FieldsPerRecord = len(header)
+
+	return r, nil
+}
+
+func (r *csvReader) next() (record, error) {
+	fields, err := r.reader.Read()
+	if err != nil {
+		if !errors.Is(err, csv.ErrFieldCount) {
+			return record{}, err
+		}
+
+		// A record with the wrong number of fields is rejected, not fatal
+		return record{raw: r.encode(fields), err: fmt.Errorf("%w: %w", ErrInvalidEvent, err)}, nil
+	}
+
+	rec := record{raw: r.encode(fields)}
+
+	for i, column := range r.header {
+		if err := setColumn(&rec.event, column, fields[i]); err != nil {
+			rec.err = fmt.Errorf("%w: %s: %w", ErrInvalidEvent, column, err)
+
+			break
+		}
+	}
+
+	return rec, nil
+}
+
+func (r *csvReader) offset() int64 {
+	return r.base + r.reader.InputOffset()
+}
+
+func (r *csvReader) encode(fields []string) string {
+	r.encoded.Reset()
+
+	w := csv.NewWriter(&r.encoded)
+	_ = w.Write(fields)
+	w.Flush()
+
+	return strings.TrimSuffix(r.encoded.String(), "\n")
+}
+
+func knownColumn(column string) bool {
+	switch column {
+	case "id", "event_type", "client_id", "payload", "timestamp", "priority", "category",
+		"schema_version", "message_id", "received_at", "metadata":
+		return true
+	}
+
+	return strings.HasPrefix(column, "payload.") || strings.HasPrefix(column, "metadata.")
+}
+
+// setColumn sets the event field of column, empty cells are left unset.
+func setColumn(event *models.Event, column, value string) error {
+	if value == "" {
+		return nil
+	}
+
+	var err error
+
+	switch column {
+	case "id":
+		// Imported events get new IDs
+	case "event_type":
+		event.EventType = value
+	case "client_id":
+		event.ClientID = value
+	case "priority":
+		event.Priority = value
+	case "category":
+		event.Category = value
+	case "message_id":
+		event.MessageID = value
+	case "timestamp":
+		event.Timestamp, err = time.Parse(time.RFC3339, value)
+	case "received_at":
+		event.ReceivedAt, err = time.Parse(time.RFC3339, value)
+	case "schema_version":
+		event.SchemaVersion, err = strconv.Atoi(value)
+	case "payload":
+		var payload map[string]any
+		if err = json.Unmarshal([]byte(value), &payload); err == nil {
+			event.Payload = merge(payload, event.Payload)
+		}
+	case "metadata":
+		err = json.Unmarshal([]byte(value), &event.Metadata)
+	default:
+		if path, ok := strings.CutPrefix(column, "payload."); ok {
+			payload, _ := event.Payload.(map[string]any)
+			event.Payload = setPath(payload, path, value)
+		} else if path, ok := strings.CutPrefix(column, "metadata."); ok {
+			event.Metadata = setPath(event.Metadata, path, value)
+		}
+	}
+
+	return err
+}
+
+// merge copies the fields of from, set by earlier payload.<path> columns,
+// into into.
+func merge(into map[string]any, from any) map[string]any {
+	fields, _ := from.(map[string]any)
+
+	for key, value := range fields {
+		into[key] = value
+	}
+
+	return into
+}
+
+func setPath(fields map[string]any, path, value string) map[string]any {
+	if fields == nil {
+		fields = make(map[string]any)
+	}
+
+	keys := strings.Split(path, ".")
+	current := fields
+
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := current[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			current[key] = next
+		}
+
+		current = next
+	}
+
+	current[keys[len(keys)-1]] = value
+
+	return fields
+}
@@ -0,0 +1,41 @@
+package metrics
+
+import (
+	"expvar"
+	"time"
+)
+
+// Metrics is a set of counters and timings exposed through expvar.
+type Metrics struct {
+	vars *expvar.Map
+}
+
+func New() *Metrics {
+	return &Metrics{
+		vars: new(expvar.Map).Init(),
+	}
+}
+
+// Publish exposes the metrics under name on expvar's /debug/vars handler. It
+// must only be called once per name.
+func (m *Metrics) Publish(name string) {
+	expvar.Publish(name, m.vars)
+}
+
+func (m *Metrics) Inc(name string) {
+	m.vars.Add(name, 1)
+}
+
+// Observe records a duration as a running count and total in seconds.
+func (m *Metrics) Observe(name string, d time.Duration) {
+	m.vars.Add(name+"_count", 1)
+	m.vars.AddFloat(name+"_seconds_total", d.Seconds())
+}
+
+func (m *Metrics) Count(name string) int64 {
+	if v, ok := m.vars.Get(name).(*expvar.Int); ok {
+		return v.Value()
+	}
+
+	return 0
+}
@@ -2,13 +2,18 @@ package processor_test
 
 import (
 	"context"
+	"sync"
 	"time"
 
-	"github.com/EWK20/event-processor/processor/internal/models"
+	"github.com/EWK20/event-processor/processor/internal/redact"
+	"github.com/EWK20/event-processor/processor/models"
 )
 
 type FakeDB struct {
-	events []models.Event
+	mu       sync.Mutex
+	events   []models.Event
+	redacted []redact.Result
+	err      error
 }
 
 func NewFakeDB() *FakeDB {
@@ -39,7 +44,14 @@ func NewFakeDB() *FakeDB {
 	}
 }
 
-func (db *FakeDB) Save(_ context.Context, event models.Event) error {
+func (db *FakeDB) SaveRedacted(_ context.Context, event models.Event, redacted redact.Result) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.err != nil {
+		return db.err
+	}
+
 	lastID := db.events[len(db.events)-1].ID
 
 	newID := lastID + 1
@@ -47,6 +59,24 @@ func (db *FakeDB) Save(_ context.Context, event models.Event) error {
 	event.ID = newID
 
 	db.events = append(db.events, event)
+	db.redacted = append(db.redacted, redacted)
 
 	return nil
 }
+
+// Events returns a copy of the saved events, safe to call while the
+// processor runs.
+func (db *FakeDB) Events() []models.Event {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return append([]models.Event(nil), db.events...)
+}
+
+// Redacted returns the redaction results saved with the events, in order.
+func (db *FakeDB) Redacted() []redact.Result {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return append([]redact.Result(nil), db.redacted...)
+}
@@ -0,0 +1,151 @@
+package processor
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/enrich"
+	"github.com/EWK20/event-processor/processor/internal/redact"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/rs/zerolog/log"
+)
+
+// Message is a received queue message. Event is set once the body has been
+// decoded by the Decode middleware.
+type Message struct {
+	types.Message
+	ReceivedAt time.Time
+	Event      models.Event
+
+	decoded bool
+	// heartbeat stops extending the message's visibility timeout.
+	heartbeat func()
+}
+
+// Handler handles a single message. Returning nil acks the message, an error
+// wrapping ErrInvalidEvent sends it to the DLQ and any other error leaves it
+// on the queue to be retried.
+type Handler func(ctx context.Context, msg *Message) error
+
+type Middleware func(next Handler) Handler
+
+// Chain wraps handler with middlewares, the first middleware being the
+// outermost one.
+func Chain(handler Handler, middlewares ...Middleware) Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler
+}
+
+// Decode decodes the message body into msg.Event, sending malformed bodies to
+// the DLQ. Middlewares reading msg.Event go after it, the ones before it see
+// every message, malformed or not. Messages already decoded are left as they
+// are, and the processor decodes any message still undecoded before it is
+// persisted.
+func Decode() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			if msg.decoded {
+				return next(ctx, msg)
+			}
+
+			if err := json.Unmarshal([]byte(*msg.Body), &msg.Event); err != nil {
+				log.Error().Err(err).Msg("event is invalid")
+
+				return fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+			}
+
+			msg.decoded = true
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// persist enriches, triages, redacts and saves the decoded event. Rules see
+// the event before it is redacted, and dropped events are never redacted.
+// Replayed events were enriched and redacted when first saved, so they are
+// only triaged.
+func (p *Processor) persist(ctx context.Context, msg *Message) error {
+	event := msg.Event
+	messageID := aws.ToString(msg.MessageId)
+	replayed := isReplayed(msg)
+
+	if !replayed {
+		err := p.enrichment.Enrich(ctx, &event, enrich.Message{
+			ID:         messageID,
+			ReceivedAt: msg.ReceivedAt,
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("failed to enrich event")
+
+			if errors.Is(err, enrich.ErrPermanent) {
+				return fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+			}
+
+			return err
+		}
+	}
+
+	var routes []string
+
+	if p.rules != nil {
+		decision := p.rules.Evaluate(event)
+
+		if decision.Drop {
+			log.Info().Any("event", event).Strs("rules", decision.Rules).Msg("dropped an event")
+
+			return nil
+		}
+
+		event.Priority = decision.Priority
+		event.Category = decision.Category
+		routes = decision.Routes
+	}
+
+	var (
+		redacted redact.Result
+		err      error
+	)
+
+	if p.redactor != nil && !replayed {
+		if redacted, err = p.redactor.Redact(&event, messageID); err != nil {
+			log.Error().Err(err).Msg("failed to redact event")
+
+			return fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+		}
+	}
+
+	// Route before saving so a failed route is retried without persisting
+	// the event twice
+	for _, route := range routes {
+		if err := p.sinks[route].Send(ctx, event); err != nil {
+			log.Error().Err(err).Str("route", route).Msg("failed to route event")
+
+			return fmt.Errorf("%w: %s: %w", ErrFailedToRoute, route, err)
+		}
+	}
+
+	if err := p.db.SaveRedacted(ctx, event, redacted); err != nil {
+		log.Error().Err(err).Msg("failed to save event to database")
+
+		return err
+	}
+
+	log.Info().Any("event", event).Msg("persisted an event")
+
+	return nil
+}
+
+func isReplayed(msg *Message) bool {
+	attr, ok := msg.MessageAttributes[models.ReplayedAttribute]
+
+	return ok && aws.ToString(attr.StringValue) == "true"
+}
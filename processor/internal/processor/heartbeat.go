@@ -0,0 +1,65 @@
+package processor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/rs/zerolog/log"
+)
+
+// startHeartbeat keeps msg hidden from other consumers from the moment it is
+// received until it is acked, dead-lettered or released, by extending its
+// visibility timeout every heartbeat interval. The returned func stops the
+// heartbeat and waits for any in-flight extension, so the message can be
+// safely acked or dead-lettered afterwards. It can be called more than once.
+func (p *Processor) startHeartbeat(ctx context.Context, msg types.Message) func() {
+	if p.heartbeatInterval <= 0 || p.visibilityTimeout <= 0 {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(p.heartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			_, err := p.Client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          p.QueueURL,
+				ReceiptHandle:     msg.ReceiptHandle,
+				VisibilityTimeout: int32(p.visibilityTimeout.Seconds()),
+			})
+			if err != nil && ctx.Err() == nil {
+				log.Error().Err(err).Str("message_id", aws.ToString(msg.MessageId)).Msg("failed to extend message visibility")
+			}
+		}
+	}()
+
+	return sync.OnceFunc(func() {
+		cancel()
+		wg.Wait()
+	})
+}
+
+// stopHeartbeat stops the heartbeat started when msg was received, if any.
+func (m *Message) stopHeartbeat() {
+	if m.heartbeat != nil {
+		m.heartbeat()
+	}
+}
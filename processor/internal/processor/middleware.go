@@ -0,0 +1,261 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/metrics"
+	"github.com/EWK20/event-processor/processor/internal/schema"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrPanic = errors.New("panic while handling message")
+)
+
+// Recover turns a panic in the rest of the chain into a permanent failure.
+// The processor already recovers around the whole chain, this is for handlers
+// used on their own or to recover closer to the panicking middleware.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = panicError(msg, r)
+				}
+			}()
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// panicError logs the stack of a recovered panic and returns a permanent
+// failure carrying the panic reason.
+func panicError(msg *Message, r any) error {
+	log.Error().
+		Str("message_id", aws.ToString(msg.MessageId)).
+		Str("panic", fmt.Sprint(r)).
+		Str("stack", string(debug.Stack())).
+		Msg("recovered from panic while handling message")
+
+	return fmt.Errorf("%w: %w: %v", ErrInvalidEvent, ErrPanic, r)
+}
+
+// Timeout bounds the time spent on a single message.
+func Timeout(timeout time.Duration) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			if timeout <= 0 {
+				return next(ctx, msg)
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Upcast converts event payloads to the current version of their schema, so
+// the rest of the chain only deals with current payloads. Events of an
+// unknown version are sent to the DLQ.
+func Upcast(registry *schema.Registry) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			if err := registry.Upcast(&msg.Event); err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+			}
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Validate rejects events missing required envelope fields or exceeding the
+// limits of the events table, so they go to the DLQ instead of failing to
+// save on every retry.
+func Validate() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			if err := ValidateEvent(msg.Event); err != nil {
+				log.Error().Err(err).Msg("event is invalid")
+
+				return err
+			}
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// ValidateEvent checks the envelope of event, returning an error wrapping
+// ErrInvalidEvent that lists every problem found.
+func ValidateEvent(event models.Event) error {
+	if problems := event.Problems(); len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidEvent, strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// KnownEventTypes sends events of any type not in eventTypes to the DLQ. Every
+// type is accepted when eventTypes is empty.
+func KnownEventTypes(eventTypes ...string) Middleware {
+	known := make(map[string]bool, len(eventTypes))
+	for _, eventType := range eventTypes {
+		known[eventType] = true
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			if len(known) > 0 && !known[msg.Event.EventType] {
+				err := fmt.Errorf("%w: unknown event_type %q", ErrInvalidEvent, msg.Event.EventType)
+				log.Error().Err(err).Msg("event is invalid")
+
+				return err
+			}
+
+			return next(ctx, msg)
+		}
+	}
+}
+
+// Dedup acks messages that were already handled successfully within window,
+// such as redeliveries after a delete failed. Messages with an idempotency
+// key are matched by key, so republished events are skipped too.
+func Dedup(window time.Duration) Middleware {
+	var (
+		mu        sync.Mutex
+		seen      = make(map[string]time.Time)
+		lastSweep time.Time
+	)
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			id := aws.ToString(msg.MessageId)
+			if attr, ok := msg.MessageAttributes[models.IdempotencyKeyAttribute]; ok && attr.StringValue != nil {
+				id = *attr.StringValue
+			}
+
+			now := time.Now()
+
+			mu.Lock()
+			if now.Sub(lastSweep) > window {
+				for key, expiry := range seen {
+					if now.After(expiry) {
+						delete(seen, key)
+					}
+				}
+
+				lastSweep = now
+			}
+			expiry, duplicate := seen[id]
+			duplicate = duplicate && now.Before(expiry)
+			mu.Unlock()
+
+			if duplicate {
+				log.Warn().Str("message_id", id).Msg("skipped a duplicate message")
+
+				return nil
+			}
+
+			if err := next(ctx, msg); err != nil {
+				return err
+			}
+
+			mu.Lock()
+			seen[id] = now.Add(window)
+			mu.Unlock()
+
+			return nil
+		}
+	}
+}
+
+// Metrics counts handled, invalid and failed messages and how long they took.
+func Metrics(m *metrics.Metrics) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			m.Observe("handle_duration", time.Since(start))
+
+			switch {
+			case err == nil:
+				m.Inc("messages_handled")
+			case errors.Is(err, ErrInvalidEvent):
+				m.Inc("messages_invalid")
+			default:
+				m.Inc("messages_failed")
+			}
+
+			return err
+		}
+	}
+}
+
+// Tracing attaches a logger carrying the trace ID to the context. The ID is
+// taken from the traceparent or trace_id message attribute and falls back to
+// the message ID.
+func Tracing() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			traceID := aws.ToString(msg.MessageId)
+
+			if attr, ok := msg.MessageAttributes["trace_id"]; ok && attr.StringValue != nil {
+				traceID = *attr.StringValue
+			}
+
+			// W3C traceparent: version-traceid-parentid-flags
+			if attr, ok := msg.MessageAttributes[models.TraceparentAttribute]; ok && attr.StringValue != nil {
+				if parts := strings.Split(*attr.StringValue, "-"); len(parts) == 4 {
+					traceID = parts[1]
+				}
+			}
+
+			logger := log.With().Str("trace_id", traceID).Str("message_id", aws.ToString(msg.MessageId)).Logger()
+
+			return next(logger.WithContext(ctx), msg)
+		}
+	}
+}
+
+// Logging logs the outcome of every message with the context logger.
+func Logging() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, msg *Message) error {
+			start := time.Now()
+			err := next(ctx, msg)
+
+			logger := zerolog.Ctx(ctx)
+			if logger.GetLevel() == zerolog.Disabled {
+				logger = &log.Logger
+			}
+
+			var event *zerolog.Event
+			if err != nil {
+				event = logger.Warn().Err(err)
+			} else {
+				event = logger.Debug()
+			}
+
+			event.Str("event_type", msg.Event.EventType).
+				Str("client_id", msg.Event.ClientID).
+				Dur("duration", time.Since(start)).
+				Msg("handled a message")
+
+			return err
+		}
+	}
+}
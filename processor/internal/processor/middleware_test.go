@@ -0,0 +1,333 @@
+package processor_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/metrics"
+	"github.com/EWK20/event-processor/processor/internal/processor"
+	"github.com/EWK20/event-processor/processor/internal/schema"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMessage(id string, event models.Event) *processor.Message {
+	return &processor.Message{
+		Message: types.Message{
+			MessageId: aws.String(id),
+			Body:      aws.String("{}"),
+		},
+		Event: event,
+	}
+}
+
+func TestChain(t *testing.T) {
+	var calls []string
+
+	record := func(name string) processor.Middleware {
+		return func(next processor.Handler) processor.Handler {
+			return func(ctx context.Context, msg *processor.Message) error {
+				calls = append(calls, name+" before")
+				err := next(ctx, msg)
+				calls = append(calls, name+" after")
+
+				return err
+			}
+		}
+	}
+
+	handler := processor.Chain(func(context.Context, *processor.Message) error {
+		calls = append(calls, "handler")
+
+		return nil
+	}, record("first"), record("second"))
+
+	require.NoError(t, handler(t.Context(), newMessage("msg-1", models.Event{})))
+	assert.Equal(t, []string{"first before", "second before", "handler", "second after", "first after"}, calls)
+}
+
+func TestValidate(t *testing.T) {
+	type Test struct {
+		input models.Event
+		err   error
+	}
+
+	testCases := map[string]Test{
+		"Valid Event": {
+			input: models.Event{
+				EventType: "transaction_approved",
+				ClientID:  "client_123",
+				Payload:   map[string]any{"amount": "10.00"},
+				Timestamp: time.Now().UTC(),
+			},
+		},
+		"Missing Client ID": {
+			input: models.Event{
+				EventType: "transaction_approved",
+				Payload:   map[string]any{"amount": "10.00"},
+				Timestamp: time.Now().UTC(),
+			},
+			err: processor.ErrInvalidEvent,
+		},
+		"Payload Too Long": {
+			input: models.Event{
+				EventType: "transaction_approved",
+				ClientID:  "client_123",
+				Payload:   map[string]any{"note": strings.Repeat("x", 1000)},
+				Timestamp: time.Now().UTC(),
+			},
+			err: processor.ErrInvalidEvent,
+		},
+		"Missing Timestamp And Payload": {
+			input: models.Event{
+				EventType: "transaction_approved",
+				ClientID:  "client_123",
+			},
+			err: processor.ErrInvalidEvent,
+		},
+	}
+
+	for scenario, test := range testCases {
+		t.Run(scenario, func(t *testing.T) {
+			handler := processor.Chain(func(context.Context, *processor.Message) error {
+				return nil
+			}, processor.Validate())
+
+			err := handler(t.Context(), newMessage("msg-1", test.input))
+
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestKnownEventTypes(t *testing.T) {
+	type Test struct {
+		eventTypes []string
+		eventType  string
+		err        error
+	}
+
+	testCases := map[string]Test{
+		"Known Type": {
+			eventTypes: []string{"transaction_approved", "refund_issued"},
+			eventType:  "refund_issued",
+		},
+		"Unknown Type": {
+			eventTypes: []string{"transaction_approved", "refund_issued"},
+			eventType:  "unknown_event",
+			err:        processor.ErrInvalidEvent,
+		},
+		"Any Type When None Listed": {
+			eventType: "unknown_event",
+		},
+	}
+
+	for scenario, test := range testCases {
+		t.Run(scenario, func(t *testing.T) {
+			handler := processor.Chain(func(context.Context, *processor.Message) error {
+				return nil
+			}, processor.KnownEventTypes(test.eventTypes...))
+
+			err := handler(t.Context(), newMessage("msg-1", models.Event{EventType: test.eventType}))
+
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestUpcast(t *testing.T) {
+	registry := schema.NewRegistry().
+		Register("transaction_approved", 1, func(payload map[string]any) (map[string]any, error) {
+			payload["id"] = payload["transaction_id"]
+			delete(payload, "transaction_id")
+
+			return payload, nil
+		})
+
+	var handled models.Event
+
+	handler := processor.Chain(func(_ context.Context, msg *processor.Message) error {
+		handled = msg.Event
+
+		return nil
+	}, processor.Upcast(registry))
+
+	err := handler(t.Context(), newMessage("msg-1", models.Event{
+		EventType: "transaction_approved",
+		Payload:   map[string]any{"transaction_id": "txn_1"},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, 2, handled.SchemaVersion)
+	assert.Equal(t, map[string]any{"id": "txn_1"}, handled.Payload)
+
+	err = handler(t.Context(), newMessage("msg-2", models.Event{
+		EventType:     "transaction_approved",
+		Payload:       map[string]any{"id": "txn_1"},
+		SchemaVersion: 3,
+	}))
+	require.ErrorIs(t, err, processor.ErrInvalidEvent)
+	require.ErrorIs(t, err, schema.ErrUnsupportedVersion)
+}
+
+func TestRecover(t *testing.T) {
+	handler := processor.Chain(func(context.Context, *processor.Message) error {
+		var event *models.Event
+
+		_ = event.ClientID
+
+		return nil
+	}, processor.Recover())
+
+	err := handler(t.Context(), newMessage("msg-1", models.Event{}))
+
+	require.ErrorIs(t, err, processor.ErrPanic)
+	require.ErrorIs(t, err, processor.ErrInvalidEvent)
+}
+
+func TestDedup(t *testing.T) {
+	handled := 0
+	failures := 1
+
+	handler := processor.Chain(func(context.Context, *processor.Message) error {
+		handled++
+
+		if failures > 0 {
+			failures--
+
+			return errors.New("failed")
+		}
+
+		return nil
+	}, processor.Dedup(time.Minute))
+
+	// A failed message is not remembered so its retry is handled
+	require.Error(t, handler(t.Context(), newMessage("msg-1", models.Event{})))
+	require.NoError(t, handler(t.Context(), newMessage("msg-1", models.Event{})))
+	require.NoError(t, handler(t.Context(), newMessage("msg-1", models.Event{})))
+	require.NoError(t, handler(t.Context(), newMessage("msg-2", models.Event{})))
+
+	assert.Equal(t, 3, handled)
+}
+
+func TestDedupIdempotencyKey(t *testing.T) {
+	handled := 0
+
+	handler := processor.Chain(func(context.Context, *processor.Message) error {
+		handled++
+
+		return nil
+	}, processor.Dedup(time.Minute))
+
+	withKey := func(id, key string) *processor.Message {
+		msg := newMessage(id, models.Event{})
+		msg.MessageAttributes = map[string]types.MessageAttributeValue{
+			models.IdempotencyKeyAttribute: {DataType: aws.String("String"), StringValue: aws.String(key)},
+		}
+
+		return msg
+	}
+
+	// Republishing creates a new message, the key still matches
+	require.NoError(t, handler(t.Context(), withKey("msg-1", "order-1")))
+	require.NoError(t, handler(t.Context(), withKey("msg-2", "order-1")))
+	require.NoError(t, handler(t.Context(), withKey("msg-3", "order-2")))
+
+	assert.Equal(t, 2, handled)
+}
+
+func TestTimeout(t *testing.T) {
+	handler := processor.Chain(func(ctx context.Context, _ *processor.Message) error {
+		<-ctx.Done()
+
+		return ctx.Err()
+	}, processor.Timeout(10*time.Millisecond))
+
+	err := handler(t.Context(), newMessage("msg-1", models.Event{}))
+
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New()
+
+	results := []error{nil, processor.ErrInvalidEvent, errors.New("failed"), nil}
+
+	handler := processor.Chain(func(context.Context, *processor.Message) error {
+		err := results[0]
+		results = results[1:]
+
+		return err
+	}, processor.Metrics(m))
+
+	for range len(results) {
+		_ = handler(t.Context(), newMessage("msg-1", models.Event{}))
+	}
+
+	assert.Equal(t, int64(2), m.Count("messages_handled"))
+	assert.Equal(t, int64(1), m.Count("messages_invalid"))
+	assert.Equal(t, int64(1), m.Count("messages_failed"))
+	assert.Equal(t, int64(4), m.Count("handle_duration_count"))
+}
+
+// TestMetricsMalformedMessages checks malformed bodies are counted when the
+// body is decoded inside Metrics, as the process command does.
+func TestMetricsMalformedMessages(t *testing.T) {
+	m := metrics.New()
+
+	handler := processor.Chain(func(context.Context, *processor.Message) error {
+		return nil
+	}, processor.Metrics(m), processor.Decode())
+
+	msg := newMessage("msg-1", models.Event{})
+	msg.Body = aws.String(`{"event_type":`)
+
+	require.ErrorIs(t, handler(t.Context(), msg), processor.ErrInvalidEvent)
+	require.NoError(t, handler(t.Context(), newMessage("msg-2", models.Event{})))
+
+	assert.Equal(t, int64(1), m.Count("messages_invalid"))
+	assert.Equal(t, int64(1), m.Count("messages_handled"))
+}
+
+func TestDecode(t *testing.T) {
+	var handled models.Event
+
+	rename := func(next processor.Handler) processor.Handler {
+		return func(ctx context.Context, msg *processor.Message) error {
+			msg.Event.ClientID = "client_456"
+
+			return next(ctx, msg)
+		}
+	}
+
+	// Decoding twice keeps the changes made in between
+	handler := processor.Chain(func(_ context.Context, msg *processor.Message) error {
+		handled = msg.Event
+
+		return nil
+	}, processor.Decode(), rename, processor.Decode())
+
+	msg := newMessage("msg-1", models.Event{})
+	msg.Body = aws.String(`{"event_type":"transaction_approved","client_id":"client_123","payload":{"amount":"1.00"}}`)
+
+	require.NoError(t, handler(t.Context(), msg))
+	assert.Equal(t, "transaction_approved", handled.EventType)
+	assert.Equal(t, "client_456", handled.ClientID)
+}
@@ -0,0 +1,80 @@
+package processor
+
+import (
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/enrich"
+	"github.com/EWK20/event-processor/processor/internal/metrics"
+	"github.com/EWK20/event-processor/processor/internal/redact"
+	"github.com/EWK20/event-processor/processor/internal/rules"
+)
+
+type Option func(*Processor)
+
+// WithConcurrency sets how many messages are handled at the same time.
+// Messages of the same FIFO group are still handled one at a time in order.
+func WithConcurrency(concurrency int) Option {
+	return func(p *Processor) {
+		if concurrency > 0 {
+			p.concurrency = concurrency
+		}
+	}
+}
+
+// WithVisibility sets the visibility timeout of received messages and how
+// often it is extended while a message is being handled. A zero heartbeat
+// disables the extension.
+func WithVisibility(timeout, heartbeat time.Duration) Option {
+	return func(p *Processor) {
+		p.visibilityTimeout = timeout
+		p.heartbeatInterval = heartbeat
+	}
+}
+
+// WithEnrichment runs the pipeline on every event after it is decoded.
+func WithEnrichment(pipeline enrich.Pipeline) Option {
+	return func(p *Processor) {
+		p.enrichment = pipeline
+	}
+}
+
+// WithRedaction masks, hashes or tokenizes the sensitive fields of the events
+// the rules keep, before they are routed and saved. The vault entries and
+// audit records of the redaction are saved with the event.
+func WithRedaction(redactor *redact.Redactor) Option {
+	return func(p *Processor) {
+		p.redactor = redactor
+	}
+}
+
+// WithRules triages every event with engine before it is saved.
+func WithRules(engine *rules.Engine) Option {
+	return func(p *Processor) {
+		p.rules = engine
+	}
+}
+
+// WithSink registers a sink that rules can route events to by name. Routes
+// without a registered sink are sent to the SQS queue of the same name.
+func WithSink(name string, sink Sink) Option {
+	return func(p *Processor) {
+		p.sinks[name] = sink
+	}
+}
+
+// WithMiddleware appends middlewares to the handler chain. They run in the
+// order given before the event is persisted, middlewares reading the event
+// must come after Decode.
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(p *Processor) {
+		p.middlewares = append(p.middlewares, middlewares...)
+	}
+}
+
+// WithMetrics records processor level metrics, such as recovered panics and
+// dead-lettered messages, in m.
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(p *Processor) {
+		p.metrics = m
+	}
+}
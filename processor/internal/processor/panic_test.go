@@ -0,0 +1,44 @@
+package processor
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/EWK20/event-processor/processor/internal/metrics"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSafeHandle(t *testing.T) {
+	p := &Processor{
+		metrics: metrics.New(),
+	}
+	p.handler = Chain(p.persist, Decode())
+
+	// A nil body makes decoding dereference a nil pointer
+	err := p.safeHandle(t.Context(), &Message{
+		Message: types.Message{MessageId: aws.String("msg-1")},
+	})
+
+	require.ErrorIs(t, err, ErrPanic)
+	require.ErrorIs(t, err, ErrInvalidEvent)
+	assert.Contains(t, err.Error(), "nil pointer dereference")
+	assert.Equal(t, int64(1), p.metrics.Count("panics"))
+}
+
+func TestDLQAttributes(t *testing.T) {
+	msg := &types.Message{
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"trace_id": {DataType: aws.String("String"), StringValue: aws.String("trace-1")},
+		},
+	}
+
+	attributes := dlqAttributes(msg, errors.New(strings.Repeat("x", 2000)))
+
+	require.Contains(t, attributes, FailureReasonAttribute)
+	assert.Len(t, *attributes[FailureReasonAttribute].StringValue, maxFailureReasonLength)
+	assert.Equal(t, "trace-1", *attributes["trace_id"].StringValue)
+}
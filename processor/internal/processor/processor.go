@@ -2,14 +2,18 @@ package processor
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/EWK20/event-processor/processor/internal/config"
-	"github.com/EWK20/event-processor/processor/internal/models"
-	awsConfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/EWK20/event-processor/processor/internal/enrich"
+	"github.com/EWK20/event-processor/processor/internal/metrics"
+	"github.com/EWK20/event-processor/processor/internal/redact"
+	"github.com/EWK20/event-processor/processor/internal/rules"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/rs/zerolog/log"
@@ -19,37 +23,55 @@ var (
 	ErrFailedToCreateClient = errors.New("failed to create SQS client")
 	ErrFailedToGetQueueURL  = errors.New("failed to get queue URL")
 	ErrFailedToGetDLQURL    = errors.New("failed to get DLQ URL")
+	ErrInvalidEvent         = errors.New("event is invalid")
+	ErrFailedToGetRouteURL  = errors.New("failed to get route queue URL")
+	ErrFailedToRoute        = errors.New("failed to route event")
 )
 
 type DB interface {
-	Save(ctx context.Context, event models.Event) error
+	// SaveRedacted saves the event with the result of its redaction, in one
+	// transaction.
+	SaveRedacted(ctx context.Context, event models.Event, redacted redact.Result) error
 }
 
+const (
+	maxReceiveBatch        = 10
+	maxMessageAttributes   = 10
+	maxFailureReasonLength = 1024
+
+	// ackTimeout bounds acking or dead-lettering a handled message, which
+	// outlives the Run context so a shutdown doesn't redeliver finished work
+	ackTimeout = 5 * time.Second
+
+	// FailureReasonAttribute is the DLQ message attribute explaining why a
+	// message could not be processed.
+	FailureReasonAttribute = "failure_reason"
+)
+
 type Processor struct {
 	Client   *sqs.Client
 	QueueURL *string
 	DLQURL   *string
 	db       DB
+
+	concurrency       int
+	visibilityTimeout time.Duration
+	heartbeatInterval time.Duration
+	rules             *rules.Engine
+	sinks             map[string]Sink
+	enrichment        enrich.Pipeline
+	redactor          *redact.Redactor
+	middlewares       []Middleware
+	handler           Handler
+	metrics           *metrics.Metrics
 }
 
-func New(cfg config.AWS, db DB) (*Processor, error) {
-	awsCfg, err := awsConfig.LoadDefaultConfig(context.Background(),
-		awsConfig.WithRegion(cfg.AWSRegion),
-		awsConfig.WithCredentialsProvider(
-			credentials.NewStaticCredentialsProvider(
-				cfg.AWSAccessKeyID,
-				cfg.AWSSecretAccessKey,
-				"",
-			),
-		),
-		awsConfig.WithBaseEndpoint(cfg.SQSEndpoint),
-	)
+func New(cfg config.AWS, db DB, opts ...Option) (*Processor, error) {
+	sqsClient, err := cfg.SQSClient(context.Background())
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrFailedToCreateClient, err)
 	}
 
-	sqsClient := sqs.NewFromConfig(awsCfg)
-
 	queueURL, err := sqsClient.GetQueueUrl(context.Background(), &sqs.GetQueueUrlInput{
 		QueueName: &cfg.SQSQueueName,
 	})
@@ -64,72 +86,212 @@ func New(cfg config.AWS, db DB) (*Processor, error) {
 		return nil, fmt.Errorf("%w: %w", ErrFailedToGetDLQURL, err)
 	}
 
-	return &Processor{
-		Client:   sqsClient,
-		QueueURL: queueURL.QueueUrl,
-		DLQURL:   dlqQueueURL.QueueUrl,
-		db:       db,
-	}, nil
+	processor := &Processor{
+		Client:      sqsClient,
+		QueueURL:    queueURL.QueueUrl,
+		DLQURL:      dlqQueueURL.QueueUrl,
+		db:          db,
+		concurrency: 1,
+		sinks:       make(map[string]Sink),
+		metrics:     metrics.New(),
+	}
+
+	for _, opt := range opts {
+		opt(processor)
+	}
+
+	processor.handler = Chain(processor.persist, append(processor.middlewares, Decode())...)
+
+	if processor.rules != nil {
+		for _, route := range processor.rules.Routes() {
+			if _, ok := processor.sinks[route]; ok {
+				continue
+			}
+
+			routeURL, err := sqsClient.GetQueueUrl(context.Background(), &sqs.GetQueueUrlInput{
+				QueueName: aws.String(route),
+			})
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", ErrFailedToGetRouteURL, route, err)
+			}
+
+			processor.sinks[route] = &queueSink{
+				client:   sqsClient,
+				queueURL: routeURL.QueueUrl,
+			}
+		}
+	}
+
+	return processor, nil
 }
 
 func (p *Processor) Run(ctx context.Context) {
+	// Bounds the received but unhandled messages so a slow group can't make
+	// the processor pull the whole queue into memory
+	inFlight := make(chan struct{}, p.concurrency*maxReceiveBatch)
+	release := func() { <-inFlight }
+
+	scheduler := newScheduler(p.concurrency, p.handleMessage, func(msg *Message) {
+		msg.stopHeartbeat()
+		release()
+	})
+	defer scheduler.wait()
+
 	for {
+		capacity, err := acquire(ctx, inFlight, maxReceiveBatch)
+		if err != nil {
+			return
+		}
+
 		msgOutput, err := p.Client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
 			QueueUrl:            p.QueueURL,
-			MaxNumberOfMessages: 10,
+			MaxNumberOfMessages: int32(capacity),
 			WaitTimeSeconds:     5,
+			VisibilityTimeout:   int32(p.visibilityTimeout.Seconds()),
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+				types.MessageSystemAttributeNameMessageGroupId,
+			},
+			MessageAttributeNames: []string{"All"},
 		})
 		if err != nil {
+			for range capacity {
+				release()
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+
 			log.Error().Err(err).Msg("failed to receive messages")
 
 			continue
 		}
 
+		for range capacity - len(msgOutput.Messages) {
+			release()
+		}
+
+		receivedAt := time.Now()
+
 		for _, msg := range msgOutput.Messages {
-			var event models.Event
+			// Messages waiting behind their group need extending as much as
+			// the ones being handled
+			scheduler.submit(ctx, messageGroup(msg), &Message{
+				Message:    msg,
+				ReceivedAt: receivedAt,
+				heartbeat:  p.startHeartbeat(ctx, msg),
+			})
+		}
+	}
+}
 
-			if err := json.Unmarshal([]byte(*msg.Body), &event); err != nil {
-				log.Error().Err(err).Msg("event is invalid")
+// handleMessage runs a single message through the handler chain, then acks
+// it or moves it to the DLQ. It returns an error when the message is left on
+// the queue to be retried.
+func (p *Processor) handleMessage(ctx context.Context, msg *Message) error {
+	err := p.safeHandle(ctx, msg)
+	msg.stopHeartbeat()
 
-				if err := p.sendMsgToDLQ(&msg); err != nil {
-					log.Error().Err(err).Msg("failed to send event to dead letter queue")
-				}
+	ackCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ackTimeout)
+	defer cancel()
 
-				continue
-			}
+	switch {
+	case err == nil:
+		// Delete message after successful insert
+		_, err := p.Client.DeleteMessage(ackCtx, &sqs.DeleteMessageInput{
+			QueueUrl:      p.QueueURL,
+			ReceiptHandle: msg.ReceiptHandle,
+		})
+		if err != nil {
+			log.Error().Err(err).Msg("failed to delete message from queue")
 
-			if err := p.db.Save(context.Background(), event); err != nil {
-				log.Error().Err(err).Msg("failed to save event to database")
+			return err
+		}
+	case errors.Is(err, ErrInvalidEvent):
+		if err := p.sendMsgToDLQ(ackCtx, &msg.Message, err); err != nil {
+			log.Error().Err(err).Msg("failed to send event to dead letter queue")
 
-				continue
-			}
+			return err
+		}
 
-			// Delete message after successful insert
-			_, err = p.Client.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{
-				QueueUrl:      p.QueueURL,
-				ReceiptHandle: msg.ReceiptHandle,
-			})
-			if err != nil {
-				log.Error().Err(err).Msg("failed to delete message from queue")
-			}
+		p.metrics.Inc("messages_dead_lettered")
+	default:
+		return err
+	}
+
+	return nil
+}
 
-			log.Info().Any("event", event).Msg("persisted an event")
+// safeHandle isolates a panic to the message that caused it. The message is
+// treated as a permanent failure and dead-lettered with the panic reason.
+func (p *Processor) safeHandle(ctx context.Context, msg *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.metrics.Inc("panics")
+
+			err = panicError(msg, r)
+		}
+	}()
+
+	return p.handler(ctx, msg)
+}
+
+// acquire blocks until at least one in-flight slot is free, then takes up to n.
+func acquire(ctx context.Context, slots chan struct{}, n int) (int, error) {
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+
+	acquired := 1
+
+	for acquired < n {
+		select {
+		case slots <- struct{}{}:
+			acquired++
+		default:
+			return acquired, nil
 		}
 	}
+
+	return acquired, nil
+}
+
+// messageGroup returns the FIFO message group, standard queue messages are
+// each their own group so they are handled fully concurrently.
+func messageGroup(msg types.Message) string {
+	if group := msg.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)]; group != "" {
+		return group
+	}
+
+	return aws.ToString(msg.MessageId)
 }
 
-func (p *Processor) sendMsgToDLQ(msg *types.Message) error {
+// sendMsgToDLQ moves msg to the DLQ, keeping its attributes and adding the
+// reason it failed so it can be inspected without the processor logs.
+func (p *Processor) sendMsgToDLQ(ctx context.Context, msg *types.Message, reason error) error {
+	input := &sqs.SendMessageInput{
+		QueueUrl:          p.DLQURL,
+		MessageBody:       msg.Body,
+		MessageAttributes: dlqAttributes(msg, reason),
+	}
+
+	// FIFO queues require a group, keep the original one so the DLQ preserves
+	// the order of each group
+	if isFIFO(*p.DLQURL) {
+		input.MessageGroupId = aws.String(messageGroup(*msg))
+		input.MessageDeduplicationId = msg.MessageId
+	}
+
 	// Send message to DLQ
-	_, err := p.Client.SendMessage(context.Background(), &sqs.SendMessageInput{
-		QueueUrl:    p.DLQURL,
-		MessageBody: msg.Body,
-	})
+	_, err := p.Client.SendMessage(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to send invalid message: %w", err)
 	}
 
 	// Delete message after sending to dlq
-	_, err = p.Client.DeleteMessage(context.TODO(), &sqs.DeleteMessageInput{
+	_, err = p.Client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
 		QueueUrl:      p.QueueURL,
 		ReceiptHandle: msg.ReceiptHandle,
 	})
@@ -139,3 +301,34 @@ func (p *Processor) sendMsgToDLQ(msg *types.Message) error {
 
 	return nil
 }
+
+func dlqAttributes(msg *types.Message, reason error) map[string]types.MessageAttributeValue {
+	reasonText := reason.Error()
+	if len(reasonText) > maxFailureReasonLength {
+		reasonText = reasonText[:maxFailureReasonLength]
+	}
+
+	attributes := map[string]types.MessageAttributeValue{
+		FailureReasonAttribute: {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(reasonText),
+		},
+	}
+
+	// SQS allows up to 10 attributes per message, the failure reason wins
+	for name, value := range msg.MessageAttributes {
+		if len(attributes) == maxMessageAttributes {
+			break
+		}
+
+		if _, ok := attributes[name]; !ok {
+			attributes[name] = value
+		}
+	}
+
+	return attributes
+}
+
+func isFIFO(queueURL string) bool {
+	return strings.HasSuffix(queueURL, ".fifo")
+}
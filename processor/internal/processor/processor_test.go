@@ -1,22 +1,38 @@
 package processor_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/EWK20/event-processor/processor/internal/config"
-	"github.com/EWK20/event-processor/processor/internal/models"
+	"github.com/EWK20/event-processor/processor/internal/enrich"
 	"github.com/EWK20/event-processor/processor/internal/processor"
+	"github.com/EWK20/event-processor/processor/internal/redact"
+	"github.com/EWK20/event-processor/processor/internal/rules"
+	"github.com/EWK20/event-processor/processor/internal/sqsfake"
+	"github.com/EWK20/event-processor/processor/models"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/stretchr/testify/require"
 )
 
 func TestRun(t *testing.T) {
 	type Test struct {
-		input models.Event
+		input         models.Event
+		saveErr       error
+		saved         bool
+		deadLettered  bool
+		failureReason string
 	}
 
 	testCases := map[string]Test{
@@ -31,51 +47,492 @@ func TestRun(t *testing.T) {
 				},
 				Timestamp: time.Now().UTC(),
 			},
+			saved: true,
+		},
+		"Invalid Event Dead Lettered": {
+			input: models.Event{
+				EventType: "transaction_approved",
+				Payload: map[string]any{
+					"transaction_id": "txn_123",
+				},
+				Timestamp: time.Now().UTC(),
+			},
+			deadLettered:  true,
+			failureReason: "event is invalid: client_id is required",
+		},
+		"Failing Save Redriven": {
+			input: models.Event{
+				EventType: "transaction_approved",
+				ClientID:  "client_789",
+				Payload: map[string]any{
+					"transaction_id": "txn_123",
+					"amount":         "125.33",
+					"currency":       "GBP",
+				},
+				Timestamp: time.Now().UTC(),
+			},
+			saveErr:      errors.New("database unavailable"),
+			deadLettered: true,
 		},
 	}
 
 	for scenario, test := range testCases {
 		t.Run(scenario, func(t *testing.T) {
-			awsCfg := config.AWS{
-				AWSRegion:          "us-east-1",
-				AWSAccessKeyID:     "test",
-				AWSSecretAccessKey: "test",
-				SQSEndpoint:        "http://localhost:4566",
-				SQSQueueName:       "test-queue",
-				SQSDLQName:         "test-queue-dlq",
+			fakeDB := NewFakeDB()
+			fakeDB.err = test.saveErr
+
+			body, err := json.Marshal(test.input)
+			require.NoError(t, err)
+
+			fake := runProcessor(t, fakeDB, &sqs.SendMessageInput{MessageBody: aws.String(string(body))},
+				processor.Decode(),
+				processor.Validate(),
+			)
+
+			events := fakeDB.Events()
+			dead := fake.Messages("test-queue-dlq")
+
+			if test.deadLettered {
+				require.Len(t, dead, 1)
+				require.JSONEq(t, string(body), dead[0].Body)
+				require.Equal(t, test.failureReason, dead[0].Attributes["failure_reason"].StringValue)
+			} else {
+				require.Empty(t, dead)
 			}
 
-			fakeDB := NewFakeDB()
+			if !test.saved {
+				require.Len(t, events, 3)
+
+				return
+			}
+
+			// Check that event persisted correctly
+			require.Equal(t, test.input.ClientID, events[len(events)-1].ClientID)
+			require.Equal(t, test.input.EventType, events[len(events)-1].EventType)
+		})
+	}
+}
 
-			processor, err := processor.New(awsCfg, fakeDB)
+// TestRunRedaction checks the rules decide on the original payload, and only
+// events that are kept are redacted and saved with their redaction.
+func TestRunRedaction(t *testing.T) {
+	type Test struct {
+		rule       config.Rule
+		saved      bool
+		priority   string
+		redactions int
+	}
+
+	testCases := map[string]Test{
+		"Rules See Unredacted Payload": {
+			rule: config.Rule{
+				Name:     "known-customer",
+				When:     []string{`email == "jane@example.com"`},
+				Priority: "high",
+			},
+			saved:      true,
+			priority:   "high",
+			redactions: 1,
+		},
+		"Dropped Event Not Redacted": {
+			rule: config.Rule{
+				Name: "known-customer",
+				When: []string{`email == "jane@example.com"`},
+				Drop: true,
+			},
+		},
+	}
+
+	for scenario, test := range testCases {
+		t.Run(scenario, func(t *testing.T) {
+			engine, err := rules.New([]config.Rule{test.rule})
 			require.NoError(t, err)
 
-			body, err := json.Marshal(test.input)
+			redactor, err := redact.New(config.Redaction{
+				HMACKey: "secret",
+				Rules: map[string][]config.RedactionRule{
+					redact.AllEventTypes: {{Field: "email", Action: redact.ActionMask}},
+				},
+			})
 			require.NoError(t, err)
 
-			_, err = processor.Client.SendMessage(t.Context(), &sqs.SendMessageInput{
-				QueueUrl:    processor.QueueURL,
-				MessageBody: aws.String(string(body)),
+			body, err := json.Marshal(models.Event{
+				EventType: "user_signup",
+				ClientID:  "client_789",
+				Payload:   map[string]any{"email": "jane@example.com"},
+				Timestamp: time.Now().UTC(),
 			})
 			require.NoError(t, err)
 
-			// Run processor in a goroutine so it consumes the message
-			ctx, cancel := context.WithCancel(t.Context())
-			defer cancel()
+			fakeDB := NewFakeDB()
 
-			go func() {
-				processor.Run(ctx) // blocks forever
-			}()
+			fake := runProcessorWith(t, fakeDB, &sqs.SendMessageInput{MessageBody: aws.String(string(body))},
+				processor.WithMiddleware(processor.Decode(), processor.Validate()),
+				processor.WithRules(engine),
+				processor.WithRedaction(redactor),
+			)
 
-			// Wait until the message is processed (poll the mock DB)
-			require.Eventually(t, func() bool {
-				return len(fakeDB.events) > 0
-			}, 10*time.Second, 500*time.Millisecond, "event was not processed in time")
+			require.Empty(t, fake.Messages("test-queue-dlq"))
 
-			// Check that event persisted correctly
-			require.Equal(t, test.input.ClientID, fakeDB.events[len(fakeDB.events)-1].ClientID)
-			require.Equal(t, test.input.EventType, fakeDB.events[len(fakeDB.events)-1].EventType)
+			events := fakeDB.Events()
+			redacted := fakeDB.Redacted()
+
+			if !test.saved {
+				require.Len(t, events, 3)
+				require.Empty(t, redacted)
+
+				return
+			}
+
+			require.Len(t, events, 4)
+			require.Equal(t, test.priority, events[3].Priority)
+			require.NotEqual(t, "jane@example.com", events[3].Payload.(map[string]any)["email"])
+
+			require.Len(t, redacted, 1)
+			require.Len(t, redacted[0].Redactions, test.redactions)
+			require.Equal(t, "email", redacted[0].Redactions[0].Field)
+			require.NotEmpty(t, redacted[0].Redactions[0].MessageID)
+		})
+	}
+}
+
+// TestRunReplayed checks replayed events are saved as they were stored,
+// without being enriched or redacted again.
+func TestRunReplayed(t *testing.T) {
+	type Test struct {
+		attributes map[string]types.MessageAttributeValue
+		messageID  string
+		email      string
+		redactions int
+	}
+
+	testCases := map[string]Test{
+		"New Event Enriched And Redacted": {
+			email:      "****************",
+			redactions: 1,
+		},
+		"Replayed Event Saved As Stored": {
+			attributes: map[string]types.MessageAttributeValue{
+				models.ReplayedAttribute: {DataType: aws.String("String"), StringValue: aws.String("true")},
+			},
+			messageID: "msg-original",
+			email:     "jane@example.com",
+		},
+	}
+
+	for scenario, test := range testCases {
+		t.Run(scenario, func(t *testing.T) {
+			redactor, err := redact.New(config.Redaction{
+				HMACKey: "secret",
+				Rules: map[string][]config.RedactionRule{
+					redact.AllEventTypes: {{Field: "email", Action: redact.ActionMask}},
+				},
+			})
+			require.NoError(t, err)
+
+			body, err := json.Marshal(models.Event{
+				EventType: "user_signup",
+				ClientID:  "client_789",
+				Payload:   map[string]any{"email": "jane@example.com"},
+				Timestamp: time.Now().UTC(),
+				MessageID: "msg-original",
+			})
+			require.NoError(t, err)
+
+			fakeDB := NewFakeDB()
+
+			runProcessorWith(t, fakeDB, &sqs.SendMessageInput{MessageBody: aws.String(string(body)), MessageAttributes: test.attributes},
+				processor.WithMiddleware(processor.Decode(), processor.Validate()),
+				processor.WithEnrichment(enrich.Pipeline{enrich.MessageMetadata()}),
+				processor.WithRedaction(redactor),
+			)
+
+			events := fakeDB.Events()
+			require.Len(t, events, 4)
+
+			if test.messageID != "" {
+				require.Equal(t, test.messageID, events[3].MessageID)
+			} else {
+				require.NotEqual(t, "msg-original", events[3].MessageID)
+			}
+
+			require.Equal(t, test.email, events[3].Payload.(map[string]any)["email"])
+
+			redacted := fakeDB.Redacted()
+			require.Len(t, redacted, 1)
+			require.Len(t, redacted[0].Redactions, test.redactions)
+		})
+	}
+}
+
+// TestRunMalformedEvents sends the kinds of malformed events the producer
+// injects, checking each ends up in the DLQ tagged and with its reason.
+func TestRunMalformedEvents(t *testing.T) {
+	type Test struct {
+		body          string
+		failureReason string
+	}
 
+	testCases := map[string]Test{
+		"Invalid JSON": {
+			body:          `{"event_type":"transaction_approved","client_id":"client_789","payl`,
+			failureReason: "event is invalid: unexpected end of JSON input",
+		},
+		"Missing Client ID": {
+			body:          `{"event_type":"transaction_approved","payload":{"amount":"1.00"},"timestamp":"2025-09-15T09:00:00Z"}`,
+			failureReason: "event is invalid: client_id is required",
+		},
+		"Bad Timestamp": {
+			body:          `{"event_type":"transaction_approved","client_id":"client_789","payload":{"amount":"1.00"},"timestamp":"15/09/2025 09:00:00"}`,
+			failureReason: `event is invalid: parsing time "15/09/2025 09:00:00"`,
+		},
+		"Oversized Payload": {
+			body:          `{"event_type":"transaction_approved","client_id":"client_789","payload":{"padding":"` + strings.Repeat("x", 4096) + `"},"timestamp":"2025-09-15T09:00:00Z"}`,
+			failureReason: "event is invalid: payload is longer than 1000 characters",
+		},
+		"Unknown Event Type": {
+			body:          `{"event_type":"unknown_event","client_id":"client_789","payload":{"amount":"1.00"},"timestamp":"2025-09-15T09:00:00Z"}`,
+			failureReason: `event is invalid: unknown event_type "unknown_event"`,
+		},
+	}
+
+	for scenario, test := range testCases {
+		t.Run(scenario, func(t *testing.T) {
+			fakeDB := NewFakeDB()
+
+			fake := runProcessor(t, fakeDB, &sqs.SendMessageInput{
+				MessageBody: aws.String(test.body),
+				MessageAttributes: map[string]types.MessageAttributeValue{
+					"fault": {DataType: aws.String("String"), StringValue: aws.String(scenario)},
+				},
+			},
+				processor.Decode(),
+				processor.Validate(),
+				processor.KnownEventTypes("transaction_approved"),
+			)
+
+			dead := fake.Messages("test-queue-dlq")
+			require.Len(t, dead, 1)
+			require.Equal(t, test.body, dead[0].Body)
+			require.Equal(t, scenario, dead[0].Attributes["fault"].StringValue)
+			require.Contains(t, dead[0].Attributes["failure_reason"].StringValue, test.failureReason)
+			require.Len(t, fakeDB.Events(), 3)
 		})
 	}
 }
+
+const validEvent = `{"event_type":"transaction_approved","client_id":"client_789","payload":{"amount":"1.00"},"timestamp":"2025-09-15T09:00:00Z"}`
+
+// TestRunAcksAfterShutdown checks a message handled as the processor shuts
+// down is still acked rather than redelivered.
+func TestRunAcksAfterShutdown(t *testing.T) {
+	fakeDB := NewFakeDB()
+	fake := newFakeSQS(t)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	t.Cleanup(cancel)
+
+	shutdown := func(next processor.Handler) processor.Handler {
+		return func(ctx context.Context, msg *processor.Message) error {
+			cancel()
+
+			return next(ctx, msg)
+		}
+	}
+
+	p := newProcessor(t, fake, fakeDB, processor.WithMiddleware(shutdown))
+	sendEvent(t, p, &sqs.SendMessageInput{MessageBody: aws.String(validEvent)})
+
+	done := make(chan struct{})
+
+	go func() {
+		p.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("processor did not shut down in time")
+	}
+
+	require.Empty(t, fake.Messages("test-queue"))
+	require.Len(t, fakeDB.Events(), 4)
+}
+
+// TestRunHeartbeat runs handlers past the visibility timeout, checking the
+// heartbeat keeps both the handled and the waiting messages from being
+// redelivered and stops once they are acked.
+func TestRunHeartbeat(t *testing.T) {
+	type call struct {
+		operation     string
+		receiptHandle string
+	}
+
+	var (
+		mu      sync.Mutex
+		calls   []call
+		handled = make(map[string]int)
+	)
+
+	fake := newFakeSQS(t)
+
+	// Records the queue operations made on each message
+	recorder := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		var input struct{ ReceiptHandle string }
+		_ = json.Unmarshal(body, &input)
+
+		mu.Lock()
+		calls = append(calls, call{operation: r.Header.Get("X-Amz-Target"), receiptHandle: input.ReceiptHandle})
+		mu.Unlock()
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		fake.ServeHTTP(w, r)
+	})
+
+	slow := func(next processor.Handler) processor.Handler {
+		return func(ctx context.Context, msg *processor.Message) error {
+			mu.Lock()
+			handled[aws.ToString(msg.MessageId)]++
+			mu.Unlock()
+
+			time.Sleep(1500 * time.Millisecond)
+
+			return next(ctx, msg)
+		}
+	}
+
+	fakeDB := NewFakeDB()
+
+	// One worker, so the second message waits past its visibility timeout
+	// before it is handled
+	p := newProcessor(t, recorder, fakeDB,
+		processor.WithConcurrency(1),
+		processor.WithVisibility(time.Second, 300*time.Millisecond),
+		processor.WithMiddleware(slow),
+	)
+	sendEvent(t, p, &sqs.SendMessageInput{MessageBody: aws.String(validEvent)})
+	sendEvent(t, p, &sqs.SendMessageInput{MessageBody: aws.String(validEvent)})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	t.Cleanup(cancel)
+
+	go p.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		return len(fake.Messages("test-queue")) == 0
+	}, 10*time.Second, 100*time.Millisecond, "events were not processed in time")
+
+	// Leave time for a heartbeat that outlived its ack to show up
+	time.Sleep(time.Second)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, handled, 2)
+
+	for id, count := range handled {
+		require.Equal(t, 1, count, "message %s was redelivered", id)
+	}
+
+	require.Len(t, fakeDB.Events(), 5)
+	require.Empty(t, fake.Messages("test-queue-dlq"))
+
+	acked := make(map[string]bool)
+	extended := 0
+
+	for _, c := range calls {
+		switch c.operation {
+		case "AmazonSQS.DeleteMessage":
+			acked[c.receiptHandle] = true
+		case "AmazonSQS.ChangeMessageVisibility":
+			require.False(t, acked[c.receiptHandle], "visibility extended after the message was acked")
+
+			extended++
+		}
+	}
+
+	require.Len(t, acked, 2)
+	require.NotZero(t, extended)
+}
+
+// runProcessor sends input to a fresh queue with a DLQ, runs a processor with
+// middlewares against it until the message leaves the queue and returns the
+// fake SQS.
+func runProcessor(t *testing.T, db processor.DB, input *sqs.SendMessageInput, middlewares ...processor.Middleware) *sqsfake.Server {
+	t.Helper()
+
+	return runProcessorWith(t, db, input, processor.WithMiddleware(middlewares...))
+}
+
+// runProcessorWith runs a processor with opts until it has handled input.
+func runProcessorWith(t *testing.T, db processor.DB, input *sqs.SendMessageInput, opts ...processor.Option) *sqsfake.Server {
+	t.Helper()
+
+	fake := newFakeSQS(t)
+
+	p := newProcessor(t, fake, db, opts...)
+	sendEvent(t, p, input)
+
+	// Run processor in a goroutine so it consumes the message
+	ctx, cancel := context.WithCancel(t.Context())
+	t.Cleanup(cancel)
+
+	go func() {
+		p.Run(ctx) // blocks forever
+	}()
+
+	// Wait until the message leaves the queue, acked or dead lettered
+	require.Eventually(t, func() bool {
+		return len(fake.Messages("test-queue")) == 0
+	}, 10*time.Second, 100*time.Millisecond, "event was not processed in time")
+
+	return fake
+}
+
+// newFakeSQS returns a fake SQS with a queue and its DLQ.
+func newFakeSQS(t *testing.T) *sqsfake.Server {
+	t.Helper()
+
+	fake := sqsfake.New()
+	require.NoError(t, fake.CreateQueue("test-queue-dlq", nil))
+	require.NoError(t, fake.CreateQueue("test-queue", map[string]string{
+		"VisibilityTimeout": "1",
+		"RedrivePolicy":     `{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:000000000000:test-queue-dlq","maxReceiveCount":"2"}`,
+	}))
+
+	return fake
+}
+
+// newProcessor returns a processor for the queues served by handler.
+func newProcessor(t *testing.T, handler http.Handler, db processor.DB, opts ...processor.Option) *processor.Processor {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	awsCfg := config.AWS{
+		AWSRegion:          "us-east-1",
+		AWSAccessKeyID:     "test",
+		AWSSecretAccessKey: "test",
+		SQSEndpoint:        server.URL,
+		SQSQueueName:       "test-queue",
+		SQSDLQName:         "test-queue-dlq",
+	}
+
+	p, err := processor.New(awsCfg, db, opts...)
+	require.NoError(t, err)
+
+	return p
+}
+
+func sendEvent(t *testing.T, p *processor.Processor, input *sqs.SendMessageInput) {
+	t.Helper()
+
+	input.QueueUrl = p.QueueURL
+
+	_, err := p.Client.SendMessage(t.Context(), input)
+	require.NoError(t, err)
+}
@@ -0,0 +1,107 @@
+package processor
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// scheduler handles messages concurrently while keeping the messages of a
+// group in the order they were received. A group stops at its first failed
+// message, the remaining ones are left on the queue to be redelivered in
+// order, without holding up any other group.
+type scheduler struct {
+	mu      sync.Mutex
+	queues  map[string][]*Message
+	workers chan struct{}
+	wg      sync.WaitGroup
+
+	handle func(ctx context.Context, msg *Message) error
+	// done is called once for every submitted message, handled or not.
+	done func(msg *Message)
+}
+
+func newScheduler(concurrency int, handle func(context.Context, *Message) error, done func(*Message)) *scheduler {
+	return &scheduler{
+		queues:  make(map[string][]*Message),
+		workers: make(chan struct{}, max(concurrency, 1)),
+		handle:  handle,
+		done:    done,
+	}
+}
+
+func (s *scheduler) submit(ctx context.Context, group string, msg *Message) {
+	s.mu.Lock()
+	queue, running := s.queues[group]
+	s.queues[group] = append(queue, msg)
+	s.mu.Unlock()
+
+	if running {
+		return
+	}
+
+	s.wg.Add(1)
+
+	go s.drain(ctx, group)
+}
+
+func (s *scheduler) drain(ctx context.Context, group string) {
+	defer s.wg.Done()
+
+	for {
+		msg, ok := s.next(group)
+		if !ok {
+			return
+		}
+
+		s.workers <- struct{}{}
+		err := s.handle(ctx, msg)
+		<-s.workers
+
+		s.done(msg)
+
+		if err != nil {
+			if skipped := s.stop(group); skipped > 0 {
+				log.Warn().Str("group", group).Int("skipped", skipped).Msg("left remaining group messages on the queue after a failure")
+			}
+
+			return
+		}
+	}
+}
+
+// next pops the head of the group queue, removing the group once it is empty
+// so the following submit starts a new drain.
+func (s *scheduler) next(group string) (*Message, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queue := s.queues[group]
+	if len(queue) == 0 {
+		delete(s.queues, group)
+
+		return nil, false
+	}
+
+	s.queues[group] = queue[1:]
+
+	return queue[0], true
+}
+
+func (s *scheduler) stop(group string) int {
+	s.mu.Lock()
+	skipped := s.queues[group]
+	delete(s.queues, group)
+	s.mu.Unlock()
+
+	for _, msg := range skipped {
+		s.done(msg)
+	}
+
+	return len(skipped)
+}
+
+func (s *scheduler) wait() {
+	s.wg.Wait()
+}
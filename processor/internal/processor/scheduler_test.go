@@ -0,0 +1,102 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduler(t *testing.T) {
+	type Test struct {
+		messages map[string][]string
+		failOn   string
+		handled  map[string][]string
+	}
+
+	testCases := map[string]Test{
+		"Keeps Order Within Groups": {
+			messages: map[string][]string{
+				"client_123": {"a1", "a2", "a3", "a4"},
+				"client_456": {"b1", "b2", "b3"},
+			},
+			handled: map[string][]string{
+				"client_123": {"a1", "a2", "a3", "a4"},
+				"client_456": {"b1", "b2", "b3"},
+			},
+		},
+		"Failure Stops Only Its Group": {
+			messages: map[string][]string{
+				"client_123": {"a1", "a2", "a3", "a4"},
+				"client_456": {"b1", "b2", "b3"},
+			},
+			failOn: "a2",
+			handled: map[string][]string{
+				"client_123": {"a1", "a2"},
+				"client_456": {"b1", "b2", "b3"},
+			},
+		},
+	}
+
+	for scenario, test := range testCases {
+		t.Run(scenario, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				handled = make(map[string][]string)
+				done    atomic.Int32
+				start   = make(chan struct{})
+			)
+
+			// Hold every handler until all messages are submitted, as if they
+			// had arrived in a single receive
+			handle := func(_ context.Context, msg *Message) error {
+				<-start
+				time.Sleep(time.Millisecond)
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				group := messageGroup(msg.Message)
+				handled[group] = append(handled[group], *msg.Body)
+
+				if *msg.Body == test.failOn {
+					return errors.New("failed")
+				}
+
+				return nil
+			}
+
+			s := newScheduler(4, handle, func(*Message) { done.Add(1) })
+
+			total := 0
+
+			for group, bodies := range test.messages {
+				for _, body := range bodies {
+					s.submit(t.Context(), group, &Message{
+						Message: types.Message{
+							MessageId: aws.String(body),
+							Body:      aws.String(body),
+							Attributes: map[string]string{
+								string(types.MessageSystemAttributeNameMessageGroupId): group,
+							},
+						},
+					})
+
+					total++
+				}
+			}
+
+			close(start)
+			s.wait()
+
+			assert.Equal(t, test.handled, handled)
+			assert.Equal(t, int32(total), done.Load())
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package processor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+// Sink receives a copy of the events routed to it by the rules engine.
+type Sink interface {
+	Send(ctx context.Context, event models.Event) error
+}
+
+// queueSink forwards events to an SQS queue in their JSON envelope.
+type queueSink struct {
+	client   *sqs.Client
+	queueURL *string
+}
+
+func (s *queueSink) Send(ctx context.Context, event models.Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:    s.queueURL,
+		MessageBody: aws.String(string(body)),
+	}
+
+	if isFIFO(*s.queueURL) {
+		sum := sha256.Sum256(body)
+
+		input.MessageGroupId = aws.String(event.ClientID)
+		input.MessageDeduplicationId = aws.String(hex.EncodeToString(sum[:]))
+	}
+
+	if _, err := s.client.SendMessage(ctx, input); err != nil {
+		return fmt.Errorf("failed to send event: %w", err)
+	}
+
+	return nil
+}
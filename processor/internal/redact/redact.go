@@ -0,0 +1,298 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/EWK20/event-processor/processor/models"
+)
+
+var (
+	ErrInvalidRule    = errors.New("invalid redaction rule")
+	ErrFailedToRedact = errors.New("failed to redact event")
+)
+
+const (
+	ActionMask     = "mask"
+	ActionHash     = "hash"
+	ActionTokenize = "tokenize"
+
+	// AllEventTypes configures rules applied to events of every type.
+	AllEventTypes = "*"
+
+	tokenPrefix = "tok_"
+	// tokenLength is the number of hex characters of a token after its
+	// prefix.
+	tokenLength = 32
+	maskChar    = "*"
+)
+
+var Actions = []string{ActionMask, ActionHash, ActionTokenize}
+
+// VaultEntry is the original value of a tokenized field, as JSON.
+type VaultEntry struct {
+	Token       string
+	ClientID    string
+	Fingerprint string
+	Value       string
+}
+
+// Redaction records the values of a field that were redacted in an event.
+type Redaction struct {
+	MessageID string
+	ClientID  string
+	EventType string
+	Field     string
+	Action    string
+	Count     int
+}
+
+// Result is what redacting an event produced, the vault entries of its
+// tokenized values and the audit records of its redacted fields. It is saved
+// with the event, so nothing is recorded for events that aren't saved.
+type Result struct {
+	Vault      []VaultEntry
+	Redactions []Redaction
+}
+
+// Merge appends the entries and records of other to r.
+func (r *Result) Merge(other Result) {
+	r.Vault = append(r.Vault, other.Vault...)
+	r.Redactions = append(r.Redactions, other.Redactions...)
+}
+
+type rule struct {
+	field   string
+	path    []string
+	action  string
+	keep    int
+	clients []string
+}
+
+// Redactor applies the redaction rules of an event's type to its payload.
+type Redactor struct {
+	rules map[string][]rule
+	key   []byte
+}
+
+func New(cfg config.Redaction) (*Redactor, error) {
+	redactor := &Redactor{
+		rules: make(map[string][]rule, len(cfg.Rules)),
+		key:   []byte(cfg.HMACKey),
+	}
+
+	var errs []error
+
+	for eventType, rules := range cfg.Rules {
+		for _, r := range rules {
+			name := eventType + ": " + r.Field
+
+			switch {
+			case r.Field == "":
+				errs = append(errs, fmt.Errorf("%w: %s: field is required", ErrInvalidRule, eventType))
+			case !slices.Contains(Actions, r.Action):
+				errs = append(errs, fmt.Errorf("%w: %s: action %q is not one of %v", ErrInvalidRule, name, r.Action, Actions))
+			case r.Keep < 0:
+				errs = append(errs, fmt.Errorf("%w: %s: keep can't be negative", ErrInvalidRule, name))
+			case r.Action != ActionMask && cfg.HMACKey == "":
+				errs = append(errs, fmt.Errorf("%w: %s: %s needs redaction.hmac_key", ErrInvalidRule, name, r.Action))
+			}
+
+			redactor.rules[eventType] = append(redactor.rules[eventType], rule{
+				field:   r.Field,
+				path:    strings.Split(r.Field, "."),
+				action:  r.Action,
+				keep:    r.Keep,
+				clients: r.Clients,
+			})
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return redactor, nil
+}
+
+// Redact replaces the fields of the event's payload matched by a rule in
+// place, and returns an audit record, for the message messageID, of every
+// field changed and the vault entries of the values tokenized. Missing fields
+// and null values are skipped. Nothing is saved, a value always gets the same
+// token so saving the result again doesn't add to the vault.
+func (r *Redactor) Redact(event *models.Event, messageID string) (Result, error) {
+	var (
+		result Result
+		tokens = make(map[string]bool)
+	)
+
+	for _, rule := range slices.Concat(r.rules[event.EventType], r.rules[AllEventTypes]) {
+		if len(rule.clients) > 0 && !slices.Contains(rule.clients, event.ClientID) {
+			continue
+		}
+
+		count := 0
+
+		payload, err := replace(event.Payload, rule.path, func(value any) (any, error) {
+			count++
+
+			replaced, entry, err := r.apply(rule, event.ClientID, value)
+			if err != nil || entry == nil {
+				return replaced, err
+			}
+
+			if !tokens[entry.Token] {
+				tokens[entry.Token] = true
+				result.Vault = append(result.Vault, *entry)
+			}
+
+			return replaced, nil
+		})
+		if err != nil {
+			return Result{}, fmt.Errorf("%w: %s: %w", ErrFailedToRedact, rule.field, err)
+		}
+
+		event.Payload = payload
+
+		if count > 0 {
+			result.Redactions = append(result.Redactions, Redaction{
+				MessageID: messageID,
+				ClientID:  event.ClientID,
+				EventType: event.EventType,
+				Field:     rule.field,
+				Action:    rule.action,
+				Count:     count,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// apply returns the redacted value, and the vault entry of tokenized ones.
+func (r *Redactor) apply(rule rule, clientID string, value any) (any, *VaultEntry, error) {
+	switch rule.action {
+	case ActionMask:
+		return mask(text(value), rule.keep), nil, nil
+	case ActionHash:
+		fingerprint, err := r.fingerprint(value)
+
+		return fingerprint, nil, err
+	default:
+		fingerprint, err := r.fingerprint(value)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		original, err := json.Marshal(value)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		entry := &VaultEntry{
+			Token:       r.token(clientID, fingerprint),
+			ClientID:    clientID,
+			Fingerprint: fingerprint,
+			Value:       string(original),
+		}
+
+		return entry.Token, entry, nil
+	}
+}
+
+// token derives the token of a client's value from its fingerprint, so the
+// value always gets the same token and other clients get their own.
+func (r *Redactor) token(clientID, fingerprint string) string {
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(clientID + "\x00" + fingerprint))
+
+	return tokenPrefix + hex.EncodeToString(mac.Sum(nil))[:tokenLength]
+}
+
+// fingerprint is the hex HMAC-SHA256 of value's JSON, so equal values hash
+// the same way whatever their field.
+func (r *Redactor) fingerprint(value any) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write(data)
+
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// mask hides every character of s but the last keep ones. Values no longer
+// than keep are hidden entirely.
+func mask(s string, keep int) string {
+	runes := []rune(s)
+
+	hidden := len(runes) - keep
+	if hidden <= 0 {
+		hidden = len(runes)
+	}
+
+	return strings.Repeat(maskChar, hidden) + string(runes[hidden:])
+}
+
+func text(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+
+	data, _ := json.Marshal(value)
+
+	return string(data)
+}
+
+// replace replaces the non null values at path with fn, in place. Paths go
+// through arrays, so "items.serial" replaces the serial of every item.
+func replace(value any, path []string, fn func(value any) (any, error)) (any, error) {
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		for i, item := range v {
+			replaced, err := replace(item, path, fn)
+			if err != nil {
+				return nil, err
+			}
+
+			v[i] = replaced
+		}
+
+		return v, nil
+	case map[string]any:
+		if len(path) == 0 {
+			return fn(value)
+		}
+
+		child, ok := v[path[0]]
+		if !ok {
+			return value, nil
+		}
+
+		replaced, err := replace(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+
+		v[path[0]] = replaced
+
+		return v, nil
+	default:
+		if len(path) > 0 {
+			return value, nil
+		}
+
+		return fn(value)
+	}
+}
@@ -0,0 +1,224 @@
+package redact_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/EWK20/event-processor/processor/internal/redact"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func payload() map[string]any {
+	return map[string]any{
+		"amount": "10.00",
+		"card":   map[string]any{"number": "4111111111111111"},
+		"items":  []any{map[string]any{"serial": "abc"}, map[string]any{"serial": nil}, map[string]any{}},
+		"email":  "jo@example.com",
+		"age":    42.0,
+	}
+}
+
+func TestRedact(t *testing.T) {
+	type Test struct {
+		rules      map[string][]config.RedactionRule
+		event      models.Event
+		output     map[string]any
+		redactions []redact.Redaction
+	}
+
+	event := models.Event{EventType: "transaction_approved", ClientID: "client_123", MessageID: "msg-1", Payload: payload()}
+
+	redacted := func(changes map[string]any) map[string]any {
+		p := payload()
+		for key, value := range changes {
+			p[key] = value
+		}
+
+		return p
+	}
+
+	testCases := map[string]Test{
+		"Mask Keeps Trailing Characters": {
+			rules: map[string][]config.RedactionRule{
+				"transaction_approved": {{Field: "card.number", Action: redact.ActionMask, Keep: 4}},
+			},
+			event:  event,
+			output: redacted(map[string]any{"card": map[string]any{"number": "************1111"}}),
+			redactions: []redact.Redaction{
+				{MessageID: "msg-1", ClientID: "client_123", EventType: "transaction_approved", Field: "card.number", Action: redact.ActionMask, Count: 1},
+			},
+		},
+		"Mask Short And Non String Values": {
+			rules: map[string][]config.RedactionRule{
+				"transaction_approved": {{Field: "age", Action: redact.ActionMask, Keep: 2}, {Field: "amount", Action: redact.ActionMask}},
+			},
+			event:  event,
+			output: redacted(map[string]any{"age": "**", "amount": "*****"}),
+			redactions: []redact.Redaction{
+				{MessageID: "msg-1", ClientID: "client_123", EventType: "transaction_approved", Field: "age", Action: redact.ActionMask, Count: 1},
+				{MessageID: "msg-1", ClientID: "client_123", EventType: "transaction_approved", Field: "amount", Action: redact.ActionMask, Count: 1},
+			},
+		},
+		"Fields In Arrays Skip Nulls": {
+			rules: map[string][]config.RedactionRule{
+				redact.AllEventTypes: {{Field: "items.serial", Action: redact.ActionMask}},
+			},
+			event:  event,
+			output: redacted(map[string]any{"items": []any{map[string]any{"serial": "***"}, map[string]any{"serial": nil}, map[string]any{}}}),
+			redactions: []redact.Redaction{
+				{MessageID: "msg-1", ClientID: "client_123", EventType: "transaction_approved", Field: "items.serial", Action: redact.ActionMask, Count: 1},
+			},
+		},
+		"Other Client": {
+			rules: map[string][]config.RedactionRule{
+				"transaction_approved": {{Field: "email", Action: redact.ActionMask, Clients: []string{"client_456"}}},
+			},
+			event:  event,
+			output: payload(),
+		},
+		"Other Event Type": {
+			rules: map[string][]config.RedactionRule{
+				"transaction_refunded": {{Field: "email", Action: redact.ActionMask}},
+			},
+			event:  event,
+			output: payload(),
+		},
+		"Missing Field": {
+			rules: map[string][]config.RedactionRule{
+				"transaction_approved": {{Field: "customer.email", Action: redact.ActionHash}},
+			},
+			event:  event,
+			output: payload(),
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			redactor, err := redact.New(config.Redaction{HMACKey: "secret", Rules: test.rules})
+			require.NoError(t, err)
+
+			event := test.event
+			event.Payload = payload()
+
+			result, err := redactor.Redact(&event, "msg-1")
+			require.NoError(t, err)
+			assert.Equal(t, test.output, event.Payload)
+			assert.Equal(t, test.redactions, result.Redactions)
+			assert.Empty(t, result.Vault)
+		})
+	}
+}
+
+func TestHash(t *testing.T) {
+	rules := map[string][]config.RedactionRule{
+		"transaction_approved": {{Field: "email", Action: redact.ActionHash}},
+	}
+
+	hash := func(key string) string {
+		redactor, err := redact.New(config.Redaction{HMACKey: key, Rules: rules})
+		require.NoError(t, err)
+
+		event := models.Event{EventType: "transaction_approved", Payload: payload()}
+		_, err = redactor.Redact(&event, "")
+		require.NoError(t, err)
+
+		return event.Payload.(map[string]any)["email"].(string)
+	}
+
+	assert.Len(t, hash("secret"), 64)
+	assert.Equal(t, hash("secret"), hash("secret"))
+	assert.NotEqual(t, hash("secret"), hash("other secret"))
+}
+
+func TestTokenize(t *testing.T) {
+	redactor, err := redact.New(config.Redaction{
+		HMACKey: "secret",
+		Rules: map[string][]config.RedactionRule{
+			redact.AllEventTypes: {{Field: "email", Action: redact.ActionTokenize}, {Field: "items.serial", Action: redact.ActionTokenize}},
+		},
+	})
+	require.NoError(t, err)
+
+	tokenize := func(clientID string) (string, redact.Result) {
+		event := models.Event{EventType: "transaction_approved", ClientID: clientID, Payload: payload()}
+
+		result, err := redactor.Redact(&event, "msg-1")
+		require.NoError(t, err)
+
+		return event.Payload.(map[string]any)["email"].(string), result
+	}
+
+	token, result := tokenize("client_123")
+	assert.True(t, strings.HasPrefix(token, "tok_"), token)
+
+	// A client's value always gets the same token, other clients get their own
+	again, _ := tokenize("client_123")
+	assert.Equal(t, token, again)
+
+	other, _ := tokenize("client_456")
+	assert.NotEqual(t, token, other)
+
+	require.Len(t, result.Vault, 2)
+	assert.Equal(t, redact.VaultEntry{
+		Token:       token,
+		ClientID:    "client_123",
+		Fingerprint: result.Vault[0].Fingerprint,
+		Value:       `"jo@example.com"`,
+	}, result.Vault[0])
+	assert.Len(t, result.Redactions, 2)
+}
+
+// TestTokenizeRepeatedValues checks a value repeated in an event has a single
+// vault entry.
+func TestTokenizeRepeatedValues(t *testing.T) {
+	redactor, err := redact.New(config.Redaction{
+		HMACKey: "secret",
+		Rules: map[string][]config.RedactionRule{
+			redact.AllEventTypes: {{Field: "items.serial", Action: redact.ActionTokenize}},
+		},
+	})
+	require.NoError(t, err)
+
+	event := models.Event{
+		EventType: "transaction_approved",
+		ClientID:  "client_123",
+		Payload:   map[string]any{"items": []any{map[string]any{"serial": "abc"}, map[string]any{"serial": "abc"}}},
+	}
+
+	result, err := redactor.Redact(&event, "msg-1")
+	require.NoError(t, err)
+	assert.Len(t, result.Vault, 1)
+	assert.Equal(t, []redact.Redaction{
+		{MessageID: "msg-1", ClientID: "client_123", EventType: "transaction_approved", Field: "items.serial", Action: redact.ActionTokenize, Count: 2},
+	}, result.Redactions)
+}
+
+func TestNewInvalidRules(t *testing.T) {
+	testCases := map[string]config.Redaction{
+		"Unknown Action": {
+			Rules: map[string][]config.RedactionRule{"*": {{Field: "email", Action: "encrypt"}}},
+		},
+		"Missing Field": {
+			Rules: map[string][]config.RedactionRule{"*": {{Action: redact.ActionMask}}},
+		},
+		"Negative Keep": {
+			Rules: map[string][]config.RedactionRule{"*": {{Field: "email", Action: redact.ActionMask, Keep: -1}}},
+		},
+		"Hash Without Key": {
+			Rules: map[string][]config.RedactionRule{"*": {{Field: "email", Action: redact.ActionHash}}},
+		},
+		"Tokenize Without Key": {
+			Rules: map[string][]config.RedactionRule{"*": {{Field: "email", Action: redact.ActionTokenize}}},
+		},
+	}
+
+	for name, cfg := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := redact.New(cfg)
+			require.ErrorIs(t, err, redact.ErrInvalidRule)
+		})
+	}
+}
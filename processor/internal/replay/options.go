@@ -0,0 +1,42 @@
+package replay
+
+import "github.com/EWK20/event-processor/processor/internal/db"
+
+type Option func(*Replayer)
+
+// WithFilter selects the events to replay, every event is replayed otherwise.
+func WithFilter(filter db.Filter) Option {
+	return func(r *Replayer) {
+		r.filter = filter
+	}
+}
+
+// WithRate limits the replay to rate events per second, 0 means unlimited.
+func WithRate(rate float64) Option {
+	return func(r *Replayer) {
+		r.rate = max(rate, 0)
+	}
+}
+
+// WithBatchSize sets how many events are sent per SendMessageBatch call, up
+// to MaxBatchSize.
+func WithBatchSize(size int) Option {
+	return func(r *Replayer) {
+		r.batchSize = min(max(size, 1), MaxBatchSize)
+	}
+}
+
+// WithCheckpoint saves the progress of the replay to path, resuming from it
+// when it already exists.
+func WithCheckpoint(path string) Option {
+	return func(r *Replayer) {
+		r.checkpoint = path
+	}
+}
+
+// WithDryRun only counts the events that would be replayed.
+func WithDryRun(dryRun bool) Option {
+	return func(r *Replayer) {
+		r.dryRun = dryRun
+	}
+}
@@ -0,0 +1,281 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/db"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+)
+
+var (
+	ErrFailedToSend            = errors.New("failed to send events")
+	ErrFailedToReadCheckpoint  = errors.New("failed to read checkpoint")
+	ErrFailedToWriteCheckpoint = errors.New("failed to write checkpoint")
+	ErrCheckpointMismatch      = errors.New("checkpoint belongs to a different replay")
+)
+
+// MaxBatchSize is the most messages SendMessageBatch accepts.
+const MaxBatchSize = 10
+
+type Source interface {
+	Events(ctx context.Context, filter db.Filter, afterID int64, limit int) ([]models.Event, error)
+	CountEvents(ctx context.Context, filter db.Filter, afterID int64) (int64, error)
+}
+
+type Queue interface {
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
+
+// Result describes a finished, or interrupted, replay.
+type Result struct {
+	Events int64
+	LastID int64
+}
+
+// Replayer republishes stored events to a queue, as they were saved.
+type Replayer struct {
+	source   Source
+	queue    Queue
+	queueURL string
+
+	filter     db.Filter
+	rate       float64
+	batchSize  int
+	checkpoint string
+	dryRun     bool
+}
+
+func New(source Source, queue Queue, queueURL string, opts ...Option) *Replayer {
+	replayer := &Replayer{
+		source:    source,
+		queue:     queue,
+		queueURL:  queueURL,
+		batchSize: MaxBatchSize,
+	}
+
+	for _, opt := range opts {
+		opt(replayer)
+	}
+
+	return replayer
+}
+
+// Run replays every selected event after the checkpoint, if any, saving the
+// checkpoint after each batch. A batch that fails is sent again on resume, so
+// events are replayed at least once.
+func (r *Replayer) Run(ctx context.Context) (Result, error) {
+	state, err := r.loadCheckpoint()
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := Result{LastID: state.LastID}
+
+	if r.dryRun {
+		count, err := r.source.CountEvents(ctx, r.filter, state.LastID)
+		if err != nil {
+			return result, err
+		}
+
+		result.Events = count
+
+		return result, nil
+	}
+
+	// A batch may be sent as soon as the rate allows all of its events
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if r.rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(r.rate), r.batchSize)
+	}
+
+	for {
+		events, err := r.source.Events(ctx, r.filter, state.LastID, r.batchSize)
+		if err != nil {
+			return result, err
+		}
+
+		if len(events) == 0 {
+			return result, nil
+		}
+
+		if err := limiter.WaitN(ctx, len(events)); err != nil {
+			return result, err
+		}
+
+		if err := r.send(ctx, events); err != nil {
+			return result, err
+		}
+
+		state.LastID = events[len(events)-1].ID
+
+		if err := r.saveCheckpoint(state); err != nil {
+			return result, err
+		}
+
+		result.Events += int64(len(events))
+		result.LastID = state.LastID
+
+		log.Debug().Int64("last_id", state.LastID).Int64("replayed", result.Events).Msg("replayed batch")
+	}
+}
+
+func (r *Replayer) send(ctx context.Context, events []models.Event) error {
+	fifo := strings.HasSuffix(r.queueURL, ".fifo")
+
+	entries := make([]types.SendMessageBatchRequestEntry, 0, len(events))
+
+	for _, event := range events {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("%w: event %d: %w", ErrFailedToSend, event.ID, err)
+		}
+
+		// The stored event is already enriched and redacted, the attribute
+		// tells the processor not to do it again
+		entry := types.SendMessageBatchRequestEntry{
+			Id:          aws.String(strconv.FormatInt(event.ID, 10)),
+			MessageBody: aws.String(string(body)),
+			MessageAttributes: map[string]types.MessageAttributeValue{
+				models.ReplayedAttribute: {DataType: aws.String("String"), StringValue: aws.String("true")},
+			},
+		}
+
+		// The event ID makes a batch resent on resume a duplicate within the
+		// FIFO deduplication interval
+		if fifo {
+			entry.MessageGroupId = aws.String(event.ClientID)
+			entry.MessageDeduplicationId = aws.String("replay-" + strconv.FormatInt(event.ID, 10))
+		}
+
+		entries = append(entries, entry)
+	}
+
+	output, err := r.queue.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(r.queueURL),
+		Entries:  entries,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToSend, err)
+	}
+
+	if len(output.Failed) > 0 {
+		var errs []error
+
+		for _, failed := range output.Failed {
+			errs = append(errs, fmt.Errorf("event %s: %s: %s", aws.ToString(failed.Id), aws.ToString(failed.Code), aws.ToString(failed.Message)))
+		}
+
+		return fmt.Errorf("%w: %w", ErrFailedToSend, errors.Join(errs...))
+	}
+
+	return nil
+}
+
+// checkpoint records how far a replay got. The filter and queue are kept so
+// a checkpoint isn't resumed by a different replay.
+type checkpoint struct {
+	QueueURL  string    `json:"queue_url"`
+	ClientID  string    `json:"client_id,omitempty"`
+	EventType string    `json:"event_type,omitempty"`
+	From      time.Time `json:"from,omitzero"`
+	To        time.Time `json:"to,omitzero"`
+	LastID    int64     `json:"last_id"`
+}
+
+func (r *Replayer) newCheckpoint() checkpoint {
+	return checkpoint{
+		QueueURL:  r.queueURL,
+		ClientID:  r.filter.ClientID,
+		EventType: r.filter.EventType,
+		From:      r.filter.From.UTC(),
+		To:        r.filter.To.UTC(),
+	}
+}
+
+func (c checkpoint) matches(other checkpoint) bool {
+	return c.QueueURL == other.QueueURL &&
+		c.ClientID == other.ClientID &&
+		c.EventType == other.EventType &&
+		c.From.Equal(other.From) &&
+		c.To.Equal(other.To)
+}
+
+func (r *Replayer) loadCheckpoint() (checkpoint, error) {
+	state := r.newCheckpoint()
+
+	if r.checkpoint == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(r.checkpoint)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("%w: %w", ErrFailedToReadCheckpoint, err)
+	}
+
+	var saved checkpoint
+
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return state, fmt.Errorf("%w: %s: %w", ErrFailedToReadCheckpoint, r.checkpoint, err)
+	}
+
+	if !saved.matches(state) {
+		return state, fmt.Errorf("%w: %s", ErrCheckpointMismatch, r.checkpoint)
+	}
+
+	state.LastID = saved.LastID
+
+	log.Info().Str("checkpoint", r.checkpoint).Int64("last_id", state.LastID).Msg("resuming replay from checkpoint")
+
+	return state, nil
+}
+
+// saveCheckpoint replaces the checkpoint file atomically so an interrupted
+// write can't corrupt it.
+func (r *Replayer) saveCheckpoint(state checkpoint) error {
+	if r.checkpoint == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToWriteCheckpoint, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(r.checkpoint), filepath.Base(r.checkpoint)+".*")
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToWriteCheckpoint, err)
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+
+		return fmt.Errorf("%w: %w", ErrFailedToWriteCheckpoint, err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToWriteCheckpoint, err)
+	}
+
+	if err := os.Rename(tmp.Name(), r.checkpoint); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToWriteCheckpoint, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package replay_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/db"
+	"github.com/EWK20/event-processor/processor/internal/replay"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSource struct {
+	events []models.Event
+}
+
+func (s *fakeSource) Events(_ context.Context, filter db.Filter, afterID int64, limit int) ([]models.Event, error) {
+	var events []models.Event
+
+	for _, event := range s.events {
+		if event.ID > afterID && (filter.ClientID == "" || event.ClientID == filter.ClientID) && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func (s *fakeSource) CountEvents(ctx context.Context, filter db.Filter, afterID int64) (int64, error) {
+	events, err := s.Events(ctx, filter, afterID, len(s.events))
+
+	return int64(len(events)), err
+}
+
+type fakeQueue struct {
+	batches [][]types.SendMessageBatchRequestEntry
+	// failOn fails the batch containing the entry with this ID
+	failOn string
+}
+
+func (q *fakeQueue) SendMessageBatch(_ context.Context, input *sqs.SendMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	for _, entry := range input.Entries {
+		if aws.ToString(entry.Id) == q.failOn {
+			return &sqs.SendMessageBatchOutput{
+				Failed: []types.BatchResultErrorEntry{{Id: entry.Id, Code: aws.String("InternalError")}},
+			}, nil
+		}
+	}
+
+	q.batches = append(q.batches, input.Entries)
+
+	return &sqs.SendMessageBatchOutput{}, nil
+}
+
+func (q *fakeQueue) ids() []string {
+	var ids []string
+
+	for _, batch := range q.batches {
+		for _, entry := range batch {
+			ids = append(ids, aws.ToString(entry.Id))
+		}
+	}
+
+	return ids
+}
+
+func newEvents(n int) []models.Event {
+	clientIDs := []string{"client_123", "client_456"}
+
+	events := make([]models.Event, 0, n)
+
+	for i := range n {
+		events = append(events, models.Event{
+			ID:            int64(i + 1),
+			EventType:     "transaction_approved",
+			ClientID:      clientIDs[i%len(clientIDs)],
+			Payload:       map[string]any{"transaction_id": "txn_1", "amount": "10.00", "currency": "GBP"},
+			Timestamp:     time.Date(2025, 8, 18, 7, 48, 48, 0, time.UTC),
+			Priority:      "high",
+			SchemaVersion: 1,
+		})
+	}
+
+	return events
+}
+
+func TestRun(t *testing.T) {
+	type Test struct {
+		opts    []replay.Option
+		batches int
+		ids     []string
+		result  replay.Result
+	}
+
+	testCases := map[string]Test{
+		"Replays In Batches": {
+			opts:    []replay.Option{replay.WithBatchSize(2)},
+			batches: 3,
+			ids:     []string{"1", "2", "3", "4", "5"},
+			result:  replay.Result{Events: 5, LastID: 5},
+		},
+		"Batch Size Is Capped": {
+			opts:    []replay.Option{replay.WithBatchSize(100)},
+			batches: 1,
+			ids:     []string{"1", "2", "3", "4", "5"},
+			result:  replay.Result{Events: 5, LastID: 5},
+		},
+		"Filters Events": {
+			opts:    []replay.Option{replay.WithFilter(db.Filter{ClientID: "client_456"})},
+			batches: 1,
+			ids:     []string{"2", "4"},
+			result:  replay.Result{Events: 2, LastID: 4},
+		},
+		"Dry Run Only Counts": {
+			opts:   []replay.Option{replay.WithDryRun(true)},
+			result: replay.Result{Events: 5},
+		},
+	}
+
+	for scenario, test := range testCases {
+		t.Run(scenario, func(t *testing.T) {
+			queue := &fakeQueue{}
+
+			replayer := replay.New(&fakeSource{events: newEvents(5)}, queue, "http://localhost:4566/000000000000/events", test.opts...)
+
+			result, err := replayer.Run(t.Context())
+			require.NoError(t, err)
+
+			assert.Equal(t, test.result, result)
+			assert.Len(t, queue.batches, test.batches)
+			assert.Equal(t, test.ids, queue.ids())
+		})
+	}
+}
+
+func TestRunSendsStoredEvent(t *testing.T) {
+	queue := &fakeQueue{}
+
+	_, err := replay.New(&fakeSource{events: newEvents(1)}, queue, "http://localhost:4566/000000000000/events.fifo").Run(t.Context())
+	require.NoError(t, err)
+	require.Len(t, queue.batches, 1)
+
+	entry := queue.batches[0][0]
+
+	assert.JSONEq(t, `{
+		"id": 1,
+		"event_type": "transaction_approved",
+		"client_id": "client_123",
+		"payload": {"transaction_id": "txn_1", "amount": "10.00", "currency": "GBP"},
+		"timestamp": "2025-08-18T07:48:48Z",
+		"priority": "high",
+		"schema_version": 1
+	}`, aws.ToString(entry.MessageBody))
+	assert.Equal(t, "true", aws.ToString(entry.MessageAttributes[models.ReplayedAttribute].StringValue))
+	assert.Equal(t, "client_123", aws.ToString(entry.MessageGroupId))
+	assert.Equal(t, "replay-1", aws.ToString(entry.MessageDeduplicationId))
+}
+
+func TestRunResumesFromCheckpoint(t *testing.T) {
+	checkpoint := filepath.Join(t.TempDir(), "replay.json")
+	source := &fakeSource{events: newEvents(5)}
+
+	// The batch holding event 3 fails, so the replay stops after event 2
+	queue := &fakeQueue{failOn: "3"}
+
+	result, err := replay.New(source, queue, "queue", replay.WithBatchSize(2), replay.WithCheckpoint(checkpoint)).Run(t.Context())
+	require.ErrorIs(t, err, replay.ErrFailedToSend)
+	assert.Equal(t, replay.Result{Events: 2, LastID: 2}, result)
+
+	count, err := replay.New(source, queue, "queue", replay.WithCheckpoint(checkpoint), replay.WithDryRun(true)).Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, replay.Result{Events: 3, LastID: 2}, count)
+
+	queue.failOn = ""
+
+	result, err = replay.New(source, queue, "queue", replay.WithBatchSize(2), replay.WithCheckpoint(checkpoint)).Run(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, replay.Result{Events: 3, LastID: 5}, result)
+	assert.Equal(t, []string{"1", "2", "3", "4", "5"}, queue.ids())
+
+	// A different replay can't pick up the checkpoint
+	_, err = replay.New(source, queue, "other-queue", replay.WithCheckpoint(checkpoint)).Run(t.Context())
+	require.ErrorIs(t, err, replay.ErrCheckpointMismatch)
+}
+
+func TestRunRateLimit(t *testing.T) {
+	queue := &fakeQueue{}
+
+	start := time.Now()
+
+	_, err := replay.New(&fakeSource{events: newEvents(4)}, queue, "queue", replay.WithBatchSize(2), replay.WithRate(20)).Run(t.Context())
+	require.NoError(t, err)
+
+	// The second batch waits for the 2 events of the first at 20 per second
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	_, err := replay.New(&fakeSource{events: newEvents(4)}, &fakeQueue{}, "queue", replay.WithBatchSize(2), replay.WithRate(1)).Run(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,136 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var conditionPattern = regexp.MustCompile(`^\s*([A-Za-z_][\w.]*)\s*(==|!=|>=|<=|>|<|\scontains\s)\s*(.+?)\s*$`)
+
+// condition compares a payload field, addressed by a dotted path, with a
+// literal value, e.g. `amount > 10000` or `card.country == "GB"`.
+type condition struct {
+	field string
+	op    string
+	value any
+}
+
+func parseCondition(expr string) (condition, error) {
+	parts := conditionPattern.FindStringSubmatch(expr)
+	if parts == nil {
+		return condition{}, fmt.Errorf("unable to parse expression %q", expr)
+	}
+
+	return condition{
+		field: parts[1],
+		op:    strings.TrimSpace(parts[2]),
+		value: parseLiteral(parts[3]),
+	}, nil
+}
+
+func parseLiteral(literal string) any {
+	if unquoted, err := strconv.Unquote(literal); err == nil {
+		return unquoted
+	}
+
+	if len(literal) >= 2 && literal[0] == '\'' && literal[len(literal)-1] == '\'' {
+		return literal[1 : len(literal)-1]
+	}
+
+	if number, err := strconv.ParseFloat(literal, 64); err == nil {
+		return number
+	}
+
+	if boolean, err := strconv.ParseBool(literal); err == nil {
+		return boolean
+	}
+
+	return literal
+}
+
+func (c condition) matches(payload any) bool {
+	actual, ok := lookup(payload, c.field)
+	if !ok {
+		return false
+	}
+
+	switch c.op {
+	case "contains":
+		return strings.Contains(fmt.Sprint(actual), fmt.Sprint(c.value))
+	case "==":
+		return equal(actual, c.value)
+	case "!=":
+		return !equal(actual, c.value)
+	}
+
+	left, ok := toNumber(actual)
+	if !ok {
+		return false
+	}
+
+	right, ok := toNumber(c.value)
+	if !ok {
+		return false
+	}
+
+	switch c.op {
+	case ">":
+		return left > right
+	case ">=":
+		return left >= right
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	}
+
+	return false
+}
+
+func lookup(payload any, field string) (any, bool) {
+	current := payload
+
+	for _, key := range strings.Split(field, ".") {
+		fields, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+
+		if current, ok = fields[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+func equal(actual, expected any) bool {
+	if right, ok := expected.(float64); ok {
+		left, ok := toNumber(actual)
+
+		return ok && left == right
+	}
+
+	return fmt.Sprint(actual) == fmt.Sprint(expected)
+}
+
+// toNumber accepts JSON numbers as well as numeric strings, since amounts are
+// often sent as strings to avoid floating point issues.
+func toNumber(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case string:
+		number, err := strconv.ParseFloat(v, 64)
+
+		return number, err == nil
+	}
+
+	return 0, false
+}
@@ -0,0 +1,159 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/EWK20/event-processor/processor/models"
+)
+
+var (
+	ErrInvalidRule = errors.New("invalid rule")
+)
+
+// Decision is the outcome of evaluating every rule against an event.
+type Decision struct {
+	Rules    []string
+	Priority string
+	Category string
+	Routes   []string
+	Drop     bool
+}
+
+type rule struct {
+	name       string
+	eventType  string
+	clientID   string
+	conditions []condition
+	priority   string
+	category   string
+	routes     []string
+	drop       bool
+}
+
+// Engine triages events against an ordered list of rules. Every matching
+// rule applies: the first one to set a priority or category wins, routes are
+// accumulated and any matching drop rule drops the event.
+type Engine struct {
+	rules []rule
+}
+
+func New(cfg []config.Rule) (*Engine, error) {
+	engine := &Engine{}
+
+	var errs []error
+
+	for i, r := range cfg {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		compiled := rule{
+			name:      name,
+			eventType: r.EventType,
+			clientID:  r.ClientID,
+			priority:  r.Priority,
+			category:  r.Category,
+			routes:    r.RouteTo,
+			drop:      r.Drop,
+		}
+
+		for _, pattern := range []string{r.EventType, r.ClientID} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, fmt.Errorf("%w: %s: %q: %w", ErrInvalidRule, name, pattern, err))
+			}
+		}
+
+		for _, expr := range r.When {
+			cond, err := parseCondition(expr)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%w: %s: %w", ErrInvalidRule, name, err))
+
+				continue
+			}
+
+			compiled.conditions = append(compiled.conditions, cond)
+		}
+
+		engine.rules = append(engine.rules, compiled)
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	return engine, nil
+}
+
+func (e *Engine) Evaluate(event models.Event) Decision {
+	var decision Decision
+
+	for _, r := range e.rules {
+		if !r.matches(event) {
+			continue
+		}
+
+		decision.Rules = append(decision.Rules, r.name)
+
+		if decision.Priority == "" {
+			decision.Priority = r.priority
+		}
+
+		if decision.Category == "" {
+			decision.Category = r.category
+		}
+
+		for _, route := range r.routes {
+			if !slices.Contains(decision.Routes, route) {
+				decision.Routes = append(decision.Routes, route)
+			}
+		}
+
+		decision.Drop = decision.Drop || r.drop
+	}
+
+	return decision
+}
+
+// Routes returns every route a rule may send events to.
+func (e *Engine) Routes() []string {
+	var routes []string
+
+	for _, r := range e.rules {
+		for _, route := range r.routes {
+			if !slices.Contains(routes, route) {
+				routes = append(routes, route)
+			}
+		}
+	}
+
+	return routes
+}
+
+func (r rule) matches(event models.Event) bool {
+	if !matchPattern(r.eventType, event.EventType) || !matchPattern(r.clientID, event.ClientID) {
+		return false
+	}
+
+	for _, cond := range r.conditions {
+		if !cond.matches(event.Payload) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchPattern(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+
+	matched, _ := path.Match(pattern, value)
+
+	return matched
+}
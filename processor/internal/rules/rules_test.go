@@ -0,0 +1,171 @@
+package rules_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/EWK20/event-processor/processor/internal/rules"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	type Test struct {
+		rules  []config.Rule
+		input  models.Event
+		output rules.Decision
+	}
+
+	event := models.Event{
+		EventType: "transaction_approved",
+		ClientID:  "client_123",
+		Payload: map[string]any{
+			"transaction_id": "txn_806",
+			"amount":         "15000.50",
+			"currency":       "GBP",
+			"card": map[string]any{
+				"country": "GB",
+				"last4":   float64(4242),
+			},
+		},
+		Timestamp: time.Date(2025, 8, 18, 7, 48, 48, 0, time.UTC),
+	}
+
+	testCases := map[string]Test{
+		"No Rules": {
+			input:  event,
+			output: rules.Decision{},
+		},
+		"High Value Transaction": {
+			rules: []config.Rule{
+				{
+					Name:      "high-value",
+					EventType: "transaction_*",
+					When:      []string{"amount > 10000", `currency == "GBP"`},
+					Priority:  "high",
+					Category:  "high_value",
+					RouteTo:   []string{"fraud-review"},
+				},
+			},
+			input: event,
+			output: rules.Decision{
+				Rules:    []string{"high-value"},
+				Priority: "high",
+				Category: "high_value",
+				Routes:   []string{"fraud-review"},
+			},
+		},
+		"Condition Not Met": {
+			rules: []config.Rule{
+				{
+					Name:     "very-high-value",
+					When:     []string{"amount >= 100000"},
+					Priority: "critical",
+				},
+			},
+			input:  event,
+			output: rules.Decision{},
+		},
+		"Client Does Not Match": {
+			rules: []config.Rule{
+				{
+					Name:     "other-client",
+					ClientID: "client_456",
+					Priority: "high",
+				},
+			},
+			input:  event,
+			output: rules.Decision{},
+		},
+		"Nested Payload Fields": {
+			rules: []config.Rule{
+				{
+					Name:     "foreign-card",
+					When:     []string{"card.country != 'GB'"},
+					Category: "foreign",
+				},
+				{
+					Name:     "test-card",
+					When:     []string{"card.last4 == 4242", "transaction_id contains txn_"},
+					Category: "test_card",
+				},
+			},
+			input: event,
+			output: rules.Decision{
+				Rules:    []string{"test-card"},
+				Category: "test_card",
+			},
+		},
+		"First Match Wins And Routes Accumulate": {
+			rules: []config.Rule{
+				{
+					Name:     "gbp",
+					When:     []string{"currency == GBP"},
+					Priority: "normal",
+					RouteTo:  []string{"gbp-events"},
+				},
+				{
+					Name:     "high-value",
+					When:     []string{"amount > 10000"},
+					Priority: "high",
+					Category: "high_value",
+					RouteTo:  []string{"fraud-review", "gbp-events"},
+				},
+			},
+			input: event,
+			output: rules.Decision{
+				Rules:    []string{"gbp", "high-value"},
+				Priority: "normal",
+				Category: "high_value",
+				Routes:   []string{"gbp-events", "fraud-review"},
+			},
+		},
+		"Drop": {
+			rules: []config.Rule{
+				{
+					Name:     "test-client",
+					ClientID: "client_123",
+					Drop:     true,
+				},
+			},
+			input: event,
+			output: rules.Decision{
+				Rules: []string{"test-client"},
+				Drop:  true,
+			},
+		},
+		"Missing Field Does Not Match": {
+			rules: []config.Rule{
+				{
+					Name:     "merchant",
+					When:     []string{"merchant.id == 1"},
+					Priority: "high",
+				},
+			},
+			input:  event,
+			output: rules.Decision{},
+		},
+	}
+
+	for scenario, test := range testCases {
+		t.Run(scenario, func(t *testing.T) {
+			engine, err := rules.New(test.rules)
+			require.NoError(t, err)
+
+			assert.Equal(t, test.output, engine.Evaluate(test.input))
+		})
+	}
+}
+
+func TestNewInvalidRules(t *testing.T) {
+	_, err := rules.New([]config.Rule{
+		{Name: "bad-expression", When: []string{"amount >"}},
+		{Name: "bad-pattern", EventType: "transaction_["},
+	})
+
+	require.ErrorIs(t, err, rules.ErrInvalidRule)
+	assert.Contains(t, err.Error(), "bad-expression")
+	assert.Contains(t, err.Error(), "bad-pattern")
+}
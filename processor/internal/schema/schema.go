@@ -0,0 +1,99 @@
+package schema
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/EWK20/event-processor/processor/models"
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported schema version")
+	ErrFailedToUpcast     = errors.New("failed to upcast payload")
+)
+
+// InitialVersion is the version of events sent without a schema_version.
+const InitialVersion = 1
+
+// Upcaster converts a payload from one schema version to the next.
+type Upcaster func(payload map[string]any) (map[string]any, error)
+
+// Registry holds the upcasters of each event type. The current version of an
+// event type is the one after its latest upcaster.
+type Registry struct {
+	upcasters map[string]map[int]Upcaster
+	current   map[string]int
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		upcasters: make(map[string]map[int]Upcaster),
+		current:   make(map[string]int),
+	}
+}
+
+// Register adds the upcaster converting eventType payloads from version from
+// to version from+1.
+func (r *Registry) Register(eventType string, from int, up Upcaster) *Registry {
+	if r.upcasters[eventType] == nil {
+		r.upcasters[eventType] = make(map[int]Upcaster)
+	}
+
+	r.upcasters[eventType][from] = up
+	r.current[eventType] = max(r.current[eventType], from+1)
+
+	return r
+}
+
+// Current returns the version payloads of eventType are upcast to.
+func (r *Registry) Current(eventType string) int {
+	if version, ok := r.current[eventType]; ok {
+		return version
+	}
+
+	return InitialVersion
+}
+
+// Upcast converts the event payload to the current version of its type, one
+// version at a time, and updates its schema version.
+func (r *Registry) Upcast(event *models.Event) error {
+	version := event.SchemaVersion
+	if version == 0 {
+		version = InitialVersion
+	}
+
+	current := r.Current(event.EventType)
+
+	if version < InitialVersion || version > current {
+		return fmt.Errorf("%w: %s v%d, current is v%d", ErrUnsupportedVersion, event.EventType, version, current)
+	}
+
+	for ; version < current; version++ {
+		up, ok := r.upcasters[event.EventType][version]
+		if !ok {
+			return fmt.Errorf("%w: no upcaster for %s v%d", ErrUnsupportedVersion, event.EventType, version)
+		}
+
+		payload, ok := event.Payload.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%w: %s v%d: payload is not an object", ErrFailedToUpcast, event.EventType, version)
+		}
+
+		payload, err := up(payload)
+		if err != nil {
+			return fmt.Errorf("%w: %s v%d: %w", ErrFailedToUpcast, event.EventType, version, err)
+		}
+
+		event.Payload = payload
+	}
+
+	event.SchemaVersion = version
+
+	return nil
+}
+
+// Default returns the registry of the built-in event types. Upcasters are
+// registered here whenever the payload of an event type changes shape.
+func Default() *Registry {
+	return NewRegistry()
+}
@@ -0,0 +1,138 @@
+package schema_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/EWK20/event-processor/processor/internal/schema"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpcast(t *testing.T) {
+	type Test struct {
+		input  models.Event
+		output models.Event
+		err    error
+	}
+
+	// v2 renames transaction_id to id, v3 splits the amount into an object
+	registry := schema.NewRegistry().
+		Register("transaction_approved", 1, func(payload map[string]any) (map[string]any, error) {
+			payload["id"] = payload["transaction_id"]
+			delete(payload, "transaction_id")
+
+			return payload, nil
+		}).
+		Register("transaction_approved", 2, func(payload map[string]any) (map[string]any, error) {
+			payload["amount"] = map[string]any{"value": payload["amount"], "currency": payload["currency"]}
+			delete(payload, "currency")
+
+			return payload, nil
+		}).
+		Register("transaction_refunded", 1, func(map[string]any) (map[string]any, error) {
+			return nil, errors.New("refund_id is missing")
+		})
+
+	current := map[string]any{
+		"id":     "txn_1",
+		"amount": map[string]any{"value": "10.00", "currency": "GBP"},
+	}
+
+	testCases := map[string]Test{
+		"Unversioned Event Is Upcast From V1": {
+			input: models.Event{
+				EventType: "transaction_approved",
+				Payload:   map[string]any{"transaction_id": "txn_1", "amount": "10.00", "currency": "GBP"},
+			},
+			output: models.Event{
+				EventType:     "transaction_approved",
+				Payload:       current,
+				SchemaVersion: 3,
+			},
+		},
+		"V2 Event Is Upcast": {
+			input: models.Event{
+				EventType:     "transaction_approved",
+				Payload:       map[string]any{"id": "txn_1", "amount": "10.00", "currency": "GBP"},
+				SchemaVersion: 2,
+			},
+			output: models.Event{
+				EventType:     "transaction_approved",
+				Payload:       current,
+				SchemaVersion: 3,
+			},
+		},
+		"Current Event Is Unchanged": {
+			input: models.Event{
+				EventType:     "transaction_approved",
+				Payload:       current,
+				SchemaVersion: 3,
+			},
+			output: models.Event{
+				EventType:     "transaction_approved",
+				Payload:       current,
+				SchemaVersion: 3,
+			},
+		},
+		"Unregistered Event Type Is V1": {
+			input: models.Event{
+				EventType: "client_created",
+				Payload:   map[string]any{"name": "Acme"},
+			},
+			output: models.Event{
+				EventType:     "client_created",
+				Payload:       map[string]any{"name": "Acme"},
+				SchemaVersion: 1,
+			},
+		},
+		"Newer Version Is Unsupported": {
+			input: models.Event{
+				EventType:     "transaction_approved",
+				Payload:       current,
+				SchemaVersion: 4,
+			},
+			err: schema.ErrUnsupportedVersion,
+		},
+		"Payload Is Not An Object": {
+			input: models.Event{
+				EventType: "transaction_approved",
+				Payload:   "txn_1",
+			},
+			err: schema.ErrFailedToUpcast,
+		},
+		"Upcaster Fails": {
+			input: models.Event{
+				EventType: "transaction_refunded",
+				Payload:   map[string]any{},
+			},
+			err: schema.ErrFailedToUpcast,
+		},
+	}
+
+	for scenario, test := range testCases {
+		t.Run(scenario, func(t *testing.T) {
+			event := test.input
+
+			err := registry.Upcast(&event)
+
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.output, event)
+		})
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	registry := schema.NewRegistry().
+		Register("transaction_approved", 1, func(payload map[string]any) (map[string]any, error) { return payload, nil })
+
+	assert.Equal(t, 2, registry.Current("transaction_approved"))
+	assert.Equal(t, schema.InitialVersion, registry.Current("transaction_refunded"))
+}
@@ -0,0 +1,547 @@
+package sqsfake
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// operation handles a single SQS API call.
+type operation func(s *Server, r *http.Request, body []byte) (any, error)
+
+var operations = map[string]operation{
+	"CreateQueue":                  handle((*Server).handleCreateQueue),
+	"DeleteQueue":                  handle((*Server).handleDeleteQueue),
+	"GetQueueUrl":                  handle((*Server).handleGetQueueURL),
+	"ListQueues":                   handle((*Server).handleListQueues),
+	"GetQueueAttributes":           handle((*Server).handleGetQueueAttributes),
+	"SetQueueAttributes":           handle((*Server).handleSetQueueAttributes),
+	"PurgeQueue":                   handle((*Server).handlePurgeQueue),
+	"SendMessage":                  handle((*Server).handleSendMessage),
+	"SendMessageBatch":             handle((*Server).handleSendMessageBatch),
+	"ReceiveMessage":               handle((*Server).handleReceiveMessage),
+	"DeleteMessage":                handle((*Server).handleDeleteMessage),
+	"DeleteMessageBatch":           handle((*Server).handleDeleteMessageBatch),
+	"ChangeMessageVisibility":      handle((*Server).handleChangeMessageVisibility),
+	"ChangeMessageVisibilityBatch": handle((*Server).handleChangeMessageVisibilityBatch),
+}
+
+// handle decodes the request body into the input of fn.
+func handle[In any](fn func(*Server, *http.Request, In) (any, error)) operation {
+	return func(s *Server, r *http.Request, body []byte) (any, error) {
+		var in In
+
+		if err := json.Unmarshal(body, &in); err != nil {
+			return nil, newError(codeInvalidParameterValue, "failed to decode request: %v", err)
+		}
+
+		return fn(s, r, in)
+	}
+}
+
+type queueInput struct {
+	QueueURL string `json:"QueueUrl"`
+}
+
+type queueOutput struct {
+	QueueURL string `json:"QueueUrl"`
+}
+
+type batchResultError struct {
+	ID          string `json:"Id"`
+	Code        string `json:"Code"`
+	Message     string `json:"Message"`
+	SenderFault bool   `json:"SenderFault"`
+}
+
+type batchEntryResult struct {
+	ID string `json:"Id"`
+}
+
+func (s *Server) handleCreateQueue(r *http.Request, in struct {
+	QueueName  string            `json:"QueueName"`
+	Attributes map[string]string `json:"Attributes"`
+}) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if in.QueueName == "" {
+		return nil, newError(codeMissingParameter, "QueueName is required")
+	}
+
+	if err := s.createQueue(in.QueueName, in.Attributes); err != nil {
+		return nil, err
+	}
+
+	return queueOutput{QueueURL: queueURL(r, in.QueueName)}, nil
+}
+
+func (s *Server) handleDeleteQueue(_ *http.Request, in queueInput) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.queue(in.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(s.queues, q.name)
+	s.notify()
+
+	return struct{}{}, nil
+}
+
+func (s *Server) handleGetQueueURL(r *http.Request, in struct {
+	QueueName string `json:"QueueName"`
+}) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.queues[in.QueueName]; !ok {
+		return nil, newError(codeQueueDoesNotExist, "the specified queue %q does not exist", in.QueueName)
+	}
+
+	return queueOutput{QueueURL: queueURL(r, in.QueueName)}, nil
+}
+
+func (s *Server) handleListQueues(r *http.Request, in struct {
+	QueueNamePrefix string `json:"QueueNamePrefix"`
+}) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	urls := []string{}
+
+	for _, name := range s.queueNames(in.QueueNamePrefix) {
+		urls = append(urls, queueURL(r, name))
+	}
+
+	return struct {
+		QueueURLs []string `json:"QueueUrls"`
+	}{urls}, nil
+}
+
+func (s *Server) handleGetQueueAttributes(_ *http.Request, in struct {
+	QueueURL       string   `json:"QueueUrl"`
+	AttributeNames []string `json:"AttributeNames"`
+}) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.queue(in.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+
+	visible, inFlight, delayed := q.counts(time.Now())
+
+	all := map[string]string{
+		"QueueArn":                              queueARN(q.name),
+		"ApproximateNumberOfMessages":           strconv.Itoa(visible),
+		"ApproximateNumberOfMessagesNotVisible": strconv.Itoa(inFlight),
+		"ApproximateNumberOfMessagesDelayed":    strconv.Itoa(delayed),
+		"VisibilityTimeout":                     strconv.Itoa(int(q.seconds("VisibilityTimeout", defaultVisibilityTimeout).Seconds())),
+		"DelaySeconds":                          strconv.Itoa(int(q.seconds("DelaySeconds", 0).Seconds())),
+		"ReceiveMessageWaitTimeSeconds":         strconv.Itoa(int(q.seconds("ReceiveMessageWaitTimeSeconds", 0).Seconds())),
+	}
+
+	for name, value := range q.attributes {
+		all[name] = value
+	}
+
+	attributes := make(map[string]string)
+
+	for name, value := range all {
+		if slices.Contains(in.AttributeNames, "All") || slices.Contains(in.AttributeNames, name) {
+			attributes[name] = value
+		}
+	}
+
+	return struct {
+		Attributes map[string]string `json:"Attributes"`
+	}{attributes}, nil
+}
+
+func (s *Server) handleSetQueueAttributes(_ *http.Request, in struct {
+	QueueURL   string            `json:"QueueUrl"`
+	Attributes map[string]string `json:"Attributes"`
+}) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.queue(in.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.setAttributes(in.Attributes); err != nil {
+		return nil, err
+	}
+
+	return struct{}{}, nil
+}
+
+func (s *Server) handlePurgeQueue(_ *http.Request, in queueInput) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.queue(in.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+
+	q.messages = nil
+
+	return struct{}{}, nil
+}
+
+type sendResult struct {
+	ID               string `json:"Id,omitempty"`
+	MessageID        string `json:"MessageId"`
+	MD5OfMessageBody string `json:"MD5OfMessageBody"`
+	SequenceNumber   string `json:"SequenceNumber,omitempty"`
+}
+
+func (s *Server) handleSendMessage(_ *http.Request, in struct {
+	QueueURL string `json:"QueueUrl"`
+	sendEntry
+}) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.queue(in.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := q.send(in.sendEntry, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify()
+
+	return sendResult{MessageID: msg.ID, MD5OfMessageBody: msg.md5, SequenceNumber: msg.sequenceNumber}, nil
+}
+
+func (s *Server) handleSendMessageBatch(_ *http.Request, in struct {
+	QueueURL string      `json:"QueueUrl"`
+	Entries  []sendEntry `json:"Entries"`
+}) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.queue(in.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkBatch(in.Entries, func(e sendEntry) string { return e.ID }); err != nil {
+		return nil, err
+	}
+
+	out := struct {
+		Successful []sendResult       `json:"Successful"`
+		Failed     []batchResultError `json:"Failed"`
+	}{Successful: []sendResult{}, Failed: []batchResultError{}}
+
+	now := time.Now()
+
+	for _, entry := range in.Entries {
+		msg, err := q.send(entry, now)
+		if err != nil {
+			out.Failed = append(out.Failed, batchError(entry.ID, err))
+
+			continue
+		}
+
+		out.Successful = append(out.Successful, sendResult{
+			ID:               entry.ID,
+			MessageID:        msg.ID,
+			MD5OfMessageBody: msg.md5,
+			SequenceNumber:   msg.sequenceNumber,
+		})
+	}
+
+	s.notify()
+
+	return out, nil
+}
+
+type receivedMessage struct {
+	MessageID         string                      `json:"MessageId"`
+	ReceiptHandle     string                      `json:"ReceiptHandle"`
+	MD5OfBody         string                      `json:"MD5OfBody"`
+	Body              string                      `json:"Body"`
+	Attributes        map[string]string           `json:"Attributes,omitempty"`
+	MessageAttributes map[string]MessageAttribute `json:"MessageAttributes,omitempty"`
+}
+
+func (s *Server) handleReceiveMessage(r *http.Request, in struct {
+	QueueURL                    string   `json:"QueueUrl"`
+	MaxNumberOfMessages         *int     `json:"MaxNumberOfMessages"`
+	VisibilityTimeout           *int     `json:"VisibilityTimeout"`
+	WaitTimeSeconds             *int     `json:"WaitTimeSeconds"`
+	AttributeNames              []string `json:"AttributeNames"`
+	MessageSystemAttributeNames []string `json:"MessageSystemAttributeNames"`
+	MessageAttributeNames       []string `json:"MessageAttributeNames"`
+}) (any, error) {
+	limit := 1
+	if in.MaxNumberOfMessages != nil {
+		limit = *in.MaxNumberOfMessages
+	}
+
+	if limit < 1 || limit > maxBatchEntries {
+		return nil, newError(codeInvalidParameterValue, "MaxNumberOfMessages must be from 1 to %d", maxBatchEntries)
+	}
+
+	s.mu.Lock()
+	q, err := s.queue(in.QueueURL)
+	if err != nil {
+		s.mu.Unlock()
+
+		return nil, err
+	}
+
+	visibility := q.seconds("VisibilityTimeout", defaultVisibilityTimeout)
+	wait := q.seconds("ReceiveMessageWaitTimeSeconds", 0)
+	s.mu.Unlock()
+
+	if in.VisibilityTimeout != nil {
+		visibility = time.Duration(*in.VisibilityTimeout) * time.Second
+	}
+
+	if in.WaitTimeSeconds != nil {
+		wait = time.Duration(*in.WaitTimeSeconds) * time.Second
+	}
+
+	systemAttributes := append(in.AttributeNames, in.MessageSystemAttributeNames...)
+	deadline := time.Now().Add(wait)
+
+	for {
+		s.mu.Lock()
+
+		q, err := s.queue(in.QueueURL)
+		if err != nil {
+			s.mu.Unlock()
+
+			return nil, err
+		}
+
+		received := s.receive(q, limit, visibility, time.Now())
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(received) > 0 || !time.Now().Before(deadline) {
+			messages := make([]receivedMessage, 0, len(received))
+
+			for _, msg := range received {
+				messages = append(messages, receivedMessage{
+					MessageID:         msg.ID,
+					ReceiptHandle:     msg.receipt,
+					MD5OfBody:         msg.md5,
+					Body:              msg.Body,
+					Attributes:        selectSystemAttributes(msg, systemAttributes),
+					MessageAttributes: selectMessageAttributes(msg.Attributes, in.MessageAttributeNames),
+				})
+			}
+
+			return struct {
+				Messages []receivedMessage `json:"Messages"`
+			}{messages}, nil
+		}
+
+		select {
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		case <-changed:
+		case <-time.After(min(pollInterval, time.Until(deadline))):
+		}
+	}
+}
+
+type receiptEntry struct {
+	ID                string `json:"Id"`
+	ReceiptHandle     string `json:"ReceiptHandle"`
+	VisibilityTimeout int    `json:"VisibilityTimeout"`
+}
+
+func (s *Server) handleDeleteMessage(_ *http.Request, in struct {
+	QueueURL string `json:"QueueUrl"`
+	receiptEntry
+}) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.queue(in.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.delete(in.ReceiptHandle); err != nil {
+		return nil, err
+	}
+
+	return struct{}{}, nil
+}
+
+func (s *Server) handleDeleteMessageBatch(_ *http.Request, in struct {
+	QueueURL string         `json:"QueueUrl"`
+	Entries  []receiptEntry `json:"Entries"`
+}) (any, error) {
+	return s.receiptBatch(in.QueueURL, in.Entries, func(q *queue, entry receiptEntry) error {
+		return q.delete(entry.ReceiptHandle)
+	})
+}
+
+func (s *Server) handleChangeMessageVisibility(_ *http.Request, in struct {
+	QueueURL string `json:"QueueUrl"`
+	receiptEntry
+}) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.queue(in.QueueURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := q.changeVisibility(in.ReceiptHandle, in.VisibilityTimeout, time.Now()); err != nil {
+		return nil, err
+	}
+
+	s.notify()
+
+	return struct{}{}, nil
+}
+
+func (s *Server) handleChangeMessageVisibilityBatch(_ *http.Request, in struct {
+	QueueURL string         `json:"QueueUrl"`
+	Entries  []receiptEntry `json:"Entries"`
+}) (any, error) {
+	now := time.Now()
+
+	return s.receiptBatch(in.QueueURL, in.Entries, func(q *queue, entry receiptEntry) error {
+		return q.changeVisibility(entry.ReceiptHandle, entry.VisibilityTimeout, now)
+	})
+}
+
+// receiptBatch applies fn to every entry of a batch, reporting failures per
+// entry.
+func (s *Server) receiptBatch(url string, entries []receiptEntry, fn func(*queue, receiptEntry) error) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, err := s.queue(url)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkBatch(entries, func(e receiptEntry) string { return e.ID }); err != nil {
+		return nil, err
+	}
+
+	out := struct {
+		Successful []batchEntryResult `json:"Successful"`
+		Failed     []batchResultError `json:"Failed"`
+	}{Successful: []batchEntryResult{}, Failed: []batchResultError{}}
+
+	for _, entry := range entries {
+		if err := fn(q, entry); err != nil {
+			out.Failed = append(out.Failed, batchError(entry.ID, err))
+
+			continue
+		}
+
+		out.Successful = append(out.Successful, batchEntryResult{ID: entry.ID})
+	}
+
+	s.notify()
+
+	return out, nil
+}
+
+var batchEntryID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,80}$`)
+
+func checkBatch[T any](entries []T, id func(T) string) error {
+	switch {
+	case len(entries) == 0:
+		return newError(codeEmptyBatchRequest, "there should be at least one entry in the request")
+	case len(entries) > maxBatchEntries:
+		return newError(codeTooManyEntriesInBatchRequest, "maximum number of entries per request are %d", maxBatchEntries)
+	}
+
+	seen := make(map[string]bool, len(entries))
+
+	for _, entry := range entries {
+		if !batchEntryID.MatchString(id(entry)) {
+			return newError(codeInvalidBatchEntryID, "batch entry id %q is not valid", id(entry))
+		}
+
+		if seen[id(entry)] {
+			return newError(codeBatchEntryIdsNotDistinct, "id %s repeated", id(entry))
+		}
+
+		seen[id(entry)] = true
+	}
+
+	return nil
+}
+
+func batchError(id string, err error) batchResultError {
+	apiErr, _ := err.(*apiError)
+
+	return batchResultError{ID: id, Code: apiErr.code, Message: apiErr.message, SenderFault: true}
+}
+
+func selectSystemAttributes(msg *message, names []string) map[string]string {
+	all := map[string]string{
+		"SenderId":                         AccountID,
+		"SentTimestamp":                    strconv.FormatInt(msg.sentAt.UnixMilli(), 10),
+		"ApproximateReceiveCount":          strconv.Itoa(msg.ReceiveCount),
+		"ApproximateFirstReceiveTimestamp": strconv.FormatInt(msg.firstReceivedAt.UnixMilli(), 10),
+	}
+
+	if msg.GroupID != "" {
+		all["MessageGroupId"] = msg.GroupID
+	}
+
+	if msg.DeduplicationID != "" {
+		all["MessageDeduplicationId"] = msg.DeduplicationID
+		all["SequenceNumber"] = msg.sequenceNumber
+	}
+
+	attributes := make(map[string]string)
+
+	for name, value := range all {
+		if slices.Contains(names, "All") || slices.Contains(names, name) {
+			attributes[name] = value
+		}
+	}
+
+	return attributes
+}
+
+// selectMessageAttributes filters attributes by names, which may be All, .*
+// or a prefix ending in .*.
+func selectMessageAttributes(attributes map[string]MessageAttribute, names []string) map[string]MessageAttribute {
+	selected := make(map[string]MessageAttribute)
+
+	for name, value := range attributes {
+		for _, pattern := range names {
+			prefix, wildcard := strings.CutSuffix(pattern, ".*")
+
+			if pattern == "All" || pattern == name || (wildcard && strings.HasPrefix(name, prefix)) {
+				selected[name] = value
+
+				break
+			}
+		}
+	}
+
+	return selected
+}
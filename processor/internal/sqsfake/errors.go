@@ -0,0 +1,52 @@
+package sqsfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+const (
+	codeBatchEntryIdsNotDistinct     = "BatchEntryIdsNotDistinct"
+	codeEmptyBatchRequest            = "EmptyBatchRequest"
+	codeInvalidAttributeName         = "InvalidAttributeName"
+	codeInvalidAttributeValue        = "InvalidAttributeValue"
+	codeInvalidBatchEntryID          = "InvalidBatchEntryId"
+	codeInvalidParameterValue        = "InvalidParameterValue"
+	codeMessageNotInflight           = "MessageNotInflight"
+	codeMissingParameter             = "MissingParameter"
+	codeQueueDoesNotExist            = "QueueDoesNotExist"
+	codeReceiptHandleIsInvalid       = "ReceiptHandleIsInvalid"
+	codeTooManyEntriesInBatchRequest = "TooManyEntriesInBatchRequest"
+	codeUnsupportedOperation         = "UnsupportedOperation"
+)
+
+// apiError is an SQS error, returned to the SDK with its code so it decodes
+// into the matching types error.
+type apiError struct {
+	code    string
+	message string
+}
+
+func newError(code, format string, args ...any) *apiError {
+	return &apiError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+func (e *apiError) Error() string {
+	return e.code + ": " + e.message
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	apiErr, ok := err.(*apiError)
+	if !ok {
+		apiErr = newError("InternalError", "%v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	w.WriteHeader(http.StatusBadRequest)
+
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"__type":  "com.amazonaws.sqs#" + apiErr.code,
+		"message": apiErr.message,
+	})
+}
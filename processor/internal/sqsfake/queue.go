@@ -0,0 +1,390 @@
+package sqsfake
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a message held by a queue.
+type Message struct {
+	ID              string
+	Body            string
+	GroupID         string
+	DeduplicationID string
+	Attributes      map[string]MessageAttribute
+	ReceiveCount    int
+	InFlight        bool
+}
+
+// MessageAttribute is a message attribute as sent over the wire.
+type MessageAttribute struct {
+	DataType    string `json:"DataType"`
+	StringValue string `json:"StringValue,omitempty"`
+	BinaryValue []byte `json:"BinaryValue,omitempty"`
+}
+
+type message struct {
+	Message
+
+	md5             string
+	receipt         string
+	sequenceNumber  string
+	sentAt          time.Time
+	visibleAt       time.Time
+	firstReceivedAt time.Time
+}
+
+type deduplicated struct {
+	messageID      string
+	sequenceNumber string
+	sentAt         time.Time
+}
+
+type queue struct {
+	name          string
+	attributes    map[string]string
+	messages      []*message
+	receipts      map[string]*message
+	deduplication map[string]deduplicated
+	sequence      int64
+}
+
+type redrivePolicy struct {
+	DeadLetterTargetARN string `json:"deadLetterTargetArn"`
+	MaxReceiveCount     any    `json:"maxReceiveCount"`
+}
+
+// settableAttributes validates the queue attributes that can be set, the
+// rest are computed by GetQueueAttributes.
+var settableAttributes = map[string]func(string) error{
+	"DelaySeconds":                  secondsBetween(0, 900),
+	"MaximumMessageSize":            secondsBetween(1024, maxMessageSize),
+	"MessageRetentionPeriod":        secondsBetween(60, 1209600),
+	"ReceiveMessageWaitTimeSeconds": secondsBetween(0, 20),
+	"VisibilityTimeout":             secondsBetween(0, 43200),
+	"FifoQueue":                     boolean,
+	"ContentBasedDeduplication":     boolean,
+	"RedrivePolicy": func(value string) error {
+		_, _, err := parseRedrivePolicy(value)
+
+		return err
+	},
+}
+
+func secondsBetween(lower, upper int) func(string) error {
+	return func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < lower || n > upper {
+			return fmt.Errorf("must be an integer from %d to %d", lower, upper)
+		}
+
+		return nil
+	}
+}
+
+func boolean(value string) error {
+	if value != "true" && value != "false" {
+		return fmt.Errorf("must be true or false")
+	}
+
+	return nil
+}
+
+func parseRedrivePolicy(value string) (redrivePolicy, int, error) {
+	var policy redrivePolicy
+
+	if err := json.Unmarshal([]byte(value), &policy); err != nil {
+		return policy, 0, fmt.Errorf("must be a JSON object: %w", err)
+	}
+
+	maxReceiveCount, err := strconv.Atoi(fmt.Sprint(policy.MaxReceiveCount))
+	if err != nil || maxReceiveCount < 1 || maxReceiveCount > 1000 {
+		return policy, 0, fmt.Errorf("maxReceiveCount must be an integer from 1 to 1000")
+	}
+
+	if !strings.HasPrefix(policy.DeadLetterTargetARN, "arn:aws:sqs:") {
+		return policy, 0, fmt.Errorf("deadLetterTargetArn must be an SQS queue ARN")
+	}
+
+	return policy, maxReceiveCount, nil
+}
+
+func (q *queue) setAttributes(attributes map[string]string) error {
+	for name, value := range attributes {
+		validate, ok := settableAttributes[name]
+		if !ok {
+			return newError(codeInvalidAttributeName, "unknown attribute %s", name)
+		}
+
+		if err := validate(value); err != nil {
+			return newError(codeInvalidAttributeValue, "invalid value for %s: %v", name, err)
+		}
+
+		if name == "FifoQueue" && q.attributes[name] != "" && q.attributes[name] != value {
+			return newError(codeInvalidAttributeValue, "FifoQueue can't be changed")
+		}
+	}
+
+	for name, value := range attributes {
+		q.attributes[name] = value
+	}
+
+	return nil
+}
+
+func (q *queue) fifo() bool {
+	return q.attributes["FifoQueue"] == "true"
+}
+
+func (q *queue) seconds(name string, def time.Duration) time.Duration {
+	value, ok := q.attributes[name]
+	if !ok {
+		return def
+	}
+
+	n, _ := strconv.Atoi(value)
+
+	return time.Duration(n) * time.Second
+}
+
+// redrive returns the name of the dead letter queue and the receive count
+// after which messages move to it.
+func (q *queue) redrive() (string, int, bool) {
+	value, ok := q.attributes["RedrivePolicy"]
+	if !ok {
+		return "", 0, false
+	}
+
+	policy, maxReceiveCount, err := parseRedrivePolicy(value)
+	if err != nil {
+		return "", 0, false
+	}
+
+	return policy.DeadLetterTargetARN[strings.LastIndex(policy.DeadLetterTargetARN, ":")+1:], maxReceiveCount, true
+}
+
+type sendEntry struct {
+	ID                     string                      `json:"Id"`
+	MessageBody            string                      `json:"MessageBody"`
+	DelaySeconds           int                         `json:"DelaySeconds"`
+	MessageAttributes      map[string]MessageAttribute `json:"MessageAttributes"`
+	MessageGroupID         string                      `json:"MessageGroupId"`
+	MessageDeduplicationID string                      `json:"MessageDeduplicationId"`
+}
+
+// send enqueues a message, a FIFO message already sent within the
+// deduplication window returns the original instead.
+func (q *queue) send(entry sendEntry, now time.Time) (*message, error) {
+	switch {
+	case entry.MessageBody == "":
+		return nil, newError(codeMissingParameter, "MessageBody is required")
+	case len(entry.MessageBody) > maxMessageSize:
+		return nil, newError(codeInvalidParameterValue, "MessageBody must be shorter than %d bytes", maxMessageSize)
+	case entry.DelaySeconds < 0 || entry.DelaySeconds > 900:
+		return nil, newError(codeInvalidParameterValue, "DelaySeconds must be from 0 to 900")
+	}
+
+	for name, value := range entry.MessageAttributes {
+		if value.DataType == "" || (value.StringValue == "" && value.BinaryValue == nil) {
+			return nil, newError(codeInvalidParameterValue, "message attribute %s must have a data type and value", name)
+		}
+	}
+
+	delay := q.seconds("DelaySeconds", 0)
+	if entry.DelaySeconds > 0 {
+		delay = time.Duration(entry.DelaySeconds) * time.Second
+	}
+
+	msg := &message{
+		Message: Message{
+			ID:         rand.Text(),
+			Body:       entry.MessageBody,
+			GroupID:    entry.MessageGroupID,
+			Attributes: cloneAttributes(entry.MessageAttributes),
+		},
+		md5:       md5Hex(entry.MessageBody),
+		sentAt:    now,
+		visibleAt: now.Add(delay),
+	}
+
+	if !q.fifo() {
+		if entry.MessageDeduplicationID != "" {
+			return nil, newError(codeInvalidParameterValue, "MessageDeduplicationId is only supported by FIFO queues")
+		}
+
+		q.messages = append(q.messages, msg)
+
+		return msg, nil
+	}
+
+	switch {
+	case entry.MessageGroupID == "":
+		return nil, newError(codeMissingParameter, "MessageGroupId is required for FIFO queues")
+	case entry.DelaySeconds > 0:
+		return nil, newError(codeInvalidParameterValue, "DelaySeconds is only supported per queue for FIFO queues")
+	case entry.MessageDeduplicationID == "" && q.attributes["ContentBasedDeduplication"] != "true":
+		return nil, newError(codeInvalidParameterValue, "the queue should either have ContentBasedDeduplication enabled or MessageDeduplicationId provided explicitly")
+	}
+
+	msg.DeduplicationID = entry.MessageDeduplicationID
+	if msg.DeduplicationID == "" {
+		sum := sha256.Sum256([]byte(entry.MessageBody))
+		msg.DeduplicationID = hex.EncodeToString(sum[:])
+	}
+
+	for id, sent := range q.deduplication {
+		if now.Sub(sent.sentAt) > deduplicationWindow {
+			delete(q.deduplication, id)
+		}
+	}
+
+	if sent, ok := q.deduplication[msg.DeduplicationID]; ok {
+		msg.ID, msg.sequenceNumber = sent.messageID, sent.sequenceNumber
+
+		return msg, nil
+	}
+
+	q.sequence++
+	msg.sequenceNumber = fmt.Sprintf("%020d", q.sequence)
+	q.deduplication[msg.DeduplicationID] = deduplicated{messageID: msg.ID, sequenceNumber: msg.sequenceNumber, sentAt: now}
+	q.messages = append(q.messages, msg)
+
+	return msg, nil
+}
+
+// receive makes up to limit visible messages invisible for visibility and
+// returns them with new receipt handles. Messages received maxReceiveCount
+// times are moved to the dead letter queue instead. FIFO messages are
+// returned in order, skipping groups with a message in flight.
+func (s *Server) receive(q *queue, limit int, visibility time.Duration, now time.Time) []*message {
+	var (
+		received []*message
+		blocked  = make(map[string]bool)
+	)
+
+	dlqName, maxReceiveCount, redrive := q.redrive()
+	dlq := s.queues[dlqName]
+
+	for i := 0; i < len(q.messages) && len(received) < limit; {
+		msg := q.messages[i]
+
+		if q.fifo() && blocked[msg.GroupID] {
+			i++
+
+			continue
+		}
+
+		if msg.visibleAt.After(now) {
+			blocked[msg.GroupID] = true
+			i++
+
+			continue
+		}
+
+		if redrive && dlq != nil && msg.ReceiveCount >= maxReceiveCount {
+			q.messages = slices.Delete(q.messages, i, i+1)
+
+			msg.visibleAt = now
+			dlq.messages = append(dlq.messages, msg)
+
+			continue
+		}
+
+		receipt := rand.Text()
+
+		msg.ReceiveCount++
+		msg.visibleAt = now.Add(visibility)
+		q.receipts[receipt] = msg
+
+		if msg.firstReceivedAt.IsZero() {
+			msg.firstReceivedAt = now
+		}
+
+		received = append(received, &message{
+			Message:         Message{ID: msg.ID, Body: msg.Body, GroupID: msg.GroupID, DeduplicationID: msg.DeduplicationID, Attributes: cloneAttributes(msg.Attributes), ReceiveCount: msg.ReceiveCount},
+			md5:             msg.md5,
+			receipt:         receipt,
+			sequenceNumber:  msg.sequenceNumber,
+			sentAt:          msg.sentAt,
+			firstReceivedAt: msg.firstReceivedAt,
+		})
+		i++
+	}
+
+	return received
+}
+
+// lookup finds the message a receipt handle was issued for, nil when it has
+// since been deleted or moved to the dead letter queue. Handles are kept so
+// deleting a message twice succeeds as it does on SQS.
+func (q *queue) lookup(receipt string) (*message, error) {
+	msg, ok := q.receipts[receipt]
+	if !ok {
+		return nil, newError(codeReceiptHandleIsInvalid, "the receipt handle %q is not valid", receipt)
+	}
+
+	if !slices.Contains(q.messages, msg) {
+		return nil, nil
+	}
+
+	return msg, nil
+}
+
+func (q *queue) delete(receipt string) error {
+	msg, err := q.lookup(receipt)
+	if err != nil || msg == nil {
+		return err
+	}
+
+	q.messages = slices.DeleteFunc(q.messages, func(m *message) bool { return m == msg })
+
+	return nil
+}
+
+func (q *queue) changeVisibility(receipt string, timeout int, now time.Time) error {
+	if timeout < 0 || timeout > 43200 {
+		return newError(codeInvalidParameterValue, "VisibilityTimeout must be from 0 to 43200")
+	}
+
+	msg, err := q.lookup(receipt)
+	if err != nil {
+		return err
+	}
+
+	if msg == nil || !msg.visibleAt.After(now) {
+		return newError(codeMessageNotInflight, "the message referred to isn't in flight")
+	}
+
+	msg.visibleAt = now.Add(time.Duration(timeout) * time.Second)
+
+	return nil
+}
+
+func (q *queue) counts(now time.Time) (visible, inFlight, delayed int) {
+	for _, msg := range q.messages {
+		switch {
+		case !msg.visibleAt.After(now):
+			visible++
+		case msg.ReceiveCount > 0:
+			inFlight++
+		default:
+			delayed++
+		}
+	}
+
+	return visible, inFlight, delayed
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+
+	return hex.EncodeToString(sum[:])
+}
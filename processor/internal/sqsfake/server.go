@@ -0,0 +1,186 @@
+// Package sqsfake is an in memory SQS served over HTTP with the JSON protocol
+// of the AWS SDK, so code using a real sqs.Client can be tested without
+// LocalStack.
+package sqsfake
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	AccountID = "000000000000"
+	Region    = "us-east-1"
+
+	defaultVisibilityTimeout = 30 * time.Second
+	deduplicationWindow      = 5 * time.Minute
+	maxBatchEntries          = 10
+	maxMessageSize           = 256 * 1024
+
+	// pollInterval bounds how late a long poll notices a message becoming
+	// visible again.
+	pollInterval = 50 * time.Millisecond
+)
+
+// Server holds the queues and serves the SQS API.
+type Server struct {
+	mu      sync.Mutex
+	queues  map[string]*queue
+	changed chan struct{}
+}
+
+func New() *Server {
+	return &Server{
+		queues:  make(map[string]*queue),
+		changed: make(chan struct{}),
+	}
+}
+
+// CreateQueue creates a queue with the given attributes, as the CreateQueue
+// API does. It is a no-op when the queue already exists.
+func (s *Server) CreateQueue(name string, attributes map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createQueue(name, attributes)
+}
+
+// Messages returns a snapshot of the messages held by a queue, in flight or
+// not, in the order they were sent.
+func (s *Server) Messages(name string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.queues[name]
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+
+	messages := make([]Message, 0, len(q.messages))
+
+	for _, msg := range q.messages {
+		snapshot := msg.Message
+		snapshot.Attributes = cloneAttributes(msg.Attributes)
+		snapshot.InFlight = msg.ReceiveCount > 0 && msg.visibleAt.After(now)
+
+		messages = append(messages, snapshot)
+	}
+
+	return messages
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, _ := strings.CutPrefix(r.Header.Get("X-Amz-Target"), "AmazonSQS.")
+
+	op, ok := operations[name]
+	if r.Method != http.MethodPost || !ok {
+		writeError(w, newError(codeUnsupportedOperation, "operation %q is not supported", name))
+
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, newError(codeInvalidParameterValue, "failed to read request: %v", err))
+
+		return
+	}
+
+	out, err := op(s, r, body)
+	if err != nil {
+		writeError(w, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	_ = json.NewEncoder(w).Encode(out)
+}
+
+// createQueue must be called with mu held.
+func (s *Server) createQueue(name string, attributes map[string]string) error {
+	if _, ok := s.queues[name]; ok {
+		return nil
+	}
+
+	q := &queue{
+		name:          name,
+		attributes:    make(map[string]string),
+		receipts:      make(map[string]*message),
+		deduplication: make(map[string]deduplicated),
+	}
+
+	if err := q.setAttributes(attributes); err != nil {
+		return err
+	}
+
+	if q.fifo() != strings.HasSuffix(name, ".fifo") {
+		return newError(codeInvalidParameterValue, "FIFO queue names must end with .fifo and only FIFO queues can")
+	}
+
+	s.queues[name] = q
+
+	return nil
+}
+
+// queue finds a queue by its URL, must be called with mu held.
+func (s *Server) queue(url string) (*queue, error) {
+	q, ok := s.queues[path.Base(url)]
+	if !ok || url == "" {
+		return nil, newError(codeQueueDoesNotExist, "the specified queue %q does not exist", url)
+	}
+
+	return q, nil
+}
+
+// notify wakes up long polls waiting for messages, must be called with mu
+// held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) queueNames(prefix string) []string {
+	var names []string
+
+	for name := range s.queues {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+func queueURL(r *http.Request, name string) string {
+	return "http://" + r.Host + "/" + AccountID + "/" + name
+}
+
+func queueARN(name string) string {
+	return "arn:aws:sqs:" + Region + ":" + AccountID + ":" + name
+}
+
+func cloneAttributes(attributes map[string]MessageAttribute) map[string]MessageAttribute {
+	if attributes == nil {
+		return nil
+	}
+
+	clone := make(map[string]MessageAttribute, len(attributes))
+
+	for name, value := range attributes {
+		value.BinaryValue = slices.Clone(value.BinaryValue)
+		clone[name] = value
+	}
+
+	return clone
+}
@@ -0,0 +1,319 @@
+package sqsfake_test
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/internal/config"
+	"github.com/EWK20/event-processor/processor/internal/sqsfake"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setup(t *testing.T, queues map[string]map[string]string) (*sqsfake.Server, *sqs.Client) {
+	t.Helper()
+
+	fake := sqsfake.New()
+
+	for name, attributes := range queues {
+		require.NoError(t, fake.CreateQueue(name, attributes))
+	}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client, err := config.AWS{
+		AWSRegion:          sqsfake.Region,
+		AWSAccessKeyID:     "test",
+		AWSSecretAccessKey: "test",
+		SQSEndpoint:        server.URL,
+	}.SQSClient(t.Context())
+	require.NoError(t, err)
+
+	return fake, client
+}
+
+func queueURL(t *testing.T, client *sqs.Client, name string) *string {
+	t.Helper()
+
+	out, err := client.GetQueueUrl(t.Context(), &sqs.GetQueueUrlInput{QueueName: aws.String(name)})
+	require.NoError(t, err)
+
+	return out.QueueUrl
+}
+
+func receive(t *testing.T, client *sqs.Client, url *string, input sqs.ReceiveMessageInput) []types.Message {
+	t.Helper()
+
+	input.QueueUrl = url
+
+	out, err := client.ReceiveMessage(t.Context(), &input)
+	require.NoError(t, err)
+
+	return out.Messages
+}
+
+func TestSendReceiveDelete(t *testing.T) {
+	fake, client := setup(t, map[string]map[string]string{"events": nil})
+	url := queueURL(t, client, "events")
+
+	sent, err := client.SendMessage(t.Context(), &sqs.SendMessageInput{
+		QueueUrl:    url,
+		MessageBody: aws.String(`{"event_type":"transaction_approved"}`),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"trace_id": {DataType: aws.String("String"), StringValue: aws.String("abc")},
+			"checksum": {DataType: aws.String("Binary"), BinaryValue: []byte{1, 2, 3}},
+		},
+	})
+	require.NoError(t, err)
+
+	messages := receive(t, client, url, sqs.ReceiveMessageInput{
+		MaxNumberOfMessages:         10,
+		MessageAttributeNames:       []string{"All"},
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameApproximateReceiveCount},
+	})
+	require.Len(t, messages, 1)
+	assert.Equal(t, sent.MessageId, messages[0].MessageId)
+	assert.Equal(t, `{"event_type":"transaction_approved"}`, *messages[0].Body)
+	assert.Equal(t, "abc", *messages[0].MessageAttributes["trace_id"].StringValue)
+	assert.Equal(t, []byte{1, 2, 3}, messages[0].MessageAttributes["checksum"].BinaryValue)
+	assert.Equal(t, map[string]string{"ApproximateReceiveCount": "1"}, messages[0].Attributes)
+	assert.True(t, fake.Messages("events")[0].InFlight)
+
+	_, err = client.DeleteMessage(t.Context(), &sqs.DeleteMessageInput{QueueUrl: url, ReceiptHandle: messages[0].ReceiptHandle})
+	require.NoError(t, err)
+	assert.Empty(t, fake.Messages("events"))
+
+	// Deleting twice succeeds, unknown receipt handles don't
+	_, err = client.DeleteMessage(t.Context(), &sqs.DeleteMessageInput{QueueUrl: url, ReceiptHandle: messages[0].ReceiptHandle})
+	require.NoError(t, err)
+
+	_, err = client.DeleteMessage(t.Context(), &sqs.DeleteMessageInput{QueueUrl: url, ReceiptHandle: aws.String("unknown")})
+	var invalid *types.ReceiptHandleIsInvalid
+	require.ErrorAs(t, err, &invalid)
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	fake, client := setup(t, map[string]map[string]string{"events": {"VisibilityTimeout": "1"}})
+	url := queueURL(t, client, "events")
+
+	_, err := client.SendMessage(t.Context(), &sqs.SendMessageInput{QueueUrl: url, MessageBody: aws.String("hello")})
+	require.NoError(t, err)
+
+	messages := receive(t, client, url, sqs.ReceiveMessageInput{})
+	require.Len(t, messages, 1)
+
+	// In flight until the queue's visibility timeout expires
+	assert.Empty(t, receive(t, client, url, sqs.ReceiveMessageInput{}))
+
+	messages = receive(t, client, url, sqs.ReceiveMessageInput{WaitTimeSeconds: 2})
+	require.Len(t, messages, 1)
+	assert.Equal(t, 2, fake.Messages("events")[0].ReceiveCount)
+
+	_, err = client.ChangeMessageVisibility(t.Context(), &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          url,
+		ReceiptHandle:     messages[0].ReceiptHandle,
+		VisibilityTimeout: 0,
+	})
+	require.NoError(t, err)
+
+	messages = receive(t, client, url, sqs.ReceiveMessageInput{VisibilityTimeout: 60})
+	require.Len(t, messages, 1)
+
+	_, err = client.DeleteMessage(t.Context(), &sqs.DeleteMessageInput{QueueUrl: url, ReceiptHandle: messages[0].ReceiptHandle})
+	require.NoError(t, err)
+
+	_, err = client.ChangeMessageVisibility(t.Context(), &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          url,
+		ReceiptHandle:     messages[0].ReceiptHandle,
+		VisibilityTimeout: 10,
+	})
+	var notInFlight *types.MessageNotInflight
+	require.ErrorAs(t, err, &notInFlight)
+}
+
+func TestLongPolling(t *testing.T) {
+	_, client := setup(t, map[string]map[string]string{"events": nil})
+	url := queueURL(t, client, "events")
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+
+		_, _ = client.SendMessage(t.Context(), &sqs.SendMessageInput{QueueUrl: url, MessageBody: aws.String("hello")})
+	}()
+
+	start := time.Now()
+
+	messages := receive(t, client, url, sqs.ReceiveMessageInput{WaitTimeSeconds: 10})
+	require.Len(t, messages, 1)
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestBatch(t *testing.T) {
+	fake, client := setup(t, map[string]map[string]string{"events": nil})
+	url := queueURL(t, client, "events")
+
+	sent, err := client.SendMessageBatch(t.Context(), &sqs.SendMessageBatchInput{
+		QueueUrl: url,
+		Entries: []types.SendMessageBatchRequestEntry{
+			{Id: aws.String("1"), MessageBody: aws.String("one")},
+			{Id: aws.String("2"), MessageBody: aws.String("")},
+			{Id: aws.String("3"), MessageBody: aws.String("three")},
+		},
+	})
+	require.NoError(t, err)
+	assert.Len(t, sent.Successful, 2)
+	require.Len(t, sent.Failed, 1)
+	assert.Equal(t, "2", *sent.Failed[0].Id)
+	assert.Len(t, fake.Messages("events"), 2)
+
+	messages := receive(t, client, url, sqs.ReceiveMessageInput{MaxNumberOfMessages: 10})
+	require.Len(t, messages, 2)
+
+	changed, err := client.ChangeMessageVisibilityBatch(t.Context(), &sqs.ChangeMessageVisibilityBatchInput{
+		QueueUrl: url,
+		Entries: []types.ChangeMessageVisibilityBatchRequestEntry{
+			{Id: aws.String("a"), ReceiptHandle: messages[0].ReceiptHandle, VisibilityTimeout: 120},
+			{Id: aws.String("b"), ReceiptHandle: aws.String("unknown")},
+		},
+	})
+	require.NoError(t, err)
+	assert.Len(t, changed.Successful, 1)
+	assert.Len(t, changed.Failed, 1)
+
+	deleted, err := client.DeleteMessageBatch(t.Context(), &sqs.DeleteMessageBatchInput{
+		QueueUrl: url,
+		Entries: []types.DeleteMessageBatchRequestEntry{
+			{Id: aws.String("a"), ReceiptHandle: messages[0].ReceiptHandle},
+			{Id: aws.String("b"), ReceiptHandle: messages[1].ReceiptHandle},
+		},
+	})
+	require.NoError(t, err)
+	assert.Len(t, deleted.Successful, 2)
+	assert.Empty(t, fake.Messages("events"))
+
+	var entries []types.SendMessageBatchRequestEntry
+
+	for i := range 11 {
+		entries = append(entries, types.SendMessageBatchRequestEntry{Id: aws.String(strconv.Itoa(i)), MessageBody: aws.String("body")})
+	}
+
+	_, err = client.SendMessageBatch(t.Context(), &sqs.SendMessageBatchInput{QueueUrl: url, Entries: entries})
+	var tooMany *types.TooManyEntriesInBatchRequest
+	require.ErrorAs(t, err, &tooMany)
+
+	_, err = client.SendMessageBatch(t.Context(), &sqs.SendMessageBatchInput{QueueUrl: url, Entries: []types.SendMessageBatchRequestEntry{
+		{Id: aws.String("1"), MessageBody: aws.String("one")},
+		{Id: aws.String("1"), MessageBody: aws.String("two")},
+	}})
+	var notDistinct *types.BatchEntryIdsNotDistinct
+	require.ErrorAs(t, err, &notDistinct)
+}
+
+func TestRedrive(t *testing.T) {
+	fake, client := setup(t, map[string]map[string]string{
+		"events-dlq": nil,
+		"events": {
+			"VisibilityTimeout": "0",
+			"RedrivePolicy":     `{"deadLetterTargetArn":"arn:aws:sqs:us-east-1:000000000000:events-dlq","maxReceiveCount":"2"}`,
+		},
+	})
+	url := queueURL(t, client, "events")
+
+	_, err := client.SendMessage(t.Context(), &sqs.SendMessageInput{QueueUrl: url, MessageBody: aws.String("poison")})
+	require.NoError(t, err)
+
+	for range 2 {
+		require.Len(t, receive(t, client, url, sqs.ReceiveMessageInput{}), 1)
+	}
+
+	assert.Empty(t, receive(t, client, url, sqs.ReceiveMessageInput{}))
+	assert.Empty(t, fake.Messages("events"))
+
+	dead := fake.Messages("events-dlq")
+	require.Len(t, dead, 1)
+	assert.Equal(t, "poison", dead[0].Body)
+
+	messages := receive(t, client, queueURL(t, client, "events-dlq"), sqs.ReceiveMessageInput{})
+	require.Len(t, messages, 1)
+
+	attributes, err := client.GetQueueAttributes(t.Context(), &sqs.GetQueueAttributesInput{
+		QueueUrl:       url,
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameQueueArn, types.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"QueueArn":                    "arn:aws:sqs:us-east-1:000000000000:events",
+		"ApproximateNumberOfMessages": "0",
+	}, attributes.Attributes)
+}
+
+func TestFIFO(t *testing.T) {
+	fake, client := setup(t, map[string]map[string]string{"events.fifo": {"FifoQueue": "true"}})
+	url := queueURL(t, client, "events.fifo")
+
+	send := func(group, body string) *sqs.SendMessageOutput {
+		out, err := client.SendMessage(t.Context(), &sqs.SendMessageInput{
+			QueueUrl:               url,
+			MessageBody:            aws.String(body),
+			MessageGroupId:         aws.String(group),
+			MessageDeduplicationId: aws.String(body),
+		})
+		require.NoError(t, err)
+
+		return out
+	}
+
+	first := send("a", "a1")
+	send("a", "a2")
+	send("b", "b1")
+
+	// Duplicates within the window return the original message
+	assert.Equal(t, first.MessageId, send("a", "a1").MessageId)
+	assert.Len(t, fake.Messages("events.fifo"), 3)
+
+	messages := receive(t, client, url, sqs.ReceiveMessageInput{})
+	require.Len(t, messages, 1)
+	assert.Equal(t, "a1", *messages[0].Body)
+
+	// Group a is blocked while a1 is in flight
+	next := receive(t, client, url, sqs.ReceiveMessageInput{MaxNumberOfMessages: 10})
+	require.Len(t, next, 1)
+	assert.Equal(t, "b1", *next[0].Body)
+
+	_, err := client.DeleteMessage(t.Context(), &sqs.DeleteMessageInput{QueueUrl: url, ReceiptHandle: messages[0].ReceiptHandle})
+	require.NoError(t, err)
+
+	messages = receive(t, client, url, sqs.ReceiveMessageInput{
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameMessageGroupId},
+	})
+	require.Len(t, messages, 1)
+	assert.Equal(t, "a2", *messages[0].Body)
+	assert.Equal(t, "a", messages[0].Attributes["MessageGroupId"])
+
+	_, err = client.SendMessage(t.Context(), &sqs.SendMessageInput{QueueUrl: url, MessageBody: aws.String("no group")})
+	require.Error(t, err)
+}
+
+func TestQueueDoesNotExist(t *testing.T) {
+	_, client := setup(t, nil)
+
+	_, err := client.GetQueueUrl(t.Context(), &sqs.GetQueueUrlInput{QueueName: aws.String("missing")})
+	var missing *types.QueueDoesNotExist
+	require.ErrorAs(t, err, &missing)
+
+	created, err := client.CreateQueue(t.Context(), &sqs.CreateQueueInput{QueueName: aws.String("created")})
+	require.NoError(t, err)
+	assert.Equal(t, queueURL(t, client, "created"), created.QueueUrl)
+
+	_, err = client.CreateQueue(t.Context(), &sqs.CreateQueueInput{
+		QueueName:  aws.String("not-fifo"),
+		Attributes: map[string]string{"FifoQueue": "true"},
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,8 @@
+package models
+
+type Client struct {
+	ID       string         `json:"id"`
+	Name     string         `json:"name"`
+	Tier     string         `json:"tier,omitempty"`
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
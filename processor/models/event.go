@@ -0,0 +1,79 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Limits of the events table.
+const (
+	MaxEventTypeLength = 100
+	MaxClientIDLength  = 100
+	MaxPayloadLength   = 1000
+)
+
+// Message attributes set by publishers and read by the processor.
+const (
+	// TraceparentAttribute carries a W3C traceparent, its trace ID is logged
+	// with the event.
+	TraceparentAttribute = "traceparent"
+	// IdempotencyKeyAttribute identifies a publish, redeliveries and
+	// republishes with the same key are only handled once.
+	IdempotencyKeyAttribute = "idempotency_key"
+	// ReplayedAttribute marks events republished by processor replay, which
+	// were enriched and redacted when they were first saved.
+	ReplayedAttribute = "replayed"
+)
+
+type Event struct {
+	ID        int64     `json:"id"`
+	EventType string    `json:"event_type"`
+	ClientID  string    `json:"client_id"`
+	Payload   any       `json:"payload"`
+	Timestamp time.Time `json:"timestamp"`
+	Priority  string    `json:"priority,omitempty"`
+	Category  string    `json:"category,omitempty"`
+
+	// SchemaVersion is the version of the payload, events without one are
+	// version 1.
+	SchemaVersion int `json:"schema_version,omitempty"`
+
+	MessageID  string         `json:"message_id,omitempty"`
+	ReceivedAt time.Time      `json:"received_at,omitzero"`
+	Metadata   map[string]any `json:"metadata,omitempty"`
+}
+
+// Problems lists every problem with the envelope of the event, none when it
+// is valid.
+func (e Event) Problems() []string {
+	var problems []string
+
+	switch {
+	case e.EventType == "":
+		problems = append(problems, "event_type is required")
+	case len(e.EventType) > MaxEventTypeLength:
+		problems = append(problems, fmt.Sprintf("event_type is longer than %d characters", MaxEventTypeLength))
+	}
+
+	switch {
+	case e.ClientID == "":
+		problems = append(problems, "client_id is required")
+	case len(e.ClientID) > MaxClientIDLength:
+		problems = append(problems, fmt.Sprintf("client_id is longer than %d characters", MaxClientIDLength))
+	}
+
+	if e.Timestamp.IsZero() {
+		problems = append(problems, "timestamp is required")
+	}
+
+	if e.Payload == nil {
+		problems = append(problems, "payload is required")
+	} else if payload, err := json.Marshal(e.Payload); err != nil {
+		problems = append(problems, fmt.Sprintf("payload is not valid JSON: %v", err))
+	} else if len(payload) > MaxPayloadLength {
+		problems = append(problems, fmt.Sprintf("payload is longer than %d characters", MaxPayloadLength))
+	}
+
+	return problems
+}
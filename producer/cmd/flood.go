@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/EWK20/event-processor/producer/config"
+	"github.com/EWK20/event-processor/producer/producer"
+	"github.com/EWK20/event-processor/producer/scenario"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func createFloodCMD() *cobra.Command {
+	floodCMD := &cobra.Command{
+		Use:   "flood",
+		Short: "Load test the queue with the events of the first scenario",
+		Long:  "Load test the queue with the events of the first scenario, or the default one, ignoring its rate and duration, and report the throughput and latencies achieved.",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(cmd.Flags())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to get config")
+			}
+
+			scenarios, err := loadScenarios(*cfg)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to load scenarios")
+			}
+
+			var opts []producer.Option
+
+			if cfg.Seed != nil {
+				opts = append(opts, producer.WithSeed(*cfg.Seed, cfg.StartTime))
+			}
+
+			p, err := producer.New(*cfg, opts...)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to create producer")
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			loadTest(ctx, p, scenarios[0], cfg.LoadTest)
+		},
+	}
+
+	config.BindFlags(floodCMD.Flags(), config.GroupScenario, config.GroupLoadTest)
+
+	return floodCMD
+}
+
+func loadTest(ctx context.Context, p *producer.Producer, s scenario.Scenario, cfg config.LoadTest) {
+	opts := []producer.LoadTestOption{
+		producer.WithRate(cfg.Rate),
+		producer.WithRamp(cfg.StartRate, cfg.Ramp),
+		producer.WithDuration(cfg.Duration),
+		producer.WithSenders(cfg.Senders),
+		producer.WithBatchSize(cfg.BatchSize),
+	}
+
+	if cfg.DatabaseURL != "" {
+		store, err := producer.NewPostgresStore(cfg.DatabaseURL)
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to connect to the processor's database")
+		}
+		defer store.Close()
+
+		opts = append(opts, producer.WithEndToEnd(store, cfg.E2ETimeout))
+	}
+
+	report, err := p.LoadTest(ctx, s, opts...)
+	if err != nil {
+		log.Error().Err(err).Msg("load test failed")
+	}
+
+	log.Info().
+		Int("sent", report.Sent).
+		Int("failed", report.Failed).
+		Dur("elapsed", report.Elapsed).
+		Float64("rate", report.Rate).
+		Dict("send_latency", percentiles(report.SendLatency)).
+		Msg("load test finished")
+
+	if report.EndToEnd != nil {
+		log.Info().
+			Dict("queue_latency", percentiles(*report.QueueLatency)).
+			Dict("end_to_end", percentiles(*report.EndToEnd)).
+			Int("missing", report.Missing).
+			Msg("load test latencies")
+	}
+
+	if err != nil {
+		os.Exit(1)
+	}
+}
+
+func percentiles(p producer.Percentiles) *zerolog.Event {
+	return zerolog.Dict().
+		Int("count", p.Count).
+		Dur("p50", p.P50).
+		Dur("p90", p.P90).
+		Dur("p95", p.P95).
+		Dur("p99", p.P99).
+		Dur("max", p.Max)
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/EWK20/event-processor/producer/config"
+	"github.com/EWK20/event-processor/producer/producer"
+	"github.com/EWK20/event-processor/producer/scenario"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+func createGenerateCMD() *cobra.Command {
+	generateCMD := &cobra.Command{
+		Use:   "generate",
+		Short: "Send the events of scenarios, each at its own rate",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(cmd.Flags())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to get config")
+			}
+
+			scenarios, err := loadScenarios(*cfg)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to load scenarios")
+			}
+
+			for i := range scenarios {
+				if cfg.Count > 0 || cfg.Duration > 0 {
+					scenarios[i].Count = cfg.Count
+					scenarios[i].Duration = cfg.Duration
+				}
+			}
+
+			opts := []producer.Option{
+				producer.WithRetry(cfg.SendAttempts, cfg.SendBackoff, cfg.SendMaxBackoff),
+				producer.WithSpill(cfg.SpillFile, cfg.SpillInterval),
+			}
+
+			if cfg.Seed != nil {
+				opts = append(opts, producer.WithSeed(*cfg.Seed, cfg.StartTime))
+			}
+
+			if cfg.EmitFile != "" {
+				opts = append(opts, producer.WithEmitFile(cfg.EmitFile))
+			}
+
+			p, err := producer.New(*cfg, opts...)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to create producer")
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			err = p.Run(ctx, scenarios)
+
+			if err := p.Close(); err != nil {
+				log.Error().Err(err).Msg("failed to close producer")
+			}
+
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to produce messages")
+			}
+		},
+	}
+
+	config.BindFlags(generateCMD.Flags(), config.GroupScenario, config.GroupGenerate)
+
+	return generateCMD
+}
+
+// loadScenarios loads the scenario files, or the default scenario, adding the
+// configured faults to the scenarios without their own.
+func loadScenarios(cfg config.Config) ([]scenario.Scenario, error) {
+	scenarios := []scenario.Scenario{scenario.Default()}
+
+	if len(cfg.ScenarioFiles) > 0 {
+		var err error
+
+		if scenarios, err = scenario.LoadAll(cfg.ScenarioFiles); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.FaultPercent > 0 {
+		faults := scenario.Faults{Percent: cfg.FaultPercent}
+		for _, kind := range cfg.FaultKinds {
+			faults.Kinds = append(faults.Kinds, scenario.Fault(kind))
+		}
+
+		for i := range scenarios {
+			if scenarios[i].Faults.Percent == 0 {
+				scenarios[i].Faults = faults
+			}
+		}
+	}
+
+	return scenarios, nil
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/EWK20/event-processor/producer/config"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrNonFuncCMD = errors.New("non functional command")
+)
+
+func Execute() {
+	rootCMD := createRootCMD()
+
+	rootCMD.AddCommand(createSendCMD())
+	rootCMD.AddCommand(createSendFileCMD())
+	rootCMD.AddCommand(createGenerateCMD())
+	rootCMD.AddCommand(createFloodCMD())
+
+	if err := rootCMD.Execute(); err != nil {
+		log.Fatal().Err(err).Msg("failed to execute root command")
+	}
+}
+
+func createRootCMD() *cobra.Command {
+	rootCMD := &cobra.Command{
+		Use: "producer",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.HelpFunc()(cmd, args)
+
+			return ErrNonFuncCMD
+		},
+	}
+
+	config.BindFlags(rootCMD.PersistentFlags(), config.GroupSQS)
+
+	return rootCMD
+}
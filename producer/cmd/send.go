@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/EWK20/event-processor/producer/config"
+	"github.com/EWK20/event-processor/producer/producer"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrInvalidEvent = errors.New("invalid event")
+)
+
+func createSendCMD() *cobra.Command {
+	sendCMD := &cobra.Command{
+		Use:   "send",
+		Short: "Send one event, built from flags or read from stdin",
+		Long:  "Send one event. Without --event-type, the event is read from stdin and sent as it is, so malformed events can be sent too.",
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(cmd.Flags())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to get config")
+			}
+
+			body, err := eventFromFlags(cmd)
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to build event")
+			}
+
+			p, err := producer.New(*cfg, producer.WithRetry(cfg.SendAttempts, cfg.SendBackoff, cfg.SendMaxBackoff))
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to create producer")
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			if err := p.Send(ctx, body); err != nil {
+				log.Fatal().Err(err).Msg("failed to send event")
+			}
+
+			log.Info().Str("queue", cfg.SQSQueueName).Msg("event sent")
+		},
+	}
+
+	sendCMD.Flags().String("event-type", "", "type of the event, the event is read from stdin when empty")
+	sendCMD.Flags().String("client-id", "", "client the event belongs to")
+	sendCMD.Flags().String("payload", "{}", "JSON payload of the event")
+	sendCMD.Flags().Int("schema-version", 0, "schema version of the event, omitted when 0")
+	sendCMD.Flags().String("timestamp", "", "RFC 3339 timestamp of the event, the current time when empty")
+
+	return sendCMD
+}
+
+// eventFromFlags encodes the event described by the flags, or reads it from
+// stdin when no event type is given.
+func eventFromFlags(cmd *cobra.Command) ([]byte, error) {
+	eventType, _ := cmd.Flags().GetString("event-type")
+
+	if eventType == "" {
+		body, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", producer.ErrFailedToRead, err)
+		}
+
+		if body = bytes.TrimSpace(body); len(body) == 0 {
+			return nil, fmt.Errorf("%w: no --event-type and nothing on stdin", ErrInvalidEvent)
+		}
+
+		return body, nil
+	}
+
+	clientID, _ := cmd.Flags().GetString("client-id")
+	payload, _ := cmd.Flags().GetString("payload")
+	schemaVersion, _ := cmd.Flags().GetInt("schema-version")
+	timestamp, _ := cmd.Flags().GetString("timestamp")
+
+	if !json.Valid([]byte(payload)) {
+		return nil, fmt.Errorf("%w: --payload isn't valid JSON", ErrInvalidEvent)
+	}
+
+	event := models.Event{
+		EventType:     eventType,
+		ClientID:      clientID,
+		Payload:       json.RawMessage(payload),
+		Timestamp:     time.Now().UTC(),
+		SchemaVersion: schemaVersion,
+	}
+
+	if timestamp != "" {
+		parsed, err := time.Parse(time.RFC3339, timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("%w: --timestamp isn't RFC 3339: %w", ErrInvalidEvent, err)
+		}
+
+		event.Timestamp = parsed
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", producer.ErrFailedToMarshal, err)
+	}
+
+	return body, nil
+}
+
+func createSendFileCMD() *cobra.Command {
+	sendFileCMD := &cobra.Command{
+		Use:   "send-file <path>",
+		Short: "Send the events of an NDJSON file, or stdin with -, in order",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(cmd.Flags())
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to get config")
+			}
+
+			rate, _ := cmd.Flags().GetFloat64("rate")
+
+			input := cmd.InOrStdin()
+
+			if args[0] != "-" {
+				file, err := os.Open(args[0])
+				if err != nil {
+					log.Fatal().Err(err).Str("path", args[0]).Msg("failed to open events file")
+				}
+				defer file.Close()
+
+				input = file
+			}
+
+			p, err := producer.New(*cfg, producer.WithRetry(cfg.SendAttempts, cfg.SendBackoff, cfg.SendMaxBackoff))
+			if err != nil {
+				log.Fatal().Err(err).Msg("failed to create producer")
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			sent, err := p.SendFile(ctx, input, rate)
+			if err != nil {
+				log.Fatal().Err(err).Int("sent", sent).Msg("failed to send events")
+			}
+
+			log.Info().Int("sent", sent).Str("queue", cfg.SQSQueueName).Msg("events sent")
+		},
+	}
+
+	sendFileCMD.Flags().Float64("rate", 0, "maximum events sent per second, 0 is unlimited")
+
+	return sendFileCMD
+}
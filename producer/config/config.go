@@ -3,11 +3,15 @@ package config
 import (
 	"errors"
 	"fmt"
-	"os"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/pflag"
 )
 
 var (
 	ErrMissingCfg = errors.New("required config missing")
+	ErrInvalidCfg = errors.New("config is invalid")
 )
 
 type Config struct {
@@ -16,30 +20,112 @@ type Config struct {
 	AWSRegion          string
 	AWSAccessKeyID     string
 	AWSSecretAccessKey string
+	// ScenarioFiles lists the scenarios to run, the default scenario runs
+	// when it is empty.
+	ScenarioFiles []string
+	// FaultPercent and FaultKinds inject malformed events into the scenarios
+	// that don't set their own faults.
+	FaultPercent float64
+	FaultKinds   []string
+	// Each event is sent up to SendAttempts times, with a backoff doubling from
+	// SendBackoff up to SendMaxBackoff, before the event is spilled.
+	SendAttempts   int
+	SendBackoff    time.Duration
+	SendMaxBackoff time.Duration
+	// SpillFile keeps the events that couldn't be sent, resent every
+	// SpillInterval until SQS is reachable again.
+	SpillFile     string
+	SpillInterval time.Duration
+	// Seed makes the generated events the same on every run when set, with
+	// timestamps starting from StartTime.
+	Seed      *int64
+	StartTime time.Time
+	// Count and Duration replace the limits of every scenario when set.
+	Count    int
+	Duration time.Duration
+	// EmitFile records every event sent.
+	EmitFile string
+	// LoadTest configures the flood command.
+	LoadTest LoadTest
+}
+
+// LoadTest configures a load test. Rate 0 sends as fast as possible.
+type LoadTest struct {
+	Rate      float64
+	StartRate float64
+	Ramp      time.Duration
+	Duration  time.Duration
+	Senders   int
+	BatchSize int
+	// DatabaseURL is the processor's database, polled for end to end latency
+	// when set.
+	DatabaseURL string
+	E2ETimeout  time.Duration
 }
 
+// New builds the config from environment variables only.
 func New() (*Config, error) {
+	return Load(nil)
+}
+
+// Load resolves the config from environment variables, overridden by
+// explicitly set flags. Every problem found is reported in the returned
+// error.
+func Load(flags *pflag.FlagSet) (*Config, error) {
 	var cfg Config
 
-	if cfg.SQSQueueName = os.Getenv("SQS_QUEUE_NAME"); cfg.SQSQueueName == "" {
-		return nil, fmt.Errorf("%w: %s", ErrMissingCfg, "SQS_QUEUE_NAME")
+	errs := applyEnv(&cfg)
+	errs = append(errs, applyFlags(flags, &cfg)...)
+
+	applyDefaults(&cfg)
+
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err)
 	}
 
-	if cfg.SQSEndpoint = os.Getenv("SQS_ENDPOINT"); cfg.SQSEndpoint == "" {
-		return nil, fmt.Errorf("%w: %s", ErrMissingCfg, "SQS_ENDPOINT")
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
 	}
 
-	if cfg.AWSRegion = os.Getenv("AWS_REGION"); cfg.AWSRegion == "" {
-		return nil, fmt.Errorf("%w: %s", ErrMissingCfg, "AWS_REGION")
+	return &cfg, nil
+}
+
+func (c *Config) Validate() error {
+	var errs []error
+
+	for _, s := range settings {
+		if s.required && isZero(s.ptr(c)) {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrMissingCfg, s.name()))
+		}
+
+		if isNegative(s.ptr(c)) {
+			errs = append(errs, fmt.Errorf("%w: %s can't be negative", ErrInvalidCfg, s.name()))
+		}
 	}
 
-	if cfg.AWSAccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID"); cfg.AWSAccessKeyID == "" {
-		return nil, fmt.Errorf("%w: %s", ErrMissingCfg, "AWS_ACCESS_KEY_ID")
+	if (c.AWSAccessKeyID == "") != (c.AWSSecretAccessKey == "") {
+		errs = append(errs, fmt.Errorf("%w: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set together", ErrMissingCfg))
 	}
 
-	if cfg.AWSSecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY"); cfg.AWSSecretAccessKey == "" {
-		return nil, fmt.Errorf("%w: %s", ErrMissingCfg, "AWS_SECRET_ACCESS_KEY")
+	if c.FaultPercent > 100 {
+		errs = append(errs, fmt.Errorf("%w: FAULT_PERCENT can be at most 100", ErrInvalidCfg))
 	}
 
-	return &cfg, nil
+	if c.LoadTest.BatchSize > 10 {
+		errs = append(errs, fmt.Errorf("%w: LOAD_BATCH_SIZE can be at most 10", ErrInvalidCfg))
+	}
+
+	return errors.Join(errs...)
+}
+
+func applyDefaults(cfg *Config) {
+	for _, s := range settings {
+		if s.def == "" || !isZero(s.ptr(cfg)) {
+			continue
+		}
+
+		if err := set(s.ptr(cfg), s.def); err != nil {
+			log.Warn().Err(err).Str("setting", s.env).Msg("failed to apply default")
+		}
+	}
 }
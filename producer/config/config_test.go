@@ -0,0 +1,145 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/producer/config"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var envs = []string{
+	"SQS_QUEUE_NAME", "SQS_ENDPOINT", "AWS_REGION", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY",
+	"SEND_ATTEMPTS", "SEND_BACKOFF", "SEND_MAX_BACKOFF",
+	"SCENARIO_FILES", "FAULT_PERCENT", "FAULT_KINDS", "SEED", "START_TIME",
+	"COUNT", "DURATION", "SPILL_FILE", "SPILL_INTERVAL", "EMIT_FILE",
+	"LOAD_RATE", "LOAD_START_RATE", "LOAD_RAMP", "LOAD_DURATION", "LOAD_SENDERS", "LOAD_BATCH_SIZE",
+	"DATABASE_URL", "LOAD_E2E_TIMEOUT",
+}
+
+func defaultConfig() *config.Config {
+	return &config.Config{
+		SQSQueueName:   "events",
+		AWSRegion:      "eu-west-2",
+		SendAttempts:   5,
+		SendBackoff:    200 * time.Millisecond,
+		SendMaxBackoff: 10 * time.Second,
+		SpillFile:      "spill.ndjson",
+		SpillInterval:  5 * time.Second,
+		StartTime:      time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC),
+		LoadTest: config.LoadTest{
+			Duration:   time.Minute,
+			Senders:    4,
+			BatchSize:  10,
+			E2ETimeout: 30 * time.Second,
+		},
+	}
+}
+
+func TestLoad(t *testing.T) {
+	type Test struct {
+		envs   map[string]string
+		flags  []string
+		output func(*config.Config)
+		err    error
+	}
+
+	seed := int64(42)
+
+	testCases := map[string]Test{
+		"Defaults": {
+			output: func(*config.Config) {},
+		},
+		"Env Values": {
+			envs: map[string]string{
+				"SCENARIO_FILES": "a.yaml, b.yaml",
+				"FAULT_PERCENT":  "2.5",
+				"SEED":           "42",
+				"START_TIME":     "2025-06-01T12:00:00Z",
+				"COUNT":          "100",
+				"LOAD_RATE":      "500",
+			},
+			output: func(cfg *config.Config) {
+				cfg.ScenarioFiles = []string{"a.yaml", "b.yaml"}
+				cfg.FaultPercent = 2.5
+				cfg.Seed = &seed
+				cfg.StartTime = time.Date(2025, time.June, 1, 12, 0, 0, 0, time.UTC)
+				cfg.Count = 100
+				cfg.LoadTest.Rate = 500
+			},
+		},
+		"Flags Override Env": {
+			envs: map[string]string{
+				"SEND_ATTEMPTS": "3",
+				"COUNT":         "100",
+			},
+			flags: []string{"--count", "10", "--sqs-queue-name", "flagged", "--load-duration", "5s"},
+			output: func(cfg *config.Config) {
+				cfg.SQSQueueName = "flagged"
+				cfg.SendAttempts = 3
+				cfg.Count = 10
+				cfg.LoadTest.Duration = 5 * time.Second
+			},
+		},
+		"Invalid Env Value": {
+			envs: map[string]string{"SEED": "random"},
+			err:  config.ErrInvalidCfg,
+		},
+		"Negative Value": {
+			flags: []string{"--count", "-1"},
+			err:   config.ErrInvalidCfg,
+		},
+		"Fault Percent Over 100": {
+			envs: map[string]string{"FAULT_PERCENT": "150"},
+			err:  config.ErrInvalidCfg,
+		},
+		"Batch Size Over 10": {
+			flags: []string{"--load-batch-size", "11"},
+			err:   config.ErrInvalidCfg,
+		},
+		"Access Key Without Secret": {
+			envs: map[string]string{"AWS_ACCESS_KEY_ID": "key"},
+			err:  config.ErrMissingCfg,
+		},
+		"Missing Queue": {
+			envs: map[string]string{"SQS_QUEUE_NAME": ""},
+			err:  config.ErrMissingCfg,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			for _, env := range envs {
+				t.Setenv(env, "")
+			}
+
+			t.Setenv("SQS_QUEUE_NAME", "events")
+			t.Setenv("AWS_REGION", "eu-west-2")
+
+			for key, value := range test.envs {
+				t.Setenv(key, value)
+			}
+
+			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+			config.BindFlags(flags, config.GroupSQS, config.GroupScenario, config.GroupGenerate, config.GroupLoadTest)
+			require.NoError(t, flags.Parse(test.flags))
+
+			cfg, err := config.Load(flags)
+
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			expected := defaultConfig()
+			test.output(expected)
+
+			assert.Equal(t, expected, cfg)
+		})
+	}
+}
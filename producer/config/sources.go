@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+// Group is a set of settings, bound as flags of the commands using them.
+type Group int
+
+const (
+	// GroupSQS is used by every command.
+	GroupSQS Group = iota
+	// GroupScenario is used by the commands generating events from scenarios.
+	GroupScenario
+	GroupGenerate
+	GroupLoadTest
+)
+
+type setting struct {
+	group    Group
+	env      string
+	flag     string
+	usage    string
+	def      string
+	required bool
+	ptr      func(*Config) any
+}
+
+func (s setting) name() string {
+	return fmt.Sprintf("%s (--%s)", s.env, s.flag)
+}
+
+var settings = []setting{
+	{group: GroupSQS, env: "SQS_QUEUE_NAME", flag: "sqs-queue-name", usage: "SQS queue to send events to", required: true, ptr: func(c *Config) any { return &c.SQSQueueName }},
+	{group: GroupSQS, env: "SQS_ENDPOINT", flag: "sqs-endpoint", usage: "SQS endpoint URL, resolved by the AWS SDK when empty", ptr: func(c *Config) any { return &c.SQSEndpoint }},
+	{group: GroupSQS, env: "AWS_REGION", flag: "aws-region", usage: "AWS region", required: true, ptr: func(c *Config) any { return &c.AWSRegion }},
+	{group: GroupSQS, env: "AWS_ACCESS_KEY_ID", flag: "aws-access-key-id", usage: "static AWS access key ID, the default credential chain is used when empty", ptr: func(c *Config) any { return &c.AWSAccessKeyID }},
+	{group: GroupSQS, env: "AWS_SECRET_ACCESS_KEY", flag: "aws-secret-access-key", usage: "static AWS secret access key, the default credential chain is used when empty", ptr: func(c *Config) any { return &c.AWSSecretAccessKey }},
+	{group: GroupSQS, env: "SEND_ATTEMPTS", flag: "send-attempts", usage: "attempts to send each event before giving up", def: "5", ptr: func(c *Config) any { return &c.SendAttempts }},
+	{group: GroupSQS, env: "SEND_BACKOFF", flag: "send-backoff", usage: "wait before retrying a send, doubled after every attempt", def: "200ms", ptr: func(c *Config) any { return &c.SendBackoff }},
+	{group: GroupSQS, env: "SEND_MAX_BACKOFF", flag: "send-max-backoff", usage: "longest wait between send attempts", def: "10s", ptr: func(c *Config) any { return &c.SendMaxBackoff }},
+	{group: GroupScenario, env: "SCENARIO_FILES", flag: "scenario-files", usage: "comma separated scenario files, the default scenario is used when empty", ptr: func(c *Config) any { return &c.ScenarioFiles }},
+	{group: GroupScenario, env: "FAULT_PERCENT", flag: "fault-percent", usage: "percentage of malformed events in scenarios that don't set their own faults", ptr: func(c *Config) any { return &c.FaultPercent }},
+	{group: GroupScenario, env: "FAULT_KINDS", flag: "fault-kinds", usage: "comma separated kinds of malformed events, every kind when empty", ptr: func(c *Config) any { return &c.FaultKinds }},
+	{group: GroupScenario, env: "SEED", flag: "seed", usage: "seed making the generated events the same on every run", ptr: func(c *Config) any { return &c.Seed }},
+	{group: GroupScenario, env: "START_TIME", flag: "start-time", usage: "RFC 3339 timestamp of the first seeded event", def: "2025-01-01T00:00:00Z", ptr: func(c *Config) any { return &c.StartTime }},
+	{group: GroupGenerate, env: "COUNT", flag: "count", usage: "events sent by each scenario, replacing the scenarios' limits", ptr: func(c *Config) any { return &c.Count }},
+	{group: GroupGenerate, env: "DURATION", flag: "duration", usage: "how long each scenario runs, replacing the scenarios' limits", ptr: func(c *Config) any { return &c.Duration }},
+	{group: GroupGenerate, env: "SPILL_FILE", flag: "spill-file", usage: "file keeping the events that couldn't be sent", def: "spill.ndjson", ptr: func(c *Config) any { return &c.SpillFile }},
+	{group: GroupGenerate, env: "SPILL_INTERVAL", flag: "spill-interval", usage: "how often spilled events are resent", def: "5s", ptr: func(c *Config) any { return &c.SpillInterval }},
+	{group: GroupGenerate, env: "EMIT_FILE", flag: "emit-file", usage: "NDJSON file recording every event sent", ptr: func(c *Config) any { return &c.EmitFile }},
+	{group: GroupLoadTest, env: "LOAD_RATE", flag: "load-rate", usage: "target events sent per second, 0 sends as fast as possible", ptr: func(c *Config) any { return &c.LoadTest.Rate }},
+	{group: GroupLoadTest, env: "LOAD_START_RATE", flag: "load-start-rate", usage: "rate the ramp starts from", ptr: func(c *Config) any { return &c.LoadTest.StartRate }},
+	{group: GroupLoadTest, env: "LOAD_RAMP", flag: "load-ramp", usage: "how long the rate rises linearly to the target rate", ptr: func(c *Config) any { return &c.LoadTest.Ramp }},
+	{group: GroupLoadTest, env: "LOAD_DURATION", flag: "load-duration", usage: "how long events are sent", def: "1m", ptr: func(c *Config) any { return &c.LoadTest.Duration }},
+	{group: GroupLoadTest, env: "LOAD_SENDERS", flag: "load-senders", usage: "concurrent SendMessageBatch calls", def: "4", ptr: func(c *Config) any { return &c.LoadTest.Senders }},
+	{group: GroupLoadTest, env: "LOAD_BATCH_SIZE", flag: "load-batch-size", usage: "events per SendMessageBatch call, at most 10", def: "10", ptr: func(c *Config) any { return &c.LoadTest.BatchSize }},
+	{group: GroupLoadTest, env: "DATABASE_URL", flag: "database-url", usage: "processor's database, polled for end to end latency when set", ptr: func(c *Config) any { return &c.LoadTest.DatabaseURL }},
+	{group: GroupLoadTest, env: "LOAD_E2E_TIMEOUT", flag: "load-e2e-timeout", usage: "how long to wait for sent events to be saved", def: "30s", ptr: func(c *Config) any { return &c.LoadTest.E2ETimeout }},
+}
+
+// BindFlags registers one override flag per setting of groups.
+func BindFlags(flags *pflag.FlagSet, groups ...Group) {
+	var cfg Config
+
+	for _, s := range settings {
+		if !slices.Contains(groups, s.group) {
+			continue
+		}
+
+		switch s.ptr(&cfg).(type) {
+		case *int:
+			flags.Int(s.flag, 0, s.usage)
+		case *float64:
+			flags.Float64(s.flag, 0, s.usage)
+		case *time.Duration:
+			flags.Duration(s.flag, 0, s.usage)
+		default:
+			flags.String(s.flag, "", s.usage)
+		}
+	}
+}
+
+func applyEnv(cfg *Config) []error {
+	var errs []error
+
+	for _, s := range settings {
+		value := os.Getenv(s.env)
+		if value == "" {
+			continue
+		}
+
+		if err := set(s.ptr(cfg), value); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %w", ErrInvalidCfg, s.env, err))
+		}
+	}
+
+	return errs
+}
+
+func applyFlags(flags *pflag.FlagSet, cfg *Config) []error {
+	if flags == nil {
+		return nil
+	}
+
+	var errs []error
+
+	for _, s := range settings {
+		if !flags.Changed(s.flag) {
+			continue
+		}
+
+		if err := set(s.ptr(cfg), flags.Lookup(s.flag).Value.String()); err != nil {
+			errs = append(errs, fmt.Errorf("%w: --%s: %w", ErrInvalidCfg, s.flag, err))
+		}
+	}
+
+	return errs
+}
+
+func set(ptr any, value string) error {
+	switch p := ptr.(type) {
+	case *string:
+		*p = value
+	case *int:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*p = v
+	case **int64:
+		v, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		*p = &v
+	case *float64:
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		*p = v
+	case *time.Duration:
+		v, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*p = v
+	case *time.Time:
+		v, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return err
+		}
+		*p = v
+	case *[]string:
+		var values []string
+
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, v)
+			}
+		}
+		*p = values
+	default:
+		return fmt.Errorf("unsupported setting type %T", ptr)
+	}
+
+	return nil
+}
+
+func isZero(ptr any) bool {
+	return reflect.ValueOf(ptr).Elem().IsZero()
+}
+
+func isNegative(ptr any) bool {
+	switch p := ptr.(type) {
+	case *int:
+		return *p < 0
+	case *float64:
+		return *p < 0
+	case *time.Duration:
+		return *p < 0
+	default:
+		return false
+	}
+}
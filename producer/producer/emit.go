@@ -0,0 +1,64 @@
+package producer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var (
+	ErrFailedToEmit = errors.New("failed to write emitted event")
+)
+
+// emitter records the events sent, in the order they were sent, so a run can
+// be compared with what the processor saved or sent again.
+type emitter struct {
+	mu     sync.Mutex
+	file   *os.File
+	writer *bufio.Writer
+}
+
+func openEmitter(path string) (*emitter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToEmit, err)
+	}
+
+	return &emitter{file: file, writer: bufio.NewWriter(file)}, nil
+}
+
+func (e *emitter) write(msg message) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToEmit, err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, err := e.writer.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToEmit, err)
+	}
+
+	return nil
+}
+
+func (e *emitter) close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if err := e.writer.Flush(); err != nil {
+		e.file.Close()
+
+		return fmt.Errorf("%w: %w", ErrFailedToEmit, err)
+	}
+
+	if err := e.file.Close(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToEmit, err)
+	}
+
+	return nil
+}
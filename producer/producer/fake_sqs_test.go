@@ -0,0 +1,145 @@
+package producer_test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/EWK20/event-processor/producer/config"
+	"github.com/EWK20/event-processor/producer/producer"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSQS answers the SQS calls the producer makes, remembering the messages
+// it is sent. Sends fail while it is down and for the next failures sends.
+type fakeSQS struct {
+	mu       sync.Mutex
+	messages []message
+	down     atomic.Bool
+	failures atomic.Int32
+	// delay holds every send for this long.
+	delay time.Duration
+}
+
+type message struct {
+	ID             string
+	Body           string
+	Fault          string
+	IdempotencyKey string
+}
+
+type entry struct {
+	Id                string
+	MessageBody       string
+	MessageAttributes map[string]struct{ StringValue string }
+}
+
+func (f *fakeSQS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var response any
+
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "AmazonSQS.")
+
+	if operation != "GetQueueUrl" {
+		time.Sleep(f.delay)
+	}
+
+	if operation != "GetQueueUrl" && (f.down.Load() || f.failures.Add(-1) >= 0) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.WriteHeader(http.StatusInternalServerError)
+		_, _ = w.Write([]byte(`{"__type":"com.amazonaws.sqs#InternalError","message":"service unavailable"}`))
+
+		return
+	}
+
+	switch operation {
+	case "GetQueueUrl":
+		response = map[string]string{"QueueUrl": "http://" + r.Host + "/000000000000/events"}
+	case "SendMessage":
+		var input entry
+
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		response = f.record(input)
+	case "SendMessageBatch":
+		var input struct {
+			Entries []entry
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		successful := make([]map[string]string, 0, len(input.Entries))
+		for _, entry := range input.Entries {
+			successful = append(successful, f.record(entry))
+		}
+
+		response = map[string]any{"Successful": successful, "Failed": []any{}}
+	default:
+		http.Error(w, "unsupported operation", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func (f *fakeSQS) record(entry entry) map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sum := md5.Sum([]byte(entry.MessageBody))
+	id := "msg-" + strconv.Itoa(len(f.messages))
+
+	f.messages = append(f.messages, message{
+		ID:    id,
+		Body:  entry.MessageBody,
+		Fault: entry.MessageAttributes[producer.FaultAttribute].StringValue,
+		// Only events published with the client have a key
+		IdempotencyKey: entry.MessageAttributes[models.IdempotencyKeyAttribute].StringValue,
+	})
+
+	return map[string]string{
+		"Id":               entry.Id,
+		"MessageId":        id,
+		"MD5OfMessageBody": hex.EncodeToString(sum[:]),
+	}
+}
+
+func (f *fakeSQS) sent() []message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]message(nil), f.messages...)
+}
+
+func newProducer(t *testing.T, sqs *fakeSQS, opts ...producer.Option) *producer.Producer {
+	t.Helper()
+
+	server := httptest.NewServer(sqs)
+	t.Cleanup(server.Close)
+
+	p, err := producer.New(config.Config{
+		SQSQueueName:       "events",
+		SQSEndpoint:        server.URL,
+		AWSRegion:          "us-east-1",
+		AWSAccessKeyID:     "test",
+		AWSSecretAccessKey: "test",
+	}, opts...)
+	require.NoError(t, err)
+
+	return p
+}
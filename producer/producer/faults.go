@@ -0,0 +1,108 @@
+package producer
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"strings"
+
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/EWK20/event-processor/producer/scenario"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const (
+	// FaultAttribute tags injected malformed events with their kind of fault.
+	// The processor keeps it on dead lettered messages, next to the
+	// failure_reason.
+	FaultAttribute = "fault"
+
+	// UnknownEventType is the type of unknown_event_type faults.
+	UnknownEventType = "unknown_event"
+
+	// oversizedPayloadLength is well over the processor's payload limit while
+	// keeping messages within the SQS limit.
+	oversizedPayloadLength = 4096
+)
+
+// encode marshals a generated event, malformed as its fault asks.
+func encode(generated scenario.Event) ([]byte, error) {
+	event := models.Event{
+		EventType:     generated.Type,
+		ClientID:      generated.ClientID,
+		Payload:       generated.Payload,
+		Timestamp:     generated.Timestamp,
+		SchemaVersion: generated.SchemaVersion,
+	}
+
+	switch generated.Fault {
+	case scenario.FaultOversizedPayload:
+		payload := maps.Clone(generated.Payload)
+		if payload == nil {
+			payload = make(map[string]any)
+		}
+
+		payload["padding"] = strings.Repeat("x", oversizedPayloadLength)
+		event.Payload = payload
+	case scenario.FaultUnknownEventType:
+		event.EventType = UnknownEventType
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToMarshal, err)
+	}
+
+	switch generated.Fault {
+	case scenario.FaultInvalidJSON:
+		body = body[:len(body)/2]
+	case scenario.FaultMissingClientID:
+		body, err = setField(body, "client_id", nil)
+	case scenario.FaultBadTimestamp:
+		body, err = setField(body, "timestamp", generated.Timestamp.Format("02/01/2006 15:04:05"))
+	}
+
+	return body, err
+}
+
+// setField sets a field of the encoded event, removing it when value is nil.
+func setField(body []byte, name string, value any) ([]byte, error) {
+	var fields map[string]json.RawMessage
+
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToMarshal, err)
+	}
+
+	if value == nil {
+		delete(fields, name)
+	} else {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFailedToMarshal, err)
+		}
+
+		fields[name] = encoded
+	}
+
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToMarshal, err)
+	}
+
+	return body, nil
+}
+
+// faultAttributes tags a malformed event, returning nil for valid ones.
+func faultAttributes(fault scenario.Fault) map[string]types.MessageAttributeValue {
+	if fault == "" {
+		return nil
+	}
+
+	return map[string]types.MessageAttributeValue{
+		FaultAttribute: {
+			DataType:    aws.String("String"),
+			StringValue: aws.String(string(fault)),
+		},
+	}
+}
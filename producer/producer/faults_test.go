@@ -0,0 +1,91 @@
+package producer_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/producer/producer"
+	"github.com/EWK20/event-processor/producer/scenario"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaults(t *testing.T) {
+	type Test struct {
+		check func(t *testing.T, body string)
+	}
+
+	decode := func(t *testing.T, body string) map[string]any {
+		var fields map[string]any
+		require.NoError(t, json.Unmarshal([]byte(body), &fields))
+
+		return fields
+	}
+
+	testCases := map[scenario.Fault]Test{
+		scenario.FaultInvalidJSON: {
+			check: func(t *testing.T, body string) {
+				assert.False(t, json.Valid([]byte(body)))
+			},
+		},
+		scenario.FaultMissingClientID: {
+			check: func(t *testing.T, body string) {
+				assert.NotContains(t, decode(t, body), "client_id")
+			},
+		},
+		scenario.FaultBadTimestamp: {
+			check: func(t *testing.T, body string) {
+				_, err := time.Parse(time.RFC3339, decode(t, body)["timestamp"].(string))
+				assert.Error(t, err)
+			},
+		},
+		scenario.FaultOversizedPayload: {
+			check: func(t *testing.T, body string) {
+				payload, err := json.Marshal(decode(t, body)["payload"])
+				require.NoError(t, err)
+				assert.Greater(t, len(payload), 1000)
+				assert.Less(t, len(body), 256*1024)
+			},
+		},
+		scenario.FaultUnknownEventType: {
+			check: func(t *testing.T, body string) {
+				assert.Equal(t, producer.UnknownEventType, decode(t, body)["event_type"])
+			},
+		},
+	}
+
+	for fault, test := range testCases {
+		t.Run(string(fault), func(t *testing.T) {
+			sqs := &fakeSQS{}
+
+			s := scenario.Default()
+			s.Faults = scenario.Faults{Percent: 50, Kinds: []scenario.Fault{fault}}
+
+			_, err := newProducer(t, sqs).LoadTest(context.Background(), s,
+				producer.WithRate(200),
+				producer.WithDuration(200*time.Millisecond),
+			)
+			require.NoError(t, err)
+
+			var faults int
+
+			for _, msg := range sqs.sent() {
+				if msg.Fault == "" {
+					// Events without a fault are sent as they are
+					assert.Equal(t, "transaction_approved", decode(t, msg.Body)["event_type"])
+
+					continue
+				}
+
+				faults++
+
+				assert.Equal(t, string(fault), msg.Fault)
+				test.check(t, msg.Body)
+			}
+
+			assert.Positive(t, faults)
+		})
+	}
+}
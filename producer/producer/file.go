@@ -0,0 +1,52 @@
+package producer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrFailedToRead = errors.New("failed to read events")
+)
+
+// maxLineLength is well over the largest SQS message, so oversized events are
+// rejected by SQS rather than cut short.
+const maxLineLength = 1024 * 1024
+
+// SendFile sends every line of r as an event, in order, at no more than rate
+// events per second when rate is above 0. It stops at the first event that
+// can't be sent, returning the number sent before it.
+func (p *Producer) SendFile(ctx context.Context, r io.Reader, rate float64) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxLineLength)
+
+	limiter := newLimiter(rate)
+	sent := 0
+
+	for line := 1; scanner.Scan(); line++ {
+		body := bytes.TrimSpace(scanner.Bytes())
+		if len(body) == 0 {
+			continue
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			return sent, err
+		}
+
+		if err := p.Send(ctx, body); err != nil {
+			return sent, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		sent++
+	}
+
+	if err := scanner.Err(); err != nil {
+		return sent, fmt.Errorf("%w: %w", ErrFailedToRead, err)
+	}
+
+	return sent, nil
+}
@@ -0,0 +1,14 @@
+package producer
+
+import "golang.org/x/time/rate"
+
+// newLimiter spaces sends so that, on average, no more than perSecond events
+// are sent per second. The first event is sent straight away, and 0 doesn't
+// limit sends.
+func newLimiter(perSecond float64) *rate.Limiter {
+	if perSecond <= 0 {
+		return rate.NewLimiter(rate.Inf, 0)
+	}
+
+	return rate.NewLimiter(rate.Limit(perSecond), 1)
+}
@@ -0,0 +1,445 @@
+package producer
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/client"
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/EWK20/event-processor/producer/scenario"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	maxBatchSize        = 10
+	defaultPollInterval = 250 * time.Millisecond
+)
+
+// Store looks up when a client's sent events were received and saved by the
+// processor, keyed by SQS message ID. Events not saved yet are left out.
+type Store interface {
+	Persisted(ctx context.Context, clientID string, messageIDs []string) (map[string]Persisted, error)
+}
+
+type Persisted struct {
+	ReceivedAt  time.Time
+	PersistedAt time.Time
+}
+
+// Report summarises a load test. Latencies are only measured for the events
+// of successful sends.
+type Report struct {
+	Sent    int
+	Failed  int
+	Elapsed time.Duration
+	// Rate is the achieved number of events sent per second.
+	Rate float64
+	// SendLatency is the latency of the SendMessageBatch calls.
+	SendLatency Percentiles
+	// QueueLatency, from sending to the processor receiving an event, and
+	// EndToEnd, from sending to saving it, are only measured with a Store.
+	QueueLatency *Percentiles
+	EndToEnd     *Percentiles
+	// Missing counts the sent events not saved before the end to end timeout.
+	Missing int
+}
+
+type Percentiles struct {
+	Count int
+	P50   time.Duration
+	P90   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+func percentiles(samples []time.Duration) Percentiles {
+	if len(samples) == 0 {
+		return Percentiles{}
+	}
+
+	slices.Sort(samples)
+
+	at := func(p float64) time.Duration {
+		return samples[int(p*float64(len(samples)-1))]
+	}
+
+	return Percentiles{
+		Count: len(samples),
+		P50:   at(0.50),
+		P90:   at(0.90),
+		P95:   at(0.95),
+		P99:   at(0.99),
+		Max:   samples[len(samples)-1],
+	}
+}
+
+type loadTest struct {
+	rate         float64
+	startRate    float64
+	ramp         time.Duration
+	duration     time.Duration
+	senders      int
+	batchSize    int
+	store        Store
+	timeout      time.Duration
+	pollInterval time.Duration
+}
+
+type LoadTestOption func(*loadTest)
+
+// WithRate sets the target number of events sent per second, 0 sends as fast
+// as the senders can.
+func WithRate(rate float64) LoadTestOption {
+	return func(l *loadTest) {
+		l.rate = max(rate, 0)
+	}
+}
+
+// WithRamp raises the rate linearly from startRate to the target rate over
+// the first part of the test. It has no effect without a target rate.
+func WithRamp(startRate float64, over time.Duration) LoadTestOption {
+	return func(l *loadTest) {
+		l.startRate = max(startRate, 0)
+		l.ramp = max(over, 0)
+	}
+}
+
+func WithDuration(duration time.Duration) LoadTestOption {
+	return func(l *loadTest) {
+		l.duration = duration
+	}
+}
+
+// WithSenders sets the number of concurrent SendMessageBatch calls.
+func WithSenders(senders int) LoadTestOption {
+	return func(l *loadTest) {
+		l.senders = max(senders, 1)
+	}
+}
+
+// WithBatchSize sets the events per SendMessageBatch call, at most 10.
+func WithBatchSize(size int) LoadTestOption {
+	return func(l *loadTest) {
+		l.batchSize = min(max(size, 1), maxBatchSize)
+	}
+}
+
+// WithEndToEnd polls store for the sent events once sending stops, waiting
+// up to timeout for the processor to save them.
+func WithEndToEnd(store Store, timeout time.Duration) LoadTestOption {
+	return func(l *loadTest) {
+		l.store = store
+		l.timeout = timeout
+	}
+}
+
+// batch is a batch of events waiting for a sender. Malformed events are sent
+// as they are, next to the events published with the client.
+type batch struct {
+	events    []models.Event
+	malformed []types.SendMessageBatchRequestEntry
+}
+
+// sent records when the events of a successful send left the producer, and
+// their clients keyed by message ID.
+type sent struct {
+	clientIDs map[string]string
+	at        time.Time
+}
+
+// LoadTest sends events generated by s as fast as the target rate allows,
+// ignoring the scenario's own rate and duration, and reports the throughput
+// and latencies achieved.
+func (p *Producer) LoadTest(ctx context.Context, s scenario.Scenario, opts ...LoadTestOption) (Report, error) {
+	l := &loadTest{
+		duration:     time.Minute,
+		senders:      4,
+		batchSize:    maxBatchSize,
+		pollInterval: defaultPollInterval,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	generator, err := p.generator(s)
+	if err != nil {
+		return Report{}, err
+	}
+
+	// Templates may render the same event twice, so the load test publishes
+	// with random idempotency keys rather than ones derived from the event
+	publisher, err := client.New(ctx, p.sqsClient, p.queueName)
+	if err != nil {
+		return Report{}, fmt.Errorf("%w: %w", ErrFailedToCreateClient, err)
+	}
+
+	var (
+		mu          sync.Mutex
+		report      Report
+		sendLatency []time.Duration
+		sends       []sent
+		wg          sync.WaitGroup
+		batches     = make(chan batch, l.senders)
+	)
+
+	log.Info().
+		Float64("rate", l.rate).
+		Dur("duration", l.duration).
+		Int("senders", l.senders).
+		Int("batch_size", l.batchSize).
+		Msg("starting load test")
+
+	for range l.senders {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for b := range batches {
+				// A batch in flight when ctx is cancelled is allowed to finish,
+				// rather than counted as failed
+				sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sendTimeout)
+
+				start := time.Now()
+				result := sent{clientIDs: make(map[string]string, len(b.events)), at: start}
+				failed := 0
+
+				if len(b.events) > 0 {
+					receipts, err := publisher.PublishBatch(sendCtx, b.events)
+					if err != nil {
+						log.Error().Err(err).Msg("failed to send batch")
+					}
+
+					for _, receipt := range receipts {
+						if receipt.Err != nil {
+							failed++
+
+							continue
+						}
+
+						result.clientIDs[receipt.MessageID] = receipt.ClientID
+					}
+				}
+
+				// Malformed events are never saved, so they are only counted
+				malformed := 0
+
+				if len(b.malformed) > 0 {
+					out, err := p.sqsClient.SendMessageBatch(sendCtx, &sqs.SendMessageBatchInput{
+						QueueUrl: aws.String(p.queueURL),
+						Entries:  b.malformed,
+					})
+					if err != nil {
+						failed += len(b.malformed)
+						log.Error().Err(err).Msg("failed to send batch")
+					} else {
+						failed += len(out.Failed)
+						malformed = len(out.Successful)
+					}
+				}
+
+				cancel()
+
+				mu.Lock()
+				report.Failed += failed
+				report.Sent += len(result.clientIDs) + malformed
+
+				if len(result.clientIDs)+malformed > 0 {
+					sendLatency = append(sendLatency, time.Since(start))
+					sends = append(sends, result)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	start := time.Now()
+	err = l.dispatch(ctx, p.fifo, generator, batches)
+	close(batches)
+	wg.Wait()
+
+	report.Elapsed = time.Since(start)
+	report.Rate = float64(report.Sent) / report.Elapsed.Seconds()
+	report.SendLatency = percentiles(sendLatency)
+
+	if err != nil {
+		return report, err
+	}
+
+	if l.store != nil {
+		if err := l.measure(ctx, sends, &report); err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// dispatch generates batches, spacing them to follow the target rate, until
+// the duration has passed.
+func (l *loadTest) dispatch(ctx context.Context, fifo bool, generator *scenario.Generator, batches chan<- batch) error {
+	ctx, cancel := context.WithTimeout(ctx, l.duration)
+	defer cancel()
+
+	start := time.Now()
+
+	for batched := 0; ; batched += l.batchSize {
+		if l.rate > 0 {
+			if delay := time.Until(start.Add(l.due(batched))); delay > 0 {
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+
+		var b batch
+
+		for i := range l.batchSize {
+			generated, err := generator.Next()
+			if err != nil {
+				return err
+			}
+
+			if generated.Fault == "" {
+				b.events = append(b.events, models.Event{
+					EventType:     generated.Type,
+					ClientID:      generated.ClientID,
+					Payload:       generated.Payload,
+					Timestamp:     generated.Timestamp,
+					SchemaVersion: generated.SchemaVersion,
+				})
+
+				continue
+			}
+
+			body, err := encode(generated)
+			if err != nil {
+				return err
+			}
+
+			entry := types.SendMessageBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(i)),
+				MessageBody:       aws.String(string(body)),
+				MessageAttributes: faultAttributes(generated.Fault),
+			}
+
+			if fifo {
+				entry.MessageGroupId = aws.String(generated.ClientID)
+				entry.MessageDeduplicationId = aws.String(rand.Text())
+			}
+
+			b.malformed = append(b.malformed, entry)
+		}
+
+		select {
+		case batches <- b:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// due is how far into the test the target rate has sent n events. Scheduling
+// batches by the running total, rather than by the gap since the last batch,
+// keeps a ramp starting near 0 from stalling on its first, slowest gap.
+func (l *loadTest) due(n int) time.Duration {
+	var (
+		events     = float64(n)
+		ramp       = l.ramp.Seconds()
+		rampEvents = (l.startRate + l.rate) / 2 * ramp
+	)
+
+	if events >= rampEvents {
+		return time.Duration((ramp + (events-rampEvents)/l.rate) * float64(time.Second))
+	}
+
+	// Solve startRate*t + (rate-startRate)/(2*ramp)*t² = events for t
+	a := (l.rate - l.startRate) / (2 * ramp)
+	if a == 0 {
+		return time.Duration(events / l.startRate * float64(time.Second))
+	}
+
+	t := (-l.startRate + math.Sqrt(l.startRate*l.startRate+4*a*events)) / (2 * a)
+
+	return time.Duration(t * float64(time.Second))
+}
+
+// measure polls the store until every sent event is saved or the timeout
+// passes.
+func (l *loadTest) measure(ctx context.Context, sends []sent, report *Report) error {
+	var (
+		sentAt   = make(map[string]time.Time)
+		clientOf = make(map[string]string)
+	)
+
+	for _, s := range sends {
+		for id, clientID := range s.clientIDs {
+			sentAt[id] = s.at
+			clientOf[id] = clientID
+		}
+	}
+
+	var (
+		queueLatency []time.Duration
+		endToEnd     []time.Duration
+		deadline     = time.Now().Add(l.timeout)
+	)
+
+	log.Info().Int("events", len(sentAt)).Dur("timeout", l.timeout).Msg("waiting for events to be saved")
+
+	for len(sentAt) > 0 && time.Now().Before(deadline) {
+		ids := make(map[string][]string)
+		for id := range sentAt {
+			ids[clientOf[id]] = append(ids[clientOf[id]], id)
+		}
+
+		for clientID, clientIDs := range ids {
+			for chunk := range slices.Chunk(clientIDs, 1000) {
+				persisted, err := l.store.Persisted(ctx, clientID, chunk)
+				if err != nil {
+					return err
+				}
+
+				for id, p := range persisted {
+					if !p.ReceivedAt.IsZero() {
+						queueLatency = append(queueLatency, p.ReceivedAt.Sub(sentAt[id]))
+					}
+
+					endToEnd = append(endToEnd, p.PersistedAt.Sub(sentAt[id]))
+					delete(sentAt, id)
+				}
+			}
+		}
+
+		if len(sentAt) == 0 {
+			break
+		}
+
+		select {
+		case <-time.After(l.pollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	queue, e2e := percentiles(queueLatency), percentiles(endToEnd)
+
+	report.QueueLatency = &queue
+	report.EndToEnd = &e2e
+	report.Missing = len(sentAt)
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package producer_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/producer/producer"
+	"github.com/EWK20/event-processor/producer/scenario"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStore reports events as saved once they have been looked up twice, and
+// never reports the events in lost.
+type fakeStore struct {
+	mu      sync.Mutex
+	lookups map[string]int
+	lost    map[string]bool
+}
+
+func (f *fakeStore) Persisted(_ context.Context, _ string, messageIDs []string) (map[string]producer.Persisted, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	persisted := make(map[string]producer.Persisted)
+
+	for _, id := range messageIDs {
+		if f.lost[id] {
+			continue
+		}
+
+		if f.lookups[id]++; f.lookups[id] >= 2 {
+			now := time.Now()
+			persisted[id] = producer.Persisted{ReceivedAt: now, PersistedAt: now}
+		}
+	}
+
+	return persisted, nil
+}
+
+func TestLoadTest(t *testing.T) {
+	tests := map[string]struct {
+		opts    []producer.LoadTestOption
+		minSent int
+		maxSent int
+	}{
+		"Target Rate": {
+			opts: []producer.LoadTestOption{
+				producer.WithRate(100),
+				producer.WithDuration(time.Second),
+				producer.WithBatchSize(5),
+			},
+			minSent: 80,
+			maxSent: 110,
+		},
+		"Ramp": {
+			opts: []producer.LoadTestOption{
+				producer.WithRate(100),
+				producer.WithRamp(0, time.Second),
+				producer.WithDuration(time.Second),
+				producer.WithBatchSize(5),
+			},
+			minSent: 35,
+			maxSent: 65,
+		},
+		"Unthrottled": {
+			opts: []producer.LoadTestOption{
+				producer.WithDuration(200 * time.Millisecond),
+				producer.WithSenders(2),
+			},
+			minSent: 10,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sqs := &fakeSQS{}
+
+			report, err := newProducer(t, sqs).LoadTest(context.Background(), scenario.Default(), tc.opts...)
+			require.NoError(t, err)
+
+			assert.Equal(t, len(sqs.sent()), report.Sent)
+			assert.Zero(t, report.Failed)
+			assert.GreaterOrEqual(t, report.Sent, tc.minSent)
+			if tc.maxSent > 0 {
+				assert.LessOrEqual(t, report.Sent, tc.maxSent)
+			}
+
+			assert.InDelta(t, float64(report.Sent)/report.Elapsed.Seconds(), report.Rate, 0.001)
+			assert.Positive(t, report.SendLatency.Count)
+			assert.LessOrEqual(t, report.SendLatency.P50, report.SendLatency.P99)
+			assert.LessOrEqual(t, report.SendLatency.P99, report.SendLatency.Max)
+			assert.Nil(t, report.EndToEnd)
+		})
+	}
+}
+
+func TestLoadTestEndToEnd(t *testing.T) {
+	sqs := &fakeSQS{}
+	store := &fakeStore{
+		lookups: make(map[string]int),
+		lost:    map[string]bool{"msg-0": true, "msg-1": true},
+	}
+
+	report, err := newProducer(t, sqs).LoadTest(context.Background(), scenario.Default(),
+		producer.WithRate(50),
+		producer.WithDuration(500*time.Millisecond),
+		producer.WithEndToEnd(store, 2*time.Second),
+	)
+	require.NoError(t, err)
+
+	require.NotNil(t, report.EndToEnd)
+	require.NotNil(t, report.QueueLatency)
+	assert.Equal(t, 2, report.Missing)
+	assert.Equal(t, report.Sent-2, report.EndToEnd.Count)
+	assert.Equal(t, report.Sent-2, report.QueueLatency.Count)
+	assert.Positive(t, report.EndToEnd.P50)
+}
+
+func TestLoadTestCancelled(t *testing.T) {
+	sqs := &fakeSQS{delay: 50 * time.Millisecond}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Millisecond)
+	defer cancel()
+
+	report, err := newProducer(t, sqs).LoadTest(ctx, scenario.Default(),
+		producer.WithRate(100),
+		producer.WithDuration(time.Minute),
+		producer.WithBatchSize(1),
+	)
+	require.NoError(t, err)
+
+	// The batches in flight when the test was stopped are still sent
+	assert.Zero(t, report.Failed)
+	assert.Positive(t, report.Sent)
+	assert.Equal(t, len(sqs.sent()), report.Sent)
+}
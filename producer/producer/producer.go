@@ -1,15 +1,25 @@
 package producer
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"math/rand"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/EWK20/event-processor/processor/client"
+	"github.com/EWK20/event-processor/processor/models"
 	"github.com/EWK20/event-processor/producer/config"
+	"github.com/EWK20/event-processor/producer/scenario"
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
 	awsConfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
@@ -19,37 +29,119 @@ import (
 var (
 	ErrFailedToCreateClient = errors.New("failed to create SQS client")
 	ErrFailedToGetQueueURL  = errors.New("failed to get queue URL")
+	ErrFailedToMarshal      = errors.New("failed to marshal event")
+	ErrFailedToSend         = errors.New("failed to send event")
 )
 
-type Event struct {
-	EventType string `json:"event_type"`
-	ClientID  string `json:"client_id"`
-	Payload   any    `json:"payload"`
-	Timestamp string `json:"timestamp"`
-}
+const (
+	// sendTimeout bounds each send attempt, which is allowed to finish when
+	// the producer is stopped.
+	sendTimeout = 10 * time.Second
+	// defaultGroupID groups the events sent as they are without a client_id
+	// on FIFO queues.
+	defaultGroupID = "producer"
+)
 
 type Producer struct {
 	sqsClient *sqs.Client
-	queueURL  *sqs.GetQueueUrlOutput
+	queueName string
+	queueURL  string
+	fifo      bool
+	// client publishes the valid events, malformed ones are sent as they are.
+	client *client.Client
+
+	attempts      int
+	backoff       time.Duration
+	maxBackoff    time.Duration
+	spill         *spill
+	spillPath     string
+	spillInterval time.Duration
+
+	seed     *int64
+	start    time.Time
+	emit     *emitter
+	emitPath string
+}
+
+type Option func(*Producer)
+
+// WithRetry makes up to attempts sends of each event, doubling the wait
+// between them from backoff up to maxBackoff.
+func WithRetry(attempts int, backoff, maxBackoff time.Duration) Option {
+	return func(p *Producer) {
+		p.attempts = max(attempts, 1)
+		p.backoff = backoff
+		p.maxBackoff = max(maxBackoff, backoff)
+	}
+}
+
+// WithSpill appends events that still fail to send after retrying to the
+// file at path, and resends them every interval until SQS is reachable
+// again. Events spilled by a previous run are resent too.
+func WithSpill(path string, interval time.Duration) Option {
+	return func(p *Producer) {
+		p.spillPath = path
+		p.spillInterval = interval
+	}
+}
+
+// WithSeed makes the generated events the same on every run: each scenario
+// draws from a rand seeded with seed and its name, and timestamps its events
+// from start at its rate.
+func WithSeed(seed int64, start time.Time) Option {
+	return func(p *Producer) {
+		p.seed = &seed
+		p.start = start
+	}
+}
+
+// WithEmitFile writes every event sent, or spilled to be sent later, to the
+// file at path as NDJSON, replacing it.
+func WithEmitFile(path string) Option {
+	return func(p *Producer) {
+		p.emitPath = path
+	}
 }
 
-func New(cfg config.Config) (*Producer, error) {
-	awsCfg, err := awsConfig.LoadDefaultConfig(context.Background(),
+func New(cfg config.Config, opts ...Option) (*Producer, error) {
+	p := &Producer{
+		attempts:      5,
+		backoff:       200 * time.Millisecond,
+		maxBackoff:    10 * time.Second,
+		spillInterval: 5 * time.Second,
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	awsOpts := []func(*awsConfig.LoadOptions) error{
 		awsConfig.WithRegion(cfg.AWSRegion),
-		awsConfig.WithCredentialsProvider(
+	}
+
+	if cfg.AWSAccessKeyID != "" {
+		awsOpts = append(awsOpts, awsConfig.WithCredentialsProvider(
 			credentials.NewStaticCredentialsProvider(
 				cfg.AWSAccessKeyID,
 				cfg.AWSSecretAccessKey,
 				"",
 			),
-		),
-		awsConfig.WithBaseEndpoint(cfg.SQSEndpoint),
-	)
+		))
+	}
+
+	awsCfg, err := awsConfig.LoadDefaultConfig(context.Background(), awsOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %w", ErrFailedToCreateClient, err)
 	}
 
-	sqsClient := sqs.NewFromConfig(awsCfg)
+	sqsClient := sqs.NewFromConfig(awsCfg, func(o *sqs.Options) {
+		if cfg.SQSEndpoint != "" {
+			o.BaseEndpoint = aws.String(cfg.SQSEndpoint)
+		}
+
+		// The producer retries sends itself, with its own backoff
+		o.Retryer = aws.NopRetryer{}
+	})
 
 	queueURL, err := sqsClient.GetQueueUrl(context.Background(), &sqs.GetQueueUrlInput{
 		QueueName: &cfg.SQSQueueName,
@@ -58,45 +150,349 @@ func New(cfg config.Config) (*Producer, error) {
 		return nil, fmt.Errorf("%w: %w", ErrFailedToCreateClient, err)
 	}
 
-	return &Producer{
-		sqsClient,
-		queueURL,
-	}, nil
+	// Keys derived from the event keep retries, resent spills and seeded
+	// runs from being saved twice
+	p.client, err = client.New(context.Background(), sqsClient, cfg.SQSQueueName, client.WithIdempotencyKey(idempotencyKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToCreateClient, err)
+	}
+
+	p.sqsClient = sqsClient
+	p.queueName = cfg.SQSQueueName
+	p.queueURL = aws.ToString(queueURL.QueueUrl)
+	p.fifo = strings.HasSuffix(p.queueURL, ".fifo")
+
+	if p.spillPath != "" {
+		if p.spill, err = openSpill(p.spillPath); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.emitPath != "" {
+		if p.emit, err = openEmitter(p.emitPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
 }
 
-func (p *Producer) Run() {
-	log.Info().Msg("Producing messages...")
+// Close flushes the emit file.
+func (p *Producer) Close() error {
+	if p.emit != nil {
+		return p.emit.close()
+	}
 
-	clientIDs := []string{"client_123", "client_456", "client_789"}
+	return nil
+}
 
-	rand.New(rand.NewSource(time.Now().UnixNano()))
+// generator creates the generator of a scenario, seeded when the producer
+// is.
+func (p *Producer) generator(s scenario.Scenario) (*scenario.Generator, error) {
+	if p.seed == nil {
+		return scenario.NewGenerator(s, rand.New(rand.NewSource(time.Now().UnixNano())))
+	}
 
-	// Generate random transactions
-	for {
-		event := Event{
-			EventType: "transaction_approved",
-			ClientID:  clientIDs[rand.Intn(len(clientIDs))],
-			Payload: map[string]any{
-				"transaction_id": "txn_" + fmt.Sprint(rand.Intn(1000)),
-				"amount":         fmt.Sprintf("%d.%d", rand.Intn(1000), rand.Intn(99)),
-				"currency":       "GBP",
-			},
-			Timestamp: time.Now().UTC().Format(time.RFC3339),
+	name := fnv.New64a()
+	_, _ = name.Write([]byte(s.Name))
+
+	rng := rand.New(rand.NewSource(*p.seed ^ int64(name.Sum64())))
+
+	return scenario.NewGenerator(s, rng, scenario.WithStart(p.start))
+}
+
+// Run sends the events of every scenario concurrently, each at its own rate,
+// until they all finish or ctx is cancelled.
+func (p *Producer) Run(parent context.Context, scenarios []scenario.Scenario) error {
+	ctx, cancel := context.WithCancelCause(parent)
+	defer cancel(nil)
+
+	var wg sync.WaitGroup
+
+	if p.spill != nil {
+		resendCtx, stop := context.WithCancel(ctx)
+
+		var resender sync.WaitGroup
+
+		resender.Add(1)
+
+		go func() {
+			defer resender.Done()
+
+			p.resend(resendCtx)
+		}()
+
+		defer func() {
+			stop()
+			resender.Wait()
+
+			if pending := p.spill.len(); pending > 0 {
+				log.Warn().Int("events", pending).Str("path", p.spillPath).Msg("events left in the spill file, they are resent on the next run")
+			}
+		}()
+	}
+
+	for _, s := range scenarios {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if err := p.runScenario(ctx, s); err != nil {
+				cancel(fmt.Errorf("%s: %w", s.Name, err))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// Being stopped isn't an error, a failing scenario is
+	if parent.Err() == nil {
+		if err := context.Cause(ctx); err != nil && !errors.Is(err, context.Canceled) {
+			return err
 		}
+	}
+
+	return nil
+}
 
-		msg, err := json.Marshal(&event)
+func (p *Producer) runScenario(ctx context.Context, s scenario.Scenario) error {
+	generator, err := p.generator(s)
+	if err != nil {
+		return err
+	}
+
+	if s.Duration > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, s.Duration)
+		defer cancel()
+	}
+
+	log.Info().Str("scenario", s.Name).Float64("rate", s.Rate).Dur("duration", s.Duration).Int("count", s.Count).Msg("Producing messages...")
+
+	limiter := newLimiter(s.Rate)
+	sent, faults, failed := 0, 0, 0
+
+	for (s.Count == 0 || sent+failed < s.Count) && limiter.Wait(ctx) == nil {
+		generated, err := generator.Next()
 		if err != nil {
-			log.Fatal().Err(err).Msg("failed to marshal json")
+			return err
 		}
 
-		_, err = p.sqsClient.SendMessage(context.Background(), &sqs.SendMessageInput{
-			QueueUrl:    p.queueURL.QueueUrl,
-			MessageBody: aws.String(string(msg)),
-		})
-		if err != nil {
-			panic(err)
+		if err := p.send(ctx, generated); err != nil {
+			if errors.Is(err, ErrFailedToSpill) || errors.Is(err, ErrFailedToEmit) {
+				return err
+			}
+
+			// The event is lost, but the scenario carries on
+			log.Error().Err(err).Str("scenario", s.Name).Msg("failed to send event")
+
+			failed++
+
+			continue
 		}
 
-		time.Sleep(time.Second * 15)
+		sent++
+
+		if generated.Fault != "" {
+			faults++
+		}
 	}
+
+	log.Info().Str("scenario", s.Name).Int("sent", sent).Int("faults", faults).Int("failed", failed).Msg("scenario finished")
+
+	return nil
+}
+
+// message is an encoded event ready to be sent, as it is spilled and emitted.
+type message struct {
+	Body  string `json:"body"`
+	Fault string `json:"fault,omitempty"`
+}
+
+// send sends an event, spilling it when SQS can't be reached. Events are
+// spilled as long as earlier ones are waiting to be resent, to keep them in
+// order.
+func (p *Producer) send(ctx context.Context, generated scenario.Event) error {
+	body, err := encode(generated)
+	if err != nil {
+		return err
+	}
+
+	return p.sendMessage(ctx, message{Body: string(body), Fault: string(generated.Fault)})
+}
+
+// Send sends an encoded event. Bodies that aren't valid events are sent as
+// they are, so bodies the processor rejects can be sent too.
+func (p *Producer) Send(ctx context.Context, body []byte) error {
+	return p.sendMessage(ctx, message{Body: string(body)})
+}
+
+func (p *Producer) sendMessage(ctx context.Context, msg message) error {
+	if err := p.enqueue(ctx, msg); err != nil {
+		return err
+	}
+
+	if p.emit != nil {
+		return p.emit.write(msg)
+	}
+
+	return nil
+}
+
+func (p *Producer) enqueue(ctx context.Context, msg message) error {
+	if p.spill != nil && p.spill.len() > 0 {
+		return p.spill.append(msg)
+	}
+
+	err := p.deliver(ctx, msg)
+	if err == nil || p.spill == nil || !retryable(err) {
+		return err
+	}
+
+	log.Warn().Err(err).Str("path", p.spillPath).Msg("spilling event until SQS is reachable")
+
+	return p.spill.append(msg)
+}
+
+// deliver sends msg, retrying with exponential backoff. An attempt in flight
+// when ctx is cancelled is allowed to finish, but isn't retried.
+func (p *Producer) deliver(ctx context.Context, msg message) error {
+	backoff := p.backoff
+
+	for attempt := 1; ; attempt++ {
+		sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), sendTimeout)
+		err := p.publish(sendCtx, msg)
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+
+		err = fmt.Errorf("%w: %w", ErrFailedToSend, err)
+
+		if attempt >= p.attempts || !retryable(err) {
+			return err
+		}
+
+		log.Warn().Err(err).Int("attempt", attempt).Dur("backoff", backoff).Msg("failed to send event, retrying")
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return err
+		}
+
+		backoff = min(backoff*2, p.maxBackoff)
+	}
+}
+
+// publish sends a valid event with the client. Malformed events, and bodies
+// the client would reject, are sent as they are, tagged with their fault.
+func (p *Producer) publish(ctx context.Context, msg message) error {
+	if event, ok := decodeEvent(msg.Body); ok && msg.Fault == "" {
+		_, err := p.client.Publish(ctx, event)
+
+		return err
+	}
+
+	input := &sqs.SendMessageInput{
+		QueueUrl:          aws.String(p.queueURL),
+		MessageBody:       aws.String(msg.Body),
+		MessageAttributes: faultAttributes(scenario.Fault(msg.Fault)),
+	}
+
+	// FIFO queues keep the order of each client's events, bodies without a
+	// client_id are sent in the default group
+	if p.fifo {
+		input.MessageGroupId = aws.String(groupID(msg.Body))
+		input.MessageDeduplicationId = aws.String(contentKey([]byte(msg.Body)))
+	}
+
+	_, err := p.sqsClient.SendMessage(ctx, input)
+
+	return err
+}
+
+// decodeEvent decodes body as an event the client can publish unchanged.
+// Numbers are kept as they were written and bodies with fields events don't
+// have are refused, so the client sends back the same event.
+func decodeEvent(body string) (models.Event, bool) {
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+	decoder.DisallowUnknownFields()
+
+	var event models.Event
+
+	if err := decoder.Decode(&event); err != nil || decoder.More() {
+		return models.Event{}, false
+	}
+
+	return event, len(event.Problems()) == 0
+}
+
+func groupID(body string) string {
+	var event struct {
+		ClientID string `json:"client_id"`
+	}
+
+	// A body that isn't an event is still sent, in the default group
+	_ = json.Unmarshal([]byte(body), &event)
+
+	return cmp.Or(event.ClientID, defaultGroupID)
+}
+
+// resend drains the spill file every spill interval until ctx is cancelled.
+func (p *Producer) resend(ctx context.Context) {
+	ticker := time.NewTicker(p.spillInterval)
+	defer ticker.Stop()
+
+	for {
+		if pending := p.spill.len(); pending > 0 {
+			sent, err := p.spill.drain(ctx, p.deliver)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to resend spilled events")
+			}
+
+			if sent > 0 {
+				log.Info().Int("sent", sent).Int("pending", p.spill.len()).Msg("resent spilled events")
+			}
+
+			// Keep draining while it makes progress
+			if sent > 0 && p.spill.len() > 0 {
+				continue
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// retryable reports whether sending again may succeed, using the SDK's
+// classification of throttling, server and connection errors.
+func retryable(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
+
+// idempotencyKey derives the key of an event from its content, the same
+// event always having the same key.
+func idempotencyKey(event models.Event) string {
+	body, _ := json.Marshal(event)
+
+	return contentKey(body)
+}
+
+func contentKey(body []byte) string {
+	sum := sha256.Sum256(body)
+
+	return hex.EncodeToString(sum[:])
 }
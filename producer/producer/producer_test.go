@@ -0,0 +1,318 @@
+package producer_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/processor/models"
+	"github.com/EWK20/event-processor/producer/producer"
+	"github.com/EWK20/event-processor/producer/scenario"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sequenced sends events numbered in the order they are generated.
+func sequenced(name string, rate float64, duration time.Duration) scenario.Scenario {
+	return scenario.Scenario{
+		Name:     name,
+		Rate:     rate,
+		Duration: duration,
+		Clients:  []scenario.Client{{ID: "client_123"}},
+		Events: []scenario.EventTemplate{
+			{Type: "transaction_approved", Payload: map[string]any{"seq": name + "-{{.Seq}}"}},
+		},
+	}
+}
+
+func seqs(t *testing.T, messages []message) []string {
+	t.Helper()
+
+	seqs := make([]string, 0, len(messages))
+
+	for _, msg := range messages {
+		var event models.Event
+		require.NoError(t, json.Unmarshal([]byte(msg.Body), &event))
+
+		seqs = append(seqs, event.Payload.(map[string]any)["seq"].(string))
+	}
+
+	return seqs
+}
+
+func TestRun(t *testing.T) {
+	type Test struct {
+		failures int32
+		sent     int
+	}
+
+	testCases := map[string]Test{
+		"Every Event Sent": {
+			sent: 10,
+		},
+		"Failed Sends Retried": {
+			failures: 3,
+			sent:     10,
+		},
+		"Events Dropped After Retries": {
+			failures: 4,
+			sent:     9,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sqs := &fakeSQS{}
+			sqs.failures.Store(test.failures)
+
+			p := newProducer(t, sqs, producer.WithRetry(4, time.Millisecond, 5*time.Millisecond))
+
+			// The limiter sends the first event straight away
+			err := p.Run(t.Context(), []scenario.Scenario{sequenced("run", 100, 95*time.Millisecond)})
+			require.NoError(t, err)
+
+			assert.Len(t, sqs.sent(), test.sent)
+		})
+	}
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	sqs := &fakeSQS{}
+	p := newProducer(t, sqs)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error)
+
+	go func() {
+		done <- p.Run(ctx, []scenario.Scenario{sequenced("forever", 50, 0)})
+	}()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not stop when cancelled")
+	}
+
+	assert.NotEmpty(t, sqs.sent())
+}
+
+func TestSpill(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spill.ndjson")
+	sqs := &fakeSQS{}
+	sqs.down.Store(true)
+
+	opts := []producer.Option{
+		producer.WithRetry(2, time.Millisecond, time.Millisecond),
+		producer.WithSpill(path, 20*time.Millisecond),
+	}
+
+	// Every event is spilled while SQS is down
+	err := newProducer(t, sqs, opts...).Run(t.Context(), []scenario.Scenario{sequenced("down", 100, 95*time.Millisecond)})
+	require.NoError(t, err)
+	assert.Empty(t, sqs.sent())
+
+	spilled, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 10, strings.Count(string(spilled), "\n"))
+
+	// The next run resends them first, keeping new events behind them
+	sqs.down.Store(false)
+
+	err = newProducer(t, sqs, opts...).Run(t.Context(), []scenario.Scenario{sequenced("up", 100, 195*time.Millisecond)})
+	require.NoError(t, err)
+
+	var expected []string
+	for i := range 10 {
+		expected = append(expected, "down-"+strconv.Itoa(i+1))
+	}
+
+	for i := range 20 {
+		expected = append(expected, "up-"+strconv.Itoa(i+1))
+	}
+
+	assert.Equal(t, expected, seqs(t, sqs.sent()))
+	assert.NoFileExists(t, path)
+}
+
+func TestSpillResendsOnceReachable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spill.ndjson")
+	sqs := &fakeSQS{}
+	sqs.down.Store(true)
+
+	p := newProducer(t, sqs,
+		producer.WithRetry(1, time.Millisecond, time.Millisecond),
+		producer.WithSpill(path, 20*time.Millisecond),
+	)
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		sqs.down.Store(false)
+	}()
+
+	err := p.Run(t.Context(), []scenario.Scenario{sequenced("flaky", 100, 295*time.Millisecond)})
+	require.NoError(t, err)
+
+	var expected []string
+	for i := range 30 {
+		expected = append(expected, "flaky-"+strconv.Itoa(i+1))
+	}
+
+	assert.Equal(t, expected, seqs(t, sqs.sent()))
+	assert.NoFileExists(t, path)
+}
+
+func TestSeededRun(t *testing.T) {
+	s := sequenced("seeded", 1000, 0)
+	s.Count = 25
+	s.Faults = scenario.Faults{Percent: 20}
+	s.Events[0].Payload = map[string]any{"amount": "{{decimal 1 100 2}}", "at": "{{now}}"}
+
+	start := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	run := func() ([]message, []byte) {
+		sqs := &fakeSQS{}
+		path := filepath.Join(t.TempDir(), "emitted.ndjson")
+
+		p := newProducer(t, sqs, producer.WithSeed(7, start), producer.WithEmitFile(path))
+		require.NoError(t, p.Run(t.Context(), []scenario.Scenario{s}))
+		require.NoError(t, p.Close())
+
+		emitted, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		return sqs.sent(), emitted
+	}
+
+	sent, emitted := run()
+	require.Len(t, sent, 25)
+
+	// The emit file holds exactly the events sent, in order
+	lines := strings.Split(strings.TrimSpace(string(emitted)), "\n")
+	require.Len(t, lines, 25)
+
+	for i, line := range lines {
+		var msg struct {
+			Body  string `json:"body"`
+			Fault string `json:"fault"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(line), &msg))
+
+		assert.Equal(t, sent[i].Body, msg.Body)
+		assert.Equal(t, sent[i].Fault, msg.Fault)
+	}
+
+	// A second run with the same seed sends the same events
+	again, reemitted := run()
+
+	bodies := func(messages []message) []string {
+		bodies := make([]string, 0, len(messages))
+		for _, msg := range messages {
+			bodies = append(bodies, msg.Body)
+		}
+
+		return bodies
+	}
+
+	assert.Equal(t, bodies(sent), bodies(again))
+	assert.Equal(t, emitted, reemitted)
+}
+
+func TestSendFile(t *testing.T) {
+	type Test struct {
+		input string
+		down  bool
+		sent  []string
+		err   error
+	}
+
+	testCases := map[string]Test{
+		"Every Line Sent In Order": {
+			input: "{\"event_type\":\"a\",\"client_id\":\"client_123\"}\n\n  {\"event_type\":\"b\"}  \nnot json\n",
+			sent:  []string{`{"event_type":"a","client_id":"client_123"}`, `{"event_type":"b"}`, "not json"},
+		},
+		"Stops At First Failure": {
+			input: "{\"event_type\":\"a\"}\n{\"event_type\":\"b\"}\n",
+			down:  true,
+			err:   producer.ErrFailedToSend,
+		},
+		"Line Too Long": {
+			input: strings.Repeat("x", 2*1024*1024),
+			err:   producer.ErrFailedToRead,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sqs := &fakeSQS{}
+			sqs.down.Store(test.down)
+
+			p := newProducer(t, sqs, producer.WithRetry(1, time.Millisecond, time.Millisecond))
+
+			sent, err := p.SendFile(t.Context(), strings.NewReader(test.input), 0)
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			var bodies []string
+			for _, msg := range sqs.sent() {
+				bodies = append(bodies, msg.Body)
+			}
+
+			assert.Equal(t, len(test.sent), sent)
+			assert.Equal(t, test.sent, bodies)
+		})
+	}
+}
+
+func TestSend(t *testing.T) {
+	type Test struct {
+		body      string
+		published bool
+	}
+
+	testCases := map[string]Test{
+		"Valid Event Published": {
+			body:      `{"id":0,"event_type":"transaction_approved","client_id":"client_123","payload":{"amount":10.50},"timestamp":"2025-08-18T07:48:48Z"}`,
+			published: true,
+		},
+		"Invalid Event Sent As It Is": {
+			body: `{"event_type":"transaction_approved","payload":{}}`,
+		},
+		"Unknown Field Sent As It Is": {
+			body: `{"event_type":"transaction_approved","client_id":"client_123","payload":{},"timestamp":"2025-08-18T07:48:48Z","extra":true}`,
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			sqs := &fakeSQS{}
+			p := newProducer(t, sqs)
+
+			// Sending the same event again, e.g. resending a spill, keeps its key
+			require.NoError(t, p.Send(t.Context(), []byte(test.body)))
+			require.NoError(t, p.Send(t.Context(), []byte(test.body)))
+
+			sent := sqs.sent()
+			require.Len(t, sent, 2)
+
+			assert.JSONEq(t, test.body, sent[0].Body)
+			assert.Equal(t, sent[0].IdempotencyKey, sent[1].IdempotencyKey)
+
+			if test.published {
+				assert.NotEmpty(t, sent[0].IdempotencyKey)
+			} else {
+				assert.Empty(t, sent[0].IdempotencyKey)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package producer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrFailedToSpill = errors.New("failed to spill event")
+)
+
+// spill keeps the events that couldn't be sent in an NDJSON file, in the
+// order they were generated, until they can be resent. It survives restarts.
+type spill struct {
+	mu      sync.Mutex
+	path    string
+	pending int
+}
+
+func openSpill(path string) (*spill, error) {
+	s := &spill{path: path}
+
+	messages, _, err := s.read(0)
+	if err != nil {
+		return nil, err
+	}
+
+	s.pending = len(messages)
+
+	return s, nil
+}
+
+// len is the number of events waiting to be resent.
+func (s *spill) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pending
+}
+
+func (s *spill) append(msg message) error {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToSpill, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToSpill, err)
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+
+		return fmt.Errorf("%w: %w", ErrFailedToSpill, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToSpill, err)
+	}
+
+	s.pending++
+
+	return nil
+}
+
+// drain resends the spilled events in order, stopping at the first one that
+// fails to send for a reason worth retrying. Events that can never be sent
+// are dropped. Events spilled while draining are kept behind the unsent ones.
+func (s *spill) drain(ctx context.Context, send func(context.Context, message) error) (int, error) {
+	s.mu.Lock()
+	messages, offset, err := s.read(0)
+	s.mu.Unlock()
+
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+
+	for _, msg := range messages {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if err := send(ctx, msg); err != nil {
+			if retryable(err) {
+				break
+			}
+
+			log.Error().Err(err).Str("fault", msg.Fault).Msg("dropping spilled event that can't be sent")
+		}
+
+		sent++
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	appended, _, err := s.read(offset)
+	if err != nil {
+		return sent, err
+	}
+
+	remaining := append(messages[sent:], appended...)
+
+	if err := s.write(remaining); err != nil {
+		return sent, err
+	}
+
+	s.pending = len(remaining)
+
+	return sent, nil
+}
+
+// read decodes the events spilled from offset onwards, returning the offset
+// of the end of the file.
+func (s *spill) read(offset int64) ([]message, int64, error) {
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, 0, nil
+	}
+
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrFailedToSpill, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, fmt.Errorf("%w: %w", ErrFailedToSpill, err)
+	}
+
+	var messages []message
+
+	reader := bufio.NewReader(file)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A partial last line is left for the next read
+			return messages, offset, nil
+		}
+
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %w", ErrFailedToSpill, err)
+		}
+
+		offset += int64(len(line))
+
+		if line = bytes.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+
+		var msg message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return nil, 0, fmt.Errorf("%w: %s: %w", ErrFailedToSpill, s.path, err)
+		}
+
+		messages = append(messages, msg)
+	}
+}
+
+// write replaces the spill file with messages, removing it when there are
+// none.
+func (s *spill) write(messages []message) error {
+	if len(messages) == 0 {
+		if err := os.Remove(s.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("%w: %w", ErrFailedToSpill, err)
+		}
+
+		return nil
+	}
+
+	var buf bytes.Buffer
+
+	for _, msg := range messages {
+		line, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrFailedToSpill, err)
+		}
+
+		buf.Write(append(line, '\n'))
+	}
+
+	tmp := s.path + ".tmp"
+
+	if err := os.WriteFile(tmp, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToSpill, err)
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("%w: %w", ErrFailedToSpill, err)
+	}
+
+	return nil
+}
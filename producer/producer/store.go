@@ -0,0 +1,87 @@
+package producer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrFailedToConnect = errors.New("failed to connect to database")
+	ErrFailedToQuery   = errors.New("failed to query events")
+)
+
+// PostgresStore reads the processor's events table.
+type PostgresStore struct {
+	conn *sql.DB
+}
+
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	conn, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToConnect, err)
+	}
+
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+
+		return nil, fmt.Errorf("%w: %w", ErrFailedToConnect, err)
+	}
+
+	return &PostgresStore{conn: conn}, nil
+}
+
+// Persisted finds the client's saved events among messageIDs. It relies on
+// the processor's message_metadata enrichment stage recording message IDs. It
+// reads in a transaction scoped to the client with app.tenant_id, the events
+// table having row level security.
+func (s *PostgresStore) Persisted(ctx context.Context, clientID string, messageIDs []string) (map[string]Persisted, error) {
+	tx, err := s.conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('app.tenant_id', $1, true)`, clientID); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT message_id, received_at, persisted_at FROM events WHERE message_id = ANY($1) AND persisted_at IS NOT NULL`,
+		pq.Array(messageIDs),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+	}
+	defer rows.Close()
+
+	persisted := make(map[string]Persisted, len(messageIDs))
+
+	for rows.Next() {
+		var (
+			messageID   string
+			receivedAt  sql.NullTime
+			persistedAt time.Time
+		)
+
+		if err := rows.Scan(&messageID, &receivedAt, &persistedAt); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+		}
+
+		persisted[messageID] = Persisted{ReceivedAt: receivedAt.Time, PersistedAt: persistedAt}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToQuery, err)
+	}
+
+	return persisted, nil
+}
+
+func (s *PostgresStore) Close() error {
+	return s.conn.Close()
+}
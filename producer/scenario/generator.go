@@ -0,0 +1,307 @@
+package scenario
+
+import (
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Event is a generated event, before the producer encodes and sends it.
+type Event struct {
+	Type          string
+	ClientID      string
+	Payload       map[string]any
+	SchemaVersion int
+	Timestamp     time.Time
+	// Fault is set when the event is to be sent malformed.
+	Fault Fault
+}
+
+// Data is available to payload templates as dot.
+type Data struct {
+	EventType string
+	ClientID  string
+	// Seq counts the events generated by the scenario, starting at 1.
+	Seq int64
+}
+
+// Generator picks clients and event types by weight and renders payloads.
+// It is not safe for concurrent use.
+type Generator struct {
+	rng     *rand.Rand
+	clients []Client
+	events  []compiledEvent
+	faults  Faults
+	seq     int64
+	rate    float64
+	start   time.Time
+	now     time.Time
+}
+
+type GeneratorOption func(*Generator)
+
+// WithStart timestamps events from start, spaced by the scenario's rate,
+// instead of with the current time. Together with a seeded rand, it makes
+// the generated events the same on every run.
+func WithStart(start time.Time) GeneratorOption {
+	return func(g *Generator) {
+		g.start = start.UTC()
+	}
+}
+
+type compiledEvent struct {
+	EventTemplate
+	payload node
+}
+
+func NewGenerator(scenario Scenario, rng *rand.Rand, opts ...GeneratorOption) (*Generator, error) {
+	if err := scenario.Validate(); err != nil {
+		return nil, err
+	}
+
+	g := &Generator{
+		rng:     rng,
+		clients: scenario.Clients,
+		faults:  scenario.Faults,
+		rate:    scenario.Rate,
+	}
+
+	for _, opt := range opts {
+		opt(g)
+	}
+
+	if len(g.faults.Kinds) == 0 {
+		g.faults.Kinds = AllFaults
+	}
+
+	for _, event := range scenario.Events {
+		payload, err := compile(event.Payload, g.funcs())
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", ErrInvalidScenario, event.Type, err)
+		}
+
+		g.events = append(g.events, compiledEvent{EventTemplate: event, payload: payload})
+	}
+
+	return g, nil
+}
+
+// Next generates the next event.
+func (g *Generator) Next() (Event, error) {
+	g.seq++
+
+	if g.start.IsZero() {
+		g.now = time.Now().UTC()
+	} else {
+		g.now = g.start.Add(time.Duration(float64(g.seq-1) / g.rate * float64(time.Second)))
+	}
+
+	client := g.clients[pick(g.rng, g.clients, func(c Client) int { return c.Weight })]
+	event := g.events[pick(g.rng, g.events, func(e compiledEvent) int { return e.Weight })]
+
+	payload, err := event.payload.render(Data{EventType: event.Type, ClientID: client.ID, Seq: g.seq})
+	if err != nil {
+		return Event{}, fmt.Errorf("%s: %w", event.Type, err)
+	}
+
+	rendered, _ := payload.(map[string]any)
+
+	return Event{
+		Type:          event.Type,
+		ClientID:      client.ID,
+		Payload:       rendered,
+		SchemaVersion: event.SchemaVersion,
+		Timestamp:     g.now,
+		Fault:         g.fault(),
+	}, nil
+}
+
+// fault picks the fault to inject into the next event, if any.
+func (g *Generator) fault() Fault {
+	// Only draw when injecting so scenarios without faults generate the same
+	// events as before
+	if g.faults.Percent == 0 || g.rng.Float64()*100 >= g.faults.Percent {
+		return ""
+	}
+
+	return g.faults.Kinds[g.rng.Intn(len(g.faults.Kinds))]
+}
+
+// pick returns the index of a random item, chosen in proportion to its
+// weight. Items all weighing 0 are picked evenly.
+func pick[T any](rng *rand.Rand, items []T, weight func(T) int) int {
+	total := 0
+
+	for _, item := range items {
+		total += weight(item)
+	}
+
+	if total == 0 {
+		return rng.Intn(len(items))
+	}
+
+	n := rng.Intn(total)
+
+	for i, item := range items {
+		if n < weight(item) {
+			return i
+		}
+
+		n -= weight(item)
+	}
+
+	return len(items) - 1
+}
+
+// funcs are the generator functions available to payload templates.
+func (g *Generator) funcs() template.FuncMap {
+	return template.FuncMap{
+		// int returns a random integer in [min, max]
+		"int": func(min, max int) (int, error) {
+			if max < min {
+				return 0, fmt.Errorf("int: max %d is less than min %d", max, min)
+			}
+
+			return min + g.rng.Intn(max-min+1), nil
+		},
+		// decimal returns a random number in [min, max] with places decimal
+		// places
+		"decimal": func(min, max float64, places int) string {
+			return strconv.FormatFloat(min+g.rng.Float64()*(max-min), 'f', places, 64)
+		},
+		"oneof": func(values ...string) (string, error) {
+			if len(values) == 0 {
+				return "", fmt.Errorf("oneof: no values")
+			}
+
+			return values[g.rng.Intn(len(values))], nil
+		},
+		"uuid": func() string {
+			var b [16]byte
+
+			_, _ = g.rng.Read(b[:])
+			b[6] = b[6]&0x0f | 0x40
+			b[8] = b[8]&0x3f | 0x80
+
+			return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+		},
+		// now is the timestamp of the event being generated
+		"now": func() string {
+			return g.now.Format(time.RFC3339)
+		},
+	}
+}
+
+// node is a compiled payload value.
+type node interface {
+	render(data Data) (any, error)
+}
+
+type literal struct{ value any }
+
+type text struct{ template *template.Template }
+
+type object map[string]node
+
+type list []node
+
+func (n literal) render(Data) (any, error) {
+	return n.value, nil
+}
+
+func (n text) render(data Data) (any, error) {
+	var b strings.Builder
+
+	if err := n.template.Execute(&b, data); err != nil {
+		return nil, err
+	}
+
+	return b.String(), nil
+}
+
+func (n object) render(data Data) (any, error) {
+	rendered := make(map[string]any, len(n))
+
+	// Fields are rendered in a fixed order so a seeded generator draws the
+	// same values for them every time
+	for _, key := range slices.Sorted(maps.Keys(n)) {
+		value, err := n[key].render(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+
+		rendered[key] = value
+	}
+
+	return rendered, nil
+}
+
+func (n list) render(data Data) (any, error) {
+	rendered := make([]any, 0, len(n))
+
+	for i, child := range n {
+		value, err := child.render(data)
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %w", i, err)
+		}
+
+		rendered = append(rendered, value)
+	}
+
+	return rendered, nil
+}
+
+// compile parses the templates of a payload. Parsing without funcs only
+// checks the syntax, by stubbing the generator functions.
+func compile(value any, funcs template.FuncMap) (node, error) {
+	switch v := value.(type) {
+	case map[string]any:
+		compiled := make(object, len(v))
+
+		for key, child := range v {
+			n, err := compile(child, funcs)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+
+			compiled[key] = n
+		}
+
+		return compiled, nil
+	case []any:
+		compiled := make(list, 0, len(v))
+
+		for i, child := range v {
+			n, err := compile(child, funcs)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+
+			compiled = append(compiled, n)
+		}
+
+		return compiled, nil
+	case string:
+		if !strings.Contains(v, "{{") {
+			return literal{v}, nil
+		}
+
+		if funcs == nil {
+			funcs = (&Generator{}).funcs()
+		}
+
+		t, err := template.New("").Funcs(funcs).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, err
+		}
+
+		return text{t}, nil
+	default:
+		return literal{v}, nil
+	}
+}
@@ -0,0 +1,218 @@
+package scenario
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrFailedToLoad    = errors.New("failed to load scenario")
+	ErrInvalidScenario = errors.New("scenario is invalid")
+)
+
+// Scenario describes a stream of generated events: which clients send them,
+// the mix of event types and how fast and for how long they are sent.
+type Scenario struct {
+	Name string `yaml:"name"`
+	// Rate is the target number of events sent per second.
+	Rate float64 `yaml:"rate"`
+	// Duration stops the scenario after it has run this long, 0 runs it
+	// until the producer is stopped.
+	Duration time.Duration `yaml:"duration"`
+	// Count stops the scenario after it has generated this many events, 0
+	// doesn't limit it.
+	Count   int             `yaml:"count"`
+	Clients []Client        `yaml:"clients"`
+	Events  []EventTemplate `yaml:"events"`
+	Faults  Faults          `yaml:"faults"`
+}
+
+// Fault is a kind of malformed event the producer sends in place of a
+// generated one.
+type Fault string
+
+const (
+	FaultInvalidJSON      Fault = "invalid_json"
+	FaultMissingClientID  Fault = "missing_client_id"
+	FaultBadTimestamp     Fault = "bad_timestamp"
+	FaultOversizedPayload Fault = "oversized_payload"
+	FaultUnknownEventType Fault = "unknown_event_type"
+)
+
+// AllFaults lists every kind of fault.
+var AllFaults = []Fault{
+	FaultInvalidJSON,
+	FaultMissingClientID,
+	FaultBadTimestamp,
+	FaultOversizedPayload,
+	FaultUnknownEventType,
+}
+
+// Faults injects malformed events into a scenario, to exercise the
+// processor's DLQ.
+type Faults struct {
+	// Percent is the share of events replaced by a malformed one.
+	Percent float64 `yaml:"percent"`
+	// Kinds are picked evenly, every kind is injected when it is empty.
+	Kinds []Fault `yaml:"kinds"`
+}
+
+// Client sends a share of a scenario's events proportional to its weight.
+type Client struct {
+	ID     string `yaml:"id"`
+	Weight int    `yaml:"weight"`
+}
+
+// EventTemplate generates events of one type. String values of the payload,
+// however deeply nested, are Go templates rendered for every event with the
+// generator functions, other values are sent as they are.
+type EventTemplate struct {
+	Type          string         `yaml:"type"`
+	Weight        int            `yaml:"weight"`
+	SchemaVersion int            `yaml:"schema_version"`
+	Payload       map[string]any `yaml:"payload"`
+}
+
+// Default reproduces the producer's original traffic, a transaction_approved
+// event from one of three clients every 15 seconds.
+func Default() Scenario {
+	return Scenario{
+		Name: "default",
+		Rate: 1.0 / 15,
+		Clients: []Client{
+			{ID: "client_123", Weight: 1},
+			{ID: "client_456", Weight: 1},
+			{ID: "client_789", Weight: 1},
+		},
+		Events: []EventTemplate{
+			{
+				Type:          "transaction_approved",
+				Weight:        1,
+				SchemaVersion: 1,
+				Payload: map[string]any{
+					"transaction_id": "txn_{{int 0 999}}",
+					"amount":         "{{decimal 0 999 2}}",
+					"currency":       "GBP",
+				},
+			},
+		},
+	}
+}
+
+// Load reads a YAML scenario file, named after the file unless it sets a
+// name.
+func Load(path string) (Scenario, error) {
+	var scenario Scenario
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return scenario, fmt.Errorf("%w: %w", ErrFailedToLoad, err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(&scenario); err != nil {
+		return scenario, fmt.Errorf("%w: %s: %w", ErrFailedToLoad, path, err)
+	}
+
+	if scenario.Name == "" {
+		scenario.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+
+	if err := scenario.Validate(); err != nil {
+		return scenario, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return scenario, nil
+}
+
+// LoadAll loads every scenario file in paths.
+func LoadAll(paths []string) ([]Scenario, error) {
+	scenarios := make([]Scenario, 0, len(paths))
+
+	for _, path := range paths {
+		scenario, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+
+		scenarios = append(scenarios, scenario)
+	}
+
+	return scenarios, nil
+}
+
+// Validate reports every problem with the scenario, including payload
+// templates that don't parse.
+func (s Scenario) Validate() error {
+	var problems []string
+
+	if s.Rate <= 0 {
+		problems = append(problems, "rate must be greater than 0")
+	}
+
+	if s.Duration < 0 {
+		problems = append(problems, "duration can't be negative")
+	}
+
+	if s.Count < 0 {
+		problems = append(problems, "count can't be negative")
+	}
+
+	if len(s.Clients) == 0 {
+		problems = append(problems, "at least one client is required")
+	}
+
+	for i, client := range s.Clients {
+		if client.ID == "" {
+			problems = append(problems, fmt.Sprintf("clients[%d].id is required", i))
+		}
+
+		if client.Weight < 0 {
+			problems = append(problems, fmt.Sprintf("clients[%d].weight can't be negative", i))
+		}
+	}
+
+	if len(s.Events) == 0 {
+		problems = append(problems, "at least one event is required")
+	}
+
+	for i, event := range s.Events {
+		if event.Type == "" {
+			problems = append(problems, fmt.Sprintf("events[%d].type is required", i))
+		}
+
+		if event.Weight < 0 {
+			problems = append(problems, fmt.Sprintf("events[%d].weight can't be negative", i))
+		}
+
+		if _, err := compile(event.Payload, nil); err != nil {
+			problems = append(problems, fmt.Sprintf("events[%d].payload: %v", i, err))
+		}
+	}
+
+	if s.Faults.Percent < 0 || s.Faults.Percent > 100 {
+		problems = append(problems, "faults.percent must be between 0 and 100")
+	}
+
+	for i, kind := range s.Faults.Kinds {
+		if !slices.Contains(AllFaults, kind) {
+			problems = append(problems, fmt.Sprintf("faults.kinds[%d] %q is unknown", i, kind))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidScenario, strings.Join(problems, ", "))
+	}
+
+	return nil
+}
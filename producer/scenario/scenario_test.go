@@ -0,0 +1,278 @@
+package scenario_test
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/EWK20/event-processor/producer/scenario"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad(t *testing.T) {
+	type Test struct {
+		content string
+		err     error
+		name    string
+	}
+
+	testCases := map[string]Test{
+		"Valid Scenario": {
+			content: `
+rate: 10
+duration: 1m
+clients:
+  - id: client_123
+events:
+  - type: transaction_approved
+    payload:
+      amount: "{{decimal 1 10 2}}"
+`,
+			name: "traffic",
+		},
+		"Unknown Field": {
+			content: `
+rate: 10
+speed: 5
+clients:
+  - id: client_123
+events:
+  - type: transaction_approved
+`,
+			err: scenario.ErrFailedToLoad,
+		},
+		"Missing Rate And Clients": {
+			content: `
+events:
+  - type: transaction_approved
+`,
+			err: scenario.ErrInvalidScenario,
+		},
+		"Invalid Template": {
+			content: `
+rate: 1
+clients:
+  - id: client_123
+events:
+  - type: transaction_approved
+    payload:
+      amount: "{{decimal 1 10"
+`,
+			err: scenario.ErrInvalidScenario,
+		},
+		"Unknown Generator": {
+			content: `
+rate: 1
+clients:
+  - id: client_123
+events:
+  - type: transaction_approved
+    payload:
+      amount: "{{money}}"
+`,
+			err: scenario.ErrInvalidScenario,
+		},
+		"Faults": {
+			content: `
+rate: 1
+clients:
+  - id: client_123
+events:
+  - type: transaction_approved
+faults:
+  percent: 5
+  kinds: [invalid_json, missing_client_id]
+`,
+			name: "traffic",
+		},
+		"Unknown Fault": {
+			content: `
+rate: 1
+clients:
+  - id: client_123
+events:
+  - type: transaction_approved
+faults:
+  percent: 5
+  kinds: [slow_consumer]
+`,
+			err: scenario.ErrInvalidScenario,
+		},
+		"Negative Count": {
+			content: `
+rate: 1
+count: -1
+clients:
+  - id: client_123
+events:
+  - type: transaction_approved
+`,
+			err: scenario.ErrInvalidScenario,
+		},
+		"Fault Percent Over 100": {
+			content: `
+rate: 1
+clients:
+  - id: client_123
+events:
+  - type: transaction_approved
+faults:
+  percent: 150
+`,
+			err: scenario.ErrInvalidScenario,
+		},
+	}
+
+	for scenarioName, test := range testCases {
+		t.Run(scenarioName, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "traffic.yaml")
+			require.NoError(t, os.WriteFile(path, []byte(test.content), 0o600))
+
+			loaded, err := scenario.Load(path)
+			if test.err != nil {
+				require.ErrorIs(t, err, test.err)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.name, loaded.Name)
+		})
+	}
+}
+
+func TestExampleScenarios(t *testing.T) {
+	paths, err := filepath.Glob("../scenarios/*.yaml")
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+
+	scenarios, err := scenario.LoadAll(paths)
+	require.NoError(t, err)
+
+	for _, s := range append(scenarios, scenario.Default()) {
+		generator, err := scenario.NewGenerator(s, rand.New(rand.NewSource(1)))
+		require.NoError(t, err)
+
+		for range 100 {
+			_, err := generator.Next()
+			require.NoError(t, err)
+		}
+	}
+}
+
+func TestGenerator(t *testing.T) {
+	s := scenario.Scenario{
+		Name: "test",
+		Rate: 1,
+		Clients: []scenario.Client{
+			{ID: "client_123", Weight: 3},
+			{ID: "client_456", Weight: 1},
+			{ID: "client_789", Weight: 0},
+		},
+		Events: []scenario.EventTemplate{
+			{
+				Type:          "transaction_approved",
+				Weight:        1,
+				SchemaVersion: 2,
+				Payload: map[string]any{
+					"transaction_id": "txn_{{.Seq}}",
+					"client":         "{{.ClientID}}",
+					"amount":         "{{decimal 1 10 2}}",
+					"quantity":       "{{int 1 3}}",
+					"currency":       `{{oneof "GBP" "EUR"}}`,
+					"captured":       true,
+					"items":          []any{map[string]any{"sku": "sku_{{int 1 9}}"}, 5},
+				},
+			},
+		},
+	}
+
+	generator, err := scenario.NewGenerator(s, rand.New(rand.NewSource(42)))
+	require.NoError(t, err)
+
+	clients := make(map[string]int)
+
+	for i := range 4000 {
+		event, err := generator.Next()
+		require.NoError(t, err)
+
+		clients[event.ClientID]++
+
+		assert.Equal(t, "transaction_approved", event.Type)
+		assert.Equal(t, 2, event.SchemaVersion)
+		assert.Equal(t, "txn_"+strconv.Itoa(i+1), event.Payload["transaction_id"])
+		assert.Equal(t, event.ClientID, event.Payload["client"])
+		assert.Regexp(t, `^\d+\.\d{2}$`, event.Payload["amount"])
+		assert.Contains(t, []string{"1", "2", "3"}, event.Payload["quantity"])
+		assert.Contains(t, []string{"GBP", "EUR"}, event.Payload["currency"])
+		assert.Equal(t, true, event.Payload["captured"])
+		assert.Regexp(t, `^sku_\d$`, event.Payload["items"].([]any)[0].(map[string]any)["sku"])
+		assert.Equal(t, 5, event.Payload["items"].([]any)[1])
+	}
+
+	// Clients are picked in proportion to their weight
+	assert.InDelta(t, 3000, clients["client_123"], 150)
+	assert.InDelta(t, 1000, clients["client_456"], 150)
+	assert.Zero(t, clients["client_789"])
+}
+
+func TestGeneratorFaults(t *testing.T) {
+	s := scenario.Default()
+	s.Faults = scenario.Faults{Percent: 20}
+
+	generator, err := scenario.NewGenerator(s, rand.New(rand.NewSource(42)))
+	require.NoError(t, err)
+
+	faults := make(map[scenario.Fault]int)
+
+	for range 5000 {
+		event, err := generator.Next()
+		require.NoError(t, err)
+
+		faults[event.Fault]++
+	}
+
+	// Every kind is injected when none are listed, evenly
+	assert.InDelta(t, 4000, faults[""], 150)
+
+	for _, kind := range scenario.AllFaults {
+		assert.InDelta(t, 200, faults[kind], 60, kind)
+	}
+}
+
+func TestGeneratorStart(t *testing.T) {
+	s := scenario.Default()
+	s.Rate = 4
+	s.Faults = scenario.Faults{Percent: 10}
+
+	start := time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	generate := func() []scenario.Event {
+		generator, err := scenario.NewGenerator(s, rand.New(rand.NewSource(7)), scenario.WithStart(start))
+		require.NoError(t, err)
+
+		events := make([]scenario.Event, 0, 100)
+
+		for range 100 {
+			event, err := generator.Next()
+			require.NoError(t, err)
+
+			events = append(events, event)
+		}
+
+		return events
+	}
+
+	events := generate()
+
+	// The same seed and start generate the same events, timestamped by rate
+	assert.Equal(t, events, generate())
+
+	for i, event := range events {
+		assert.Equal(t, start.Add(time.Duration(i)*250*time.Millisecond), event.Timestamp)
+	}
+}